@@ -1,56 +1,80 @@
 package adapter
 
 import (
+	"sync"
 	"time"
 
 	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/source"
+	"github.com/mrtc0/conduit/tracing"
 )
 
 type EventAdapter[T any] struct {
-	source        *source.EventSource[T]
+	sources       []*source.EventSource[T]
 	pipelineInput chan *event.Event[T]
 
+	wg          sync.WaitGroup
 	quit        chan struct{}
 	timeNowFunc func() time.Time
+	tracer      *tracing.Tracer
 }
 
 func NewEventAdapter[T any](
-	source *source.EventSource[T],
+	src *source.EventSource[T],
 	pipelineInput chan *event.Event[T],
 ) *EventAdapter[T] {
 	return &EventAdapter[T]{
-		source:        source,
+		sources:       []*source.EventSource[T]{src},
 		pipelineInput: pipelineInput,
 		quit:          make(chan struct{}),
 		timeNowFunc:   time.Now,
 	}
 }
 
+// AddSource adds a source whose events are fanned in to the pipeline.
+// It must be called before Start.
+func (a *EventAdapter[T]) AddSource(src *source.EventSource[T]) {
+	a.sources = append(a.sources, src)
+}
+
 func (a *EventAdapter[T]) Start() {
-	go a.run()
+	for _, src := range a.sources {
+		a.wg.Add(1)
+		go a.run(src)
+	}
+
+	go func() {
+		a.wg.Wait()
+		close(a.quit)
+	}()
 }
 
+// WaitClose waits until the input channels of all sources are closed and drained.
 func (a *EventAdapter[T]) WaitClose() {
 	<-a.quit
 }
 
-func (a *EventAdapter[T]) run() {
-	defer func() {
-		close(a.quit)
-	}()
+func (a *EventAdapter[T]) run(src *source.EventSource[T]) {
+	defer a.wg.Done()
 
-	for rawEvt := range a.source.InputChannel {
+	for rawEvt := range src.InputChannel {
 		evt := event.NewEvent(rawEvt)
 
 		if evt.IngestionTime.IsZero() {
 			evt.IngestionTime = a.timeNowFunc()
 		}
 
+		span := a.tracer.StartIngest(&evt.Metadata)
 		a.pipelineInput <- evt
+		span.End()
 	}
 }
 
 func (a *EventAdapter[T]) SetTimeNowFunc(fn func() time.Time) {
 	a.timeNowFunc = fn
 }
+
+// SetTracer sets the tracer used to create a span for each event entering the pipeline.
+func (a *EventAdapter[T]) SetTracer(t *tracing.Tracer) {
+	a.tracer = t
+}
@@ -1,6 +1,7 @@
 package adapter_test
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -71,3 +72,46 @@ func TestEventAdapter_run(t *testing.T) {
 		})
 	}
 }
+
+func TestEventAdapter_AddSource(t *testing.T) {
+	t.Parallel()
+
+	sources := []*source.EventSource[testutils.DummyEvent]{
+		{InputChannel: make(chan *event.RawEvent[testutils.DummyEvent])},
+		{InputChannel: make(chan *event.RawEvent[testutils.DummyEvent])},
+	}
+	pipelineInput := make(chan *event.Event[testutils.DummyEvent])
+
+	eventAdapter := adapter.NewEventAdapter(sources[0], pipelineInput)
+	eventAdapter.AddSource(sources[1])
+	eventAdapter.Start()
+
+	for i, src := range sources {
+		content := testutils.DummyEvent{ID: fmt.Sprintf("%d", i), Name: "Test Event"}
+		src.InputChannel <- event.NewRawEvent(content, nil)
+
+		evt := <-pipelineInput
+		assert.Equal(t, content, evt.Content())
+	}
+
+	close(sources[0].InputChannel)
+
+	select {
+	case <-waitClose(eventAdapter):
+		t.Fatal("adapter should wait until all sources are closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(sources[1].InputChannel)
+	<-waitClose(eventAdapter)
+}
+
+func waitClose[T any](a *adapter.EventAdapter[T]) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		a.WaitClose()
+		close(done)
+	}()
+
+	return done
+}
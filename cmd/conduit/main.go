@@ -0,0 +1,143 @@
+// Command conduit runs a pipeline described by a configuration file, whose events are JSON documents.
+//
+// Usage:
+//
+//	conduit run [-config conduit.yaml] [-metrics-addr :9090]
+//	conduit validate [-config conduit.yaml]
+//	conduit test [-config conduit.yaml] [events.ndjson]
+//	conduit version
+//
+// See the config package for the format of the configuration file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+)
+
+// version is the version of the command, set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = ""
+
+const defaultConfigPath = "conduit.yaml"
+
+// errUsage is returned by a command called with invalid arguments, after printing its usage.
+var errUsage = errors.New("invalid usage")
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdout, stderr io.Writer) error
+}
+
+var commands = []command{
+	{name: "run", summary: "run the pipeline until SIGINT or SIGTERM, reloading it on SIGHUP", run: runCommand},
+	{name: "validate", summary: "check the configuration file", run: validateCommand},
+	{name: "test", summary: "apply the rules to the events of an NDJSON file and print the results", run: testCommand},
+	{name: "version", summary: "print the version", run: versionCommand},
+}
+
+func main() {
+	os.Exit(execute(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// execute runs the command named by the first argument and returns the exit code.
+func execute(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+
+		err := cmd.run(args[1:], stdout, stderr)
+		switch {
+		case err == nil, errors.Is(err, flag.ErrHelp):
+			return 0
+		case errors.Is(err, errUsage):
+			return 2
+		}
+
+		_, _ = fmt.Fprintf(stderr, "conduit %s: %v\n", cmd.name, err)
+		return 1
+	}
+
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		usage(stdout)
+		return 0
+	}
+
+	_, _ = fmt.Fprintf(stderr, "conduit: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: conduit <command> [flags]")
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, `Run "conduit <command> -h" for the flags of a command.`)
+}
+
+// newFlagSet creates the flag set of a command, which prints its errors and usage to stderr.
+func newFlagSet(name, args string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: conduit %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// parseFlags parses the arguments of a command, accepting at most maxArgs positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > maxArgs {
+		_, _ = fmt.Fprintf(fs.Output(), "too many arguments: %v\n", fs.Args())
+		fs.Usage()
+		return errUsage
+	}
+
+	return nil
+}
+
+func versionCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("version", "", stderr)
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(stdout, "conduit %s\n", buildVersion())
+	return err
+}
+
+// buildVersion returns the version set at build time, or the version of the module when installed with go install.
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return "devel"
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfig = `
+rules:
+  - type: filter
+    name: drop-debug
+    condition: {field: level, op: equals, value: debug}
+  - type: transform
+    name: env
+    operations:
+      - {op: set, to: env, value: prod}
+sink: {type: stdout}
+`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestExecute(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	configPath := writeFile(t, dir, "conduit.yaml", testConfig)
+	invalidPath := writeFile(t, dir, "invalid.yaml", "rules: [{type: filter, condition: {field: level, op: equal}}]\nsink: {type: stdout}")
+	eventsPath := writeFile(t, dir, "events.ndjson", "{\"level\":\"info\"}\n\n{\"level\":\"debug\"}\nnot json\n")
+
+	testCases := map[string]struct {
+		args       []string
+		wantCode   int
+		wantStdout string
+		wantStderr string
+	}{
+		"test": {
+			args:     []string{"test", "-config", configPath, eventsPath},
+			wantCode: 0,
+			wantStdout: `{"line":1,"result":"kept","event":{"level":"info","env":"prod"}}
+{"line":3,"result":"dropped","rule":"drop-debug","reason":"drop-debug","event":{"level":"debug"}}
+{"line":4,"result":"invalid","reason":"invalid JSON"}
+`,
+			wantStderr: "1 kept, 1 dropped, 1 invalid\n",
+		},
+		"validate": {
+			args:       []string{"validate", "-config", configPath},
+			wantCode:   0,
+			wantStdout: configPath + " is valid: 0 sources, 2 rules, 1 destinations\n",
+		},
+		"validate an invalid config": {
+			args:       []string{"validate", "-config", invalidPath},
+			wantCode:   1,
+			wantStderr: `conduit validate: rules[0]: invalid condition on field "level": unknown operator "equal"` + "\n",
+		},
+		"version": {
+			args:       []string{"version"},
+			wantCode:   0,
+			wantStdout: "conduit devel\n",
+		},
+		"too many arguments": {
+			args:       []string{"validate", "-config", configPath, eventsPath},
+			wantCode:   2,
+			wantStderr: "too many arguments",
+		},
+		"unknown command": {
+			args:       []string{"start"},
+			wantCode:   2,
+			wantStderr: `conduit: unknown command "start"`,
+		},
+		"no command": {
+			args:       nil,
+			wantCode:   2,
+			wantStderr: "Usage: conduit <command> [flags]",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+			code := execute(tc.args, stdout, stderr)
+
+			assert.Equal(t, tc.wantCode, code)
+			assert.Equal(t, tc.wantStdout, stdout.String())
+			assert.Contains(t, stderr.String(), tc.wantStderr)
+		})
+	}
+}
+
+func TestAgent_Run(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	input := writeFile(t, dir, "input.ndjson", "")
+	output := filepath.Join(dir, "output.json")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	configFor := func(level string) string {
+		return `
+sources:
+  - type: file
+    paths: [` + input + `]
+    checkpoint_path: ` + checkpoint + `
+    read_from_beginning: true
+    poll_interval: 10ms
+rules:
+  - type: filter
+    condition: {field: level, op: equals, value: ` + level + `}
+sink: {type: file, path: ` + output + `}
+`
+	}
+	configPath := writeFile(t, dir, "conduit.yaml", configFor("debug"))
+
+	appendEvent := func(content string) {
+		f, err := os.OpenFile(input, os.O_APPEND|os.O_WRONLY, 0600)
+		require.NoError(t, err)
+		_, err = f.WriteString(content + "\n")
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	waitOutput := func(want string) {
+		assert.Eventually(t, func() bool {
+			got, _ := os.ReadFile(output)
+			return string(got) == want
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	signals := make(chan os.Signal)
+	a := &agent{configPath: configPath, halted: make(chan error, 1)}
+	done := make(chan error)
+	go func() {
+		done <- a.run(signals)
+	}()
+
+	// reload sends SIGHUP twice, since the second one is received only once the first one is handled
+	reload := func() {
+		signals <- syscall.SIGHUP
+		signals <- syscall.SIGHUP
+	}
+
+	appendEvent(`{"id":1,"level":"debug"}`)
+	appendEvent(`{"id":2,"level":"info"}`)
+	waitOutput("{\"id\":2,\"level\":\"info\"}\n")
+
+	// an invalid configuration keeps the running pipeline
+	writeFile(t, dir, "conduit.yaml", "rules: [{type: magic}]\nsink: {type: stdout}")
+	reload()
+
+	writeFile(t, dir, "conduit.yaml", configFor("info"))
+	reload()
+
+	appendEvent(`{"id":3,"level":"debug"}`)
+	appendEvent(`{"id":4,"level":"info"}`)
+	waitOutput("{\"id\":2,\"level\":\"info\"}\n{\"id\":3,\"level\":\"debug\"}\n")
+
+	signals <- syscall.SIGTERM
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+	"time"
+
+	"github.com/mrtc0/conduit"
+	"github.com/mrtc0/conduit/config"
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
+)
+
+func runCommand(args []string, _, stderr io.Writer) error {
+	fs := newFlagSet("run", "", stderr)
+	configPath := fs.String("config", defaultConfigPath, "path of the configuration file")
+	metricsAddr := fs.String("metrics-addr", "", "address to serve Prometheus metrics on, such as :9090")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	a := &agent{configPath: *configPath, halted: make(chan error, 1)}
+
+	if *metricsAddr != "" {
+		a.metrics = metrics.New()
+		stop, err := serveMetrics(*metricsAddr, a.metrics)
+		if err != nil {
+			return err
+		}
+		defer stop()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	return a.run(signals)
+}
+
+// agent runs the Conduit described by a configuration file until it is signalled to stop.
+type agent struct {
+	configPath string
+	metrics    *metrics.Metrics
+	// halted receives the error of a rule with the halt failure policy.
+	halted chan error
+
+	conduit *conduit.Conduit[json.RawMessage]
+	// doc is the configuration of the running conduit.
+	doc *config.Document
+}
+
+// run starts the Conduit and handles the signals: SIGHUP reloads the configuration file,
+// and the others stop the Conduit, flushing the events in the pipeline.
+func (a *agent) run(signals <-chan os.Signal) error {
+	doc, err := config.ParseFile(a.configPath)
+	if err != nil {
+		return err
+	}
+	if a.conduit, err = a.build(doc); err != nil {
+		return err
+	}
+	if err := a.conduit.Start(); err != nil {
+		return err
+	}
+	a.doc = doc
+	log.Info(fmt.Sprintf("conduit %s started with %s", buildVersion(), a.configPath))
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := a.reload(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			log.Info(fmt.Sprintf("received %v, stopping", sig))
+			return a.conduit.Stop()
+		case haltErr := <-a.halted:
+			return errors.Join(fmt.Errorf("pipeline halted: %w", haltErr), a.conduit.Stop())
+		}
+	}
+}
+
+// reload replaces the running Conduit with one built from the configuration file,
+// or only its rules if the other parts of the file have not changed.
+// If the file is invalid, the running Conduit is kept.
+// If the new Conduit fails to start, the previous configuration is started again,
+// and an error is returned only if that fails as well.
+func (a *agent) reload() error {
+	log.Info(fmt.Sprintf("reloading %s", a.configPath))
+
+	doc, err := config.ParseFile(a.configPath)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to reload configuration, keeping the running pipeline: %v", err))
+		return nil
+	}
+
+	if onlyRulesChanged(a.doc, doc) {
+		// the rules are replaced in the running Conduit, so that the buffered events are not flushed
+		rules, err := config.NewRules(doc, a.registry())
+		if err == nil {
+			err = a.conduit.ReplaceRules(rules)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("failed to reload rules, keeping the running rules: %v", err))
+			return nil
+		}
+
+		a.doc = doc
+		log.Info(fmt.Sprintf("reloaded the rules of %s", a.configPath))
+		return nil
+	}
+
+	next, err := a.build(doc)
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to reload configuration, keeping the running pipeline: %v", err))
+		return nil
+	}
+
+	// the running Conduit is stopped first, since the new one may listen on the same addresses
+	if err := a.conduit.Stop(); err != nil {
+		log.Error(fmt.Sprintf("failed to stop conduit: %v", err))
+	}
+	// a halt of the stopped Conduit does not stop the agent
+	select {
+	case <-a.halted:
+	default:
+	}
+
+	if err := next.Start(); err != nil {
+		log.Error(fmt.Sprintf("failed to start the reloaded pipeline, restoring the previous configuration: %v", err))
+
+		prev, buildErr := a.build(a.doc)
+		if buildErr != nil {
+			return fmt.Errorf("failed to restore the previous configuration: %w", buildErr)
+		}
+		if err := prev.Start(); err != nil {
+			return fmt.Errorf("failed to restore the previous configuration: %w", err)
+		}
+		a.conduit = prev
+		return nil
+	}
+
+	a.conduit, a.doc = next, doc
+	log.Info(fmt.Sprintf("reloaded %s", a.configPath))
+
+	return nil
+}
+
+// onlyRulesChanged reports whether the documents differ in their rules and rule failure policy only.
+func onlyRulesChanged(prev, next *config.Document) bool {
+	p, n := *prev, *next
+	p.Rules, n.Rules = nil, nil
+	p.RuleFailurePolicy, n.RuleFailurePolicy = "", ""
+
+	return reflect.DeepEqual(p, n)
+}
+
+func (a *agent) build(doc *config.Document) (*conduit.Conduit[json.RawMessage], error) {
+	return config.New(doc, a.registry(), func(c *conduit.Config[json.RawMessage]) {
+		c.Metrics = a.metrics
+		c.HaltHandler = func(err error) {
+			select {
+			case a.halted <- err:
+			default:
+			}
+		}
+	})
+}
+
+// serveMetrics serves the metrics on the address and returns a function shutting the server down.
+func serveMetrics(addr string, m *metrics.Metrics) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(fmt.Sprintf("failed to serve metrics: %v", err))
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
+
+// registry returns the registry of the factories, recording the metrics of the components such as lookup files.
+func (a *agent) registry() *config.Registry[json.RawMessage] {
+	r := config.NewRegistry[json.RawMessage]()
+	r.SetMetrics(a.metrics)
+
+	return r
+}
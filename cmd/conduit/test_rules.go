@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mrtc0/conduit/config"
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor"
+)
+
+// maxLineSize is the maximum size of a line of the events file of the test command.
+const maxLineSize = 4 * 1024 * 1024
+
+// testResult is the result of applying the rules to an event, printed as a line of JSON by the test command.
+type testResult struct {
+	// Line is the line number of the event in the input.
+	Line int `json:"line"`
+	// Result is one of kept, dropped and invalid.
+	Result string `json:"result"`
+	// Rule is the name of the rule that dropped the event.
+	Rule string `json:"rule,omitempty"`
+	// Reason explains why the event was dropped or is invalid.
+	Reason string `json:"reason,omitempty"`
+	// Error is the error of the rule that failed to process the event.
+	Error string `json:"error,omitempty"`
+	// Tags are the tags of the kept event.
+	Tags event.Tags `json:"tags,omitempty"`
+	// Event is the content of the kept or dropped event.
+	Event json.RawMessage `json:"event,omitempty"`
+}
+
+func testCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("test", "[events.ndjson]", stderr)
+	configPath := fs.String("config", defaultConfigPath, "path of the configuration file")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+
+	doc, err := config.ParseFile(*configPath)
+	if err != nil {
+		return err
+	}
+	// only the rules are created, so that testing does not write to the sinks
+	rules, err := config.NewRules[json.RawMessage](doc, nil)
+	if err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path) //#nosec G304
+		if err != nil {
+			return fmt.Errorf("failed to open events: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		input = f
+	}
+
+	var results []testResult
+	p := processor.NewProcessor(rules, nil, nil,
+		processor.WithDropHandler(func(dropped *event.DroppedEvent[json.RawMessage]) {
+			result := testResult{
+				Result: "dropped",
+				Rule:   dropped.Rule,
+				Reason: dropped.Reason,
+				Event:  dropped.Event.Content(),
+			}
+			if dropped.Err != nil {
+				result.Error = dropped.Err.Error()
+			}
+			results = append(results, result)
+		}),
+	)
+
+	encoder := json.NewEncoder(stdout)
+	var kept, dropped, invalid int
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		data := scanner.Bytes()
+		if len(data) == 0 {
+			continue
+		}
+
+		results = results[:0]
+		if json.Valid(data) {
+			content := json.RawMessage(append([]byte(nil), data...))
+			for _, evt := range p.Process(event.NewEvent(event.NewRawEvent(content, nil))) {
+				results = append(results, testResult{Result: "kept", Tags: evt.Tags, Event: evt.Content()})
+			}
+		} else {
+			results = append(results, testResult{Result: "invalid", Reason: "invalid JSON"})
+		}
+
+		for _, result := range results {
+			switch result.Result {
+			case "kept":
+				kept++
+			case "dropped":
+				dropped++
+			default:
+				invalid++
+			}
+
+			result.Line = line
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(stderr, "%d kept, %d dropped, %d invalid\n", kept, dropped, invalid)
+	if err := p.Err(); err != nil {
+		return fmt.Errorf("processing would have halted: %w", err)
+	}
+
+	return nil
+}
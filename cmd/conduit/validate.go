@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mrtc0/conduit/config"
+)
+
+func validateCommand(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("validate", "", stderr)
+	configPath := fs.String("config", defaultConfigPath, "path of the configuration file")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	doc, err := config.ParseFile(*configPath)
+	if err != nil {
+		return err
+	}
+
+	// building the configuration also checks what only the factories can, such as the files of TLS certificates
+	c, err := config.NewConfig[json.RawMessage](doc, nil)
+	if err != nil {
+		return err
+	}
+	for _, s := range config.Sinks(c) {
+		_ = s.Close()
+	}
+
+	destinations := len(c.Destinations)
+	if c.Sink != nil {
+		destinations++
+	}
+
+	_, err = fmt.Fprintf(stdout, "%s is valid: %d sources, %d rules, %d destinations\n",
+		*configPath, len(c.Sources), len(c.ProcessingRules), destinations)
+	return err
+}
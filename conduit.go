@@ -4,17 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/mrtc0/conduit/adapter"
 	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
 	"github.com/mrtc0/conduit/pipeline"
+	"github.com/mrtc0/conduit/processor"
 	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/queue"
 	"github.com/mrtc0/conduit/sender"
 	"github.com/mrtc0/conduit/sink"
 	"github.com/mrtc0/conduit/source"
 	"github.com/mrtc0/conduit/strategy"
+	"github.com/mrtc0/conduit/tracing"
 )
 
 var (
@@ -25,26 +34,149 @@ var (
 type Conduit[T any] struct {
 	inputChannel chan *event.RawEvent[T]
 
+	sources            []*attachedSource[T]
+	sourceErrorHandler source.ErrorHandler
+	cancelSources      context.CancelFunc
+
 	adapter          *adapter.EventAdapter[T]
 	pipelineProvider pipeline.Provider[T]
-	sender           *sender.Sender[T]
+	// senders are the senders of the sinks, whose messages may be of another type than T.
+	senders []stage
 
-	stopped bool
+	// configErr is an error in the configuration, which is returned from Start.
+	configErr error
+	// closers are the rule dead-letter sinks, which are closed when the Conduit is stopped.
+	closers []io.Closer
+	// haltErr is the error of the rule that halted the processing.
+	haltErr atomic.Pointer[error]
+
+	// state is the lifecycle state of the Conduit, which is started and stopped at most once.
+	state conduitState
+	// startErr is the error of the failed Start, returned by the later calls of Start and Stop.
+	startErr error
 
 	mu sync.Mutex
+
+	// rulesMu serializes the replacements of the processing rules.
+	rulesMu sync.Mutex
+	// previousRules are the rules replaced by the last ReplaceRules, restored by RollbackRules.
+	previousRules    []rule.Rule[T]
+	hasPreviousRules bool
+}
+
+type conduitState int
+
+const (
+	stateCreated conduitState = iota
+	stateRunning
+	stateStopped
+	// stateFailed is the state of a Conduit that failed to start, whose stages are shut down.
+	stateFailed
+)
+
+// stage is a stage of the Conduit that is started, flushed and stopped with it, such as a sender.
+type stage interface {
+	Start()
+	Flush(ctx context.Context) error
+	Stop() error
+}
+
+// attachedSource is a Source attached to the Conduit with the channel it sends events to.
+type attachedSource[T any] struct {
+	source source.Source[T]
+	output *source.EventSource[T]
 }
 
 type Config[T any] struct {
+	// Sources is a list of sources whose events are processed in addition to the events passed to Write.
+	Sources []source.Source[T]
+	// SourceErrorHandler is called with errors that the Sources encounter while they are running.
+	// If not specified, the errors are logged.
+	SourceErrorHandler source.ErrorHandler
 	// ProcessingRules is a list of processing rules to be applied to the messages.
 	// These rules will be executed in the order they are defined.
 	ProcessingRules []rule.Rule[T]
 	// Sink is the sink where the processed messages will be sent.
+	// It is configured with SendingStrategy, RetryPolicy, DeadLetterSink and PersistentQueue,
+	// and can be combined with Destinations.
 	Sink sink.Sink[T]
 	// Result is a channel where the results of the sending operation will be sent.
 	Result chan *sink.Result[T]
 	// SendingStrategy defines the strategy for sending messages.
 	// If not specified, the StreamStrategy will be used.
 	SendingStrategy SendingStrategy
+	// RetryPolicy defines how payloads that failed to be written to the Sink are retried.
+	// If not specified, failed payloads are not retried.
+	RetryPolicy sender.RetryPolicy
+	// DeadLetterSink is the sink where payloads that failed to be written to the Sink,
+	// after any retries, are written together with the error.
+	// If not specified, failed payloads are only reported to the Result channel.
+	DeadLetterSink sink.Sink[T]
+	// PersistentQueue stores payloads until they are delivered to the Sink,
+	// so that they survive a process restart. See queue.OpenWAL.
+	// If not specified, payloads are only buffered in memory.
+	PersistentQueue queue.Queue[T]
+	// Destinations is a list of additional sinks that receive every processed message.
+	// Each destination has its own sending strategy and sender, so that a slow or failing
+	// destination does not block the others.
+	Destinations []Destination[T]
+	// Routes select the destinations of each processed message by its tags or content.
+	// Rules can also set the pipeline.TagRoute tag to choose the destinations of a message.
+	// If neither Routes nor DefaultRoute is specified, messages are sent to every destination.
+	Routes []pipeline.Route
+	// DefaultRoute is the list of destination names that receive the messages matching no route.
+	// If not specified, such messages are dropped.
+	DefaultRoute []string
+	// Metrics records the metrics of every stage of the Conduit. See metrics.New.
+	// If not specified, no metrics are recorded.
+	Metrics *metrics.Metrics
+	// TracerProvider creates the OpenTelemetry spans of every stage of the Conduit.
+	// The trace context of a message is read from and stored in its event.Metadata.
+	// If not specified, no spans are created.
+	TracerProvider trace.TracerProvider
+	// DropHandler is called with each message that is discarded before reaching a sink,
+	// with the stage, the rule and the reason of the drop. See sink.NewDropHandler.
+	// If not specified, dropped messages are only counted in the metrics and logged.
+	DropHandler event.DropHandler[T]
+	// RuleFailurePolicy is the failure policy of the ProcessingRules that do not have their own,
+	// applied when a rule returns a rule.ErrorResult or panics. See rule.WithFailurePolicy.
+	// If not specified, rule.FailureSkip is used.
+	RuleFailurePolicy rule.FailurePolicy
+	// RuleDeadLetterSink is the sink where the messages are written when a rule with rule.FailureDeadLetter fails.
+	// If not specified, such messages are dropped.
+	RuleDeadLetterSink sink.Sink[T]
+	// HaltHandler is called with the error when a rule with rule.FailureHalt fails.
+	// After that, Write returns an error and the messages from the Sources are dropped until the Conduit is stopped.
+	// It is called from the goroutine of the pipeline, so it must not call Stop directly.
+	HaltHandler func(err error)
+}
+
+// DefaultDestinationName is the name of the destination made from Config.Sink.
+const DefaultDestinationName = "default"
+
+// Destination is a sink with its own sending strategy, retry policy and queue.
+type Destination[T any] struct {
+	// Name identifies the destination in logs and in the Result channel.
+	Name string
+	// Sink is the sink where the processed messages will be sent.
+	Sink sink.Sink[T]
+	// SendingStrategy defines the strategy for sending messages to the Sink.
+	// If not specified, the StreamStrategy will be used.
+	SendingStrategy SendingStrategy
+	// RetryPolicy defines how payloads that failed to be written to the Sink are retried.
+	RetryPolicy sender.RetryPolicy
+	// DeadLetterSink is the sink where payloads that failed to be written to the Sink are written.
+	DeadLetterSink sink.Sink[T]
+	// PersistentQueue stores payloads until they are delivered to the Sink.
+	PersistentQueue queue.Queue[T]
+	// BufferSize is the number of messages buffered for the destination when there are several destinations.
+	// If zero, pipeline.DefaultBranchBufferSize is used.
+	BufferSize int
+	// OverflowPolicy defines what happens to a message when the buffer of the destination is full.
+	// If empty, pipeline.OverflowBlock is used.
+	OverflowPolicy pipeline.OverflowPolicy
+	// OverflowTimeout is how long a message waits for room in the buffer before it is dropped with pipeline.OverflowDrop.
+	OverflowTimeout time.Duration
 }
 
 type SendingStrategy struct {
@@ -62,39 +194,259 @@ type SendingStrategy struct {
 
 // New creates a new Conduit instance with the provided configuration.
 func New[T any](config Config[T]) *Conduit[T] {
-	strategyOpt := &pipeline.StrategyOption{
-		StrategyType:  config.SendingStrategy.Type,
-		BufferLimit:   config.SendingStrategy.BufferLimitBytes,
-		FlushInterval: config.SendingStrategy.FlushInterval,
+	c := &Conduit[T]{}
+	tracer := tracing.New(config.TracerProvider)
+
+	branches, senders, names := newBranches(config, tracer)
+	pipelineOpts, configErr := newPipelineOptions(config, tracer, names, c.haltHandler(config.HaltHandler))
+	pp := pipeline.NewFanOutProvider(config.ProcessingRules, branches, pipelineOpts...)
+
+	c.init(config, pp, tracer)
+	for _, s := range senders {
+		c.senders = append(c.senders, s)
+	}
+	c.configErr = configErr
+	if config.RuleDeadLetterSink != nil {
+		c.closers = append(c.closers, config.RuleDeadLetterSink)
+	}
+
+	return c
+}
+
+// NewMapped creates a Conduit that applies the ProcessingRules of input to the messages of type T,
+// maps the processed messages to U with fn, and then applies the ProcessingRules of output
+// and sends the messages to the sinks of output.
+// The messages are received from Write and the Sources of input, so input must not have sinks or routes
+// and output must not have Sources. Both configurations are used for their own stage of the Conduit,
+// such as their Metrics, DropHandler and RuleFailurePolicy.
+// fn should create the mapped events with event.Map, so that the metadata is carried over.
+// A message that fn fails to map is dropped and reported to the DropHandler of input.
+func NewMapped[T, U any](input Config[T], fn processor.MapFunc[T, U], output Config[U]) *Conduit[T] {
+	c := &Conduit[T]{}
+	inputTracer := tracing.New(input.TracerProvider)
+	outputTracer := tracing.New(output.TracerProvider)
+
+	branches, senders, names := newBranches(output, outputTracer)
+	outputOpts, outputErr := newPipelineOptions(output, outputTracer, names, c.haltHandler(output.HaltHandler))
+	downstream := pipeline.NewFanOutProvider(output.ProcessingRules, branches, outputOpts...)
+
+	inputOpts, inputErr := newPipelineOptions(input, inputTracer, nil, c.haltHandler(input.HaltHandler))
+	pp := pipeline.NewMappedProvider(input.ProcessingRules, fn, downstream, inputOpts...)
+
+	c.init(input, pp, inputTracer)
+	for _, s := range senders {
+		c.senders = append(c.senders, s)
+	}
+	if input.RuleDeadLetterSink != nil {
+		c.closers = append(c.closers, input.RuleDeadLetterSink)
+	}
+	if output.RuleDeadLetterSink != nil {
+		c.closers = append(c.closers, output.RuleDeadLetterSink)
+	}
+
+	switch {
+	case input.Sink != nil || len(input.Destinations) > 0 || len(input.Routes) > 0 || len(input.DefaultRoute) > 0:
+		c.configErr = errors.New("input of a mapped conduit must not have sinks or routes")
+	case len(output.Sources) > 0:
+		c.configErr = errors.New("output of a mapped conduit must not have sources")
+	case inputErr != nil:
+		c.configErr = inputErr
+	case outputErr != nil:
+		c.configErr = outputErr
+	}
+
+	return c
+}
+
+// newBranches creates a sender and a pipeline branch for Config.Sink and each of Config.Destinations.
+// It also returns the names of the destinations.
+func newBranches[T any](
+	config Config[T],
+	tracer *tracing.Tracer,
+) ([]pipeline.Branch[T], []*sender.Sender[T], []string) {
+	destinations := config.Destinations
+	if config.Sink != nil {
+		destinations = append([]Destination[T]{{
+			Name:            DefaultDestinationName,
+			Sink:            config.Sink,
+			SendingStrategy: config.SendingStrategy,
+			RetryPolicy:     config.RetryPolicy,
+			DeadLetterSink:  config.DeadLetterSink,
+			PersistentQueue: config.PersistentQueue,
+		}}, destinations...)
+	}
+
+	senders := make([]*sender.Sender[T], 0, len(destinations))
+	branches := make([]pipeline.Branch[T], 0, len(destinations))
+	names := make([]string, 0, len(destinations))
+	for _, dest := range destinations {
+		sinkSender := newSender(dest, config.Result, config.Metrics, tracer)
+		senders = append(senders, sinkSender)
+		branches = append(branches, pipeline.Branch[T]{
+			Name: dest.Name,
+			StrategyOption: &pipeline.StrategyOption{
+				StrategyType:  dest.SendingStrategy.Type,
+				BufferLimit:   dest.SendingStrategy.BufferLimitBytes,
+				FlushInterval: dest.SendingStrategy.FlushInterval,
+			},
+			SinkInput:       sinkSender.In(),
+			BufferSize:      dest.BufferSize,
+			OverflowPolicy:  dest.OverflowPolicy,
+			OverflowTimeout: dest.OverflowTimeout,
+		})
+		names = append(names, dest.Name)
+	}
+
+	return branches, senders, names
+}
+
+// newPipelineOptions returns the options of the pipeline processing the messages with the configuration,
+// routed to the destinations with the names.
+// It returns an error if the routing is invalid, with the options without the router.
+func newPipelineOptions[T any](
+	config Config[T],
+	tracer *tracing.Tracer,
+	names []string,
+	onHalt func(err error),
+) ([]pipeline.PipelineOptionsFunc[T], error) {
+	var configErr error
+	pipelineOpts := []pipeline.PipelineOptionsFunc[T]{
+		pipeline.WithMetrics[T](config.Metrics),
+		pipeline.WithTracer[T](tracer),
+		pipeline.WithDropHandler(config.DropHandler),
+	}
+	if len(config.Routes) > 0 || len(config.DefaultRoute) > 0 {
+		router, err := pipeline.NewRouter[T](pipeline.Routing{
+			Routes:  config.Routes,
+			Default: config.DefaultRoute,
+		}, names)
+		if err != nil {
+			configErr = fmt.Errorf("invalid routing: %w", err)
+		} else {
+			pipelineOpts = append(pipelineOpts, pipeline.WithRouter(router))
+		}
+	}
+
+	processorOpts := []processor.ProcessorOptionsFunc[T]{
+		processor.WithFailurePolicy[T](config.RuleFailurePolicy),
+		processor.WithHaltHandler[T](onHalt),
+	}
+	if config.RuleDeadLetterSink != nil {
+		processorOpts = append(processorOpts, processor.WithDeadLetterSink(config.RuleDeadLetterSink))
 	}
+	pipelineOpts = append(pipelineOpts, pipeline.WithProcessorOptions(processorOpts...))
 
+	return pipelineOpts, configErr
+}
+
+// init sets up the input of the Conduit, receiving the messages from Write and the Sources of the configuration
+// into the pipeline provided by pp.
+func (c *Conduit[T]) init(config Config[T], pp pipeline.Provider[T], tracer *tracing.Tracer) {
 	inputChannel := make(chan *event.RawEvent[T])
 
-	sinkSender := sender.NewSender(config.Sink, config.Result)
-	pp := pipeline.NewProvider(config.ProcessingRules, strategyOpt, sinkSender.In())
+	writeSource := &source.EventSource[T]{InputChannel: inputChannel}
+	adapter := adapter.NewEventAdapter(writeSource, pp.PipelineInput())
+	adapter.SetTracer(tracer)
+
+	sources := make([]*attachedSource[T], 0, len(config.Sources))
+	for _, src := range config.Sources {
+		output := &source.EventSource[T]{InputChannel: make(chan *event.RawEvent[T])}
+		adapter.AddSource(output)
+		sources = append(sources, &attachedSource[T]{source: src, output: output})
+	}
+
+	sourceErrorHandler := config.SourceErrorHandler
+	if sourceErrorHandler == nil {
+		sourceErrorHandler = func(err error) {
+			log.Error(fmt.Sprintf("source error: %v", err))
+		}
+	}
+
+	c.inputChannel = inputChannel
+	c.sources = sources
+	c.sourceErrorHandler = sourceErrorHandler
+	c.pipelineProvider = pp
+	c.adapter = adapter
+}
 
-	source := &source.EventSource[T]{InputChannel: inputChannel}
-	adapter := adapter.NewEventAdapter(source, pp.PipelineInput())
+// haltHandler returns the function called when a rule halts the processing,
+// which makes Write fail and then calls fn, if any.
+func (c *Conduit[T]) haltHandler(fn func(err error)) func(err error) {
+	return func(err error) {
+		c.haltErr.Store(&err)
+		if fn != nil {
+			fn(err)
+		}
+	}
+}
 
-	return &Conduit[T]{
-		inputChannel:     inputChannel,
-		pipelineProvider: pp,
-		adapter:          adapter,
-		sender:           sinkSender,
-		stopped:          true,
+func newSender[T any](
+	dest Destination[T],
+	result chan *sink.Result[T],
+	m *metrics.Metrics,
+	tracer *tracing.Tracer,
+) *sender.Sender[T] {
+	senderOpts := []sender.SenderOptionsFunc[T]{
+		sender.WithRetryPolicy[T](dest.RetryPolicy),
+		sender.WithDestination[T](dest.Name),
+		sender.WithMetrics[T](m.Destination(dest.Name)),
+		sender.WithTracer[T](tracer),
 	}
+	if dest.DeadLetterSink != nil {
+		senderOpts = append(senderOpts, sender.WithDeadLetterSink(dest.DeadLetterSink))
+	}
+	if dest.PersistentQueue != nil {
+		senderOpts = append(senderOpts, sender.WithPersistentQueue(dest.PersistentQueue))
+	}
+
+	return sender.NewSender(dest.Sink, result, senderOpts...)
 }
 
-// Start is starting to receive messages.
-func (c *Conduit[T]) Start() {
+// Start is starting to receive messages from Write and the Sources.
+// It returns an error if the configuration is invalid.
+// If one of the Sources fails to start, the Conduit is shut down and the error is returned.
+// A Conduit is started at most once: Start returns an error if it is already started, stopped, or failed to start.
+func (c *Conduit[T]) Start() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.sender.Start()
+	switch c.state {
+	case stateRunning:
+		return errors.New("conduit is already started")
+	case stateStopped:
+		return errors.New("conduit is stopped and cannot be started again")
+	case stateFailed:
+		return fmt.Errorf("conduit failed to start: %w", c.startErr)
+	}
+	if c.configErr != nil {
+		return c.configErr
+	}
+
+	for _, s := range c.senders {
+		s.Start()
+	}
 	c.pipelineProvider.Start()
 	c.adapter.Start()
 
-	c.stopped = false
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancelSources = cancel
+
+	for i, src := range c.sources {
+		if err := src.source.Start(ctx, src.output.InputChannel, c.sourceErrorHandler); err != nil {
+			c.stopSources(c.sources[:i])
+
+			// the channels of the stages are closed, so the Conduit can neither be started nor stopped again
+			c.state, c.startErr = stateFailed, fmt.Errorf("failed to start source: %w", err)
+			if stopErr := c.shutdown(c.sources[i:]); stopErr != nil {
+				log.Error(fmt.Sprintf("failed to stop conduit: %v", stopErr))
+			}
+
+			return c.startErr
+		}
+	}
+
+	c.state = stateRunning
+	return nil
 }
 
 // Write sends a raw message to the Conduit for processing.
@@ -102,22 +454,113 @@ func (c *Conduit[T]) Write(rawEvt *event.RawEvent[T]) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.stopped {
+	if c.state != stateRunning {
 		return errors.New("conduit is stopped, cannot write messages")
 	}
+	if err := c.Err(); err != nil {
+		return fmt.Errorf("conduit is halted, cannot write messages: %w", err)
+	}
 
 	c.inputChannel <- rawEvt
 
 	return nil
 }
 
+// Err returns the error of the rule that halted the processing, or nil if it is not halted.
+// See rule.FailureHalt.
+func (c *Conduit[T]) Err() error {
+	if err := c.haltErr.Load(); err != nil {
+		return *err
+	}
+
+	return nil
+}
+
+// ReplaceRules atomically replaces the ProcessingRules while the Conduit is running, without losing buffered messages.
+// A message being processed is processed by the previous rules to the end, and the following messages by the new ones.
+// The new rules are validated first: if one of them is nil, the rules are not replaced and an error is returned.
+// The rules are given the RuleFailurePolicy of the configuration unless they have their own.
+// The state of the previous rules, such as the keys seen by a dedup rule, is not carried over.
+// The new rules that are rule.Starter, such as lookup rules polling their files, are started and the previous ones stopped.
+// A halted Conduit stays halted.
+// For a Conduit created by NewMapped, the ProcessingRules of input are replaced.
+func (c *Conduit[T]) ReplaceRules(rules []rule.Rule[T]) error {
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	previous := c.pipelineProvider.Rules()
+	if err := c.pipelineProvider.SetRules(rules); err != nil {
+		return fmt.Errorf("invalid processing rules: %w", err)
+	}
+	c.previousRules, c.hasPreviousRules = previous, true
+
+	log.Info(fmt.Sprintf("replaced %d processing rules with %d rules", len(previous), len(rules)))
+	return nil
+}
+
+// RollbackRules restores the ProcessingRules replaced by the last ReplaceRules.
+// It returns an error if the rules have not been replaced since the last rollback.
+func (c *Conduit[T]) RollbackRules() error {
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	if !c.hasPreviousRules {
+		return errors.New("no processing rules to roll back to")
+	}
+	if err := c.pipelineProvider.SetRules(c.previousRules); err != nil {
+		return fmt.Errorf("failed to roll back processing rules: %w", err)
+	}
+	c.previousRules, c.hasPreviousRules = nil, false
+
+	log.Info("rolled back processing rules")
+	return nil
+}
+
+// Rules returns the current ProcessingRules.
+func (c *Conduit[T]) Rules() []rule.Rule[T] {
+	return c.pipelineProvider.Rules()
+}
+
 // Stop stops the Conduit and flushes any remaining messages in the pipeline and sender.
 func (c *Conduit[T]) Stop() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.stopped {
+	switch c.state {
+	case stateCreated, stateStopped:
 		return errors.New("conduit is already stopped")
+	case stateFailed:
+		return fmt.Errorf("conduit failed to start: %w", c.startErr)
+	}
+
+	// the channels of the stages are closed even if the shutdown fails, so the Conduit is not stopped again
+	c.state = stateStopped
+	c.stopSources(c.sources)
+
+	return c.shutdown(nil)
+}
+
+// stopSources stops the sources and closes their output channels.
+func (c *Conduit[T]) stopSources(sources []*attachedSource[T]) {
+	c.cancelSources()
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultFlushTimeout)
+	defer cancel()
+
+	for _, src := range sources {
+		if err := src.source.Stop(ctx); err != nil {
+			log.Error(fmt.Sprintf("failed to stop source: %v", err))
+		}
+
+		close(src.output.InputChannel)
+	}
+}
+
+// shutdown closes the output channels of the sources that were not started,
+// then flushes and stops the pipeline and the sender.
+func (c *Conduit[T]) shutdown(notStarted []*attachedSource[T]) error {
+	for _, src := range notStarted {
+		close(src.output.InputChannel)
 	}
 
 	close(c.inputChannel)
@@ -130,17 +573,25 @@ func (c *Conduit[T]) Stop() error {
 	if err := c.pipelineProvider.Flush(ctx); err != nil {
 		return fmt.Errorf("failed to flush pipeline: %w", err)
 	}
-	if err := c.sender.Flush(ctx); err != nil {
-		return fmt.Errorf("failed to flush sender: %w", err)
+	for _, s := range c.senders {
+		if err := s.Flush(ctx); err != nil {
+			return fmt.Errorf("failed to flush sender: %w", err)
+		}
 	}
 
 	if err := c.pipelineProvider.Stop(); err != nil {
 		return fmt.Errorf("failed to stop pipeline provider: %w", err)
 	}
-	if err := c.sender.Stop(); err != nil {
-		return fmt.Errorf("failed to stop sender: %w", err)
+	for _, s := range c.senders {
+		if err := s.Stop(); err != nil {
+			return fmt.Errorf("failed to stop sender: %w", err)
+		}
+	}
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("failed to close rule dead-letter sink: %w", err)
+		}
 	}
 
-	c.stopped = true
 	return nil
 }
@@ -2,14 +2,27 @@ package conduit_test
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mrtc0/conduit"
 	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/pipeline"
+	"github.com/mrtc0/conduit/processor"
 	"github.com/mrtc0/conduit/processor/rule"
 	"github.com/mrtc0/conduit/sink"
+	"github.com/mrtc0/conduit/source"
+	"github.com/mrtc0/conduit/strategy"
 	"github.com/mrtc0/conduit/testutils"
+	"github.com/mrtc0/conduit/tracing"
 	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestConduit_Write(t *testing.T) {
@@ -24,7 +37,7 @@ func TestConduit_Write(t *testing.T) {
 		ProcessingRules: rules,
 		Sink:            bufSink,
 	})
-	c.Start()
+	assert.NoError(t, c.Start())
 
 	err := c.Write(event.NewRawEvent(testutils.DummyEvent{
 		ID:   "123",
@@ -36,3 +49,568 @@ func TestConduit_Write(t *testing.T) {
 
 	assert.Equal(t, "{\"id\":\"123\",\"name\":\"Test Event\"}\n", buf.String())
 }
+
+type mockSource struct {
+	events []*event.RawEvent[testutils.DummyEvent]
+	done   chan struct{}
+}
+
+func (s *mockSource) Start(
+	ctx context.Context,
+	out chan<- *event.RawEvent[testutils.DummyEvent],
+	errorHandler source.ErrorHandler,
+) error {
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		for _, evt := range s.events {
+			select {
+			case out <- evt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (s *mockSource) Stop(ctx context.Context) error {
+	<-s.done
+	return nil
+}
+
+func TestConduit_Sources(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+
+	sources := []*mockSource{
+		{events: []*event.RawEvent[testutils.DummyEvent]{
+			event.NewRawEvent(testutils.DummyEvent{ID: "1", Name: "From Source"}, nil),
+		}},
+		{events: []*event.RawEvent[testutils.DummyEvent]{
+			event.NewRawEvent(testutils.DummyEvent{ID: "2", Name: "From Source"}, nil),
+		}},
+	}
+
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		Sources: []source.Source[testutils.DummyEvent]{sources[0], sources[1]},
+		Sink:    sink.NewWriterSink[testutils.DummyEvent](buf),
+	})
+	assert.NoError(t, c.Start())
+
+	err := c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "3", Name: "From Write"}, nil))
+	assert.NoError(t, err)
+
+	for _, src := range sources {
+		<-src.done
+	}
+
+	assert.NoError(t, c.Stop())
+
+	assert.Contains(t, buf.String(), `{"id":"1","name":"From Source"}`)
+	assert.Contains(t, buf.String(), `{"id":"2","name":"From Source"}`)
+	assert.Contains(t, buf.String(), `{"id":"3","name":"From Write"}`)
+}
+
+type failingSource struct{}
+
+func (failingSource) Start(context.Context, chan<- *event.RawEvent[testutils.DummyEvent], source.ErrorHandler) error {
+	return errors.New("address already in use")
+}
+
+func (failingSource) Stop(context.Context) error {
+	return nil
+}
+
+func TestConduit_Lifecycle(t *testing.T) {
+	t.Parallel()
+
+	t.Run("started and stopped once", func(t *testing.T) {
+		t.Parallel()
+
+		c := conduit.New(conduit.Config[testutils.DummyEvent]{
+			Sink: sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+		})
+		assert.EqualError(t, c.Stop(), "conduit is already stopped")
+
+		assert.NoError(t, c.Start())
+		assert.EqualError(t, c.Start(), "conduit is already started")
+
+		assert.NoError(t, c.Stop())
+		assert.EqualError(t, c.Stop(), "conduit is already stopped")
+		assert.EqualError(t, c.Start(), "conduit is stopped and cannot be started again")
+	})
+
+	t.Run("failed to start a source", func(t *testing.T) {
+		t.Parallel()
+
+		src := &mockSource{}
+		c := conduit.New(conduit.Config[testutils.DummyEvent]{
+			Sources: []source.Source[testutils.DummyEvent]{src, failingSource{}},
+			Sink:    sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+		})
+
+		assert.EqualError(t, c.Start(), "failed to start source: address already in use")
+		assert.EqualError(t, c.Start(), "conduit failed to start: failed to start source: address already in use")
+		assert.EqualError(t, c.Stop(), "conduit failed to start: failed to start source: address already in use")
+		assert.EqualError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "1"}, nil)),
+			"conduit is stopped, cannot write messages")
+	})
+}
+
+func TestConduit_Destinations(t *testing.T) {
+	t.Parallel()
+
+	streamBuf := &bytes.Buffer{}
+	batchBuf := &bytes.Buffer{}
+	result := make(chan *sink.Result[testutils.DummyEvent], 10)
+
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		Sink:   sink.NewWriterSink[testutils.DummyEvent](streamBuf),
+		Result: result,
+		Destinations: []conduit.Destination[testutils.DummyEvent]{
+			{
+				Name: "archive",
+				Sink: sink.NewWriterSink[testutils.DummyEvent](batchBuf),
+				SendingStrategy: conduit.SendingStrategy{
+					Type:             strategy.Batch,
+					BufferLimitBytes: 1024,
+					FlushInterval:    time.Hour,
+				},
+			},
+		},
+	})
+	assert.NoError(t, c.Start())
+
+	for _, id := range []string{"1", "2"} {
+		assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: id, Name: "Test Event"}, nil)))
+	}
+
+	assert.NoError(t, c.Stop())
+
+	want := "{\"id\":\"1\",\"name\":\"Test Event\"}\n{\"id\":\"2\",\"name\":\"Test Event\"}\n"
+	assert.Equal(t, want, streamBuf.String())
+	assert.Equal(t, want, batchBuf.String())
+
+	close(result)
+	destinations := map[string]int{}
+	for r := range result {
+		assert.NoError(t, r.Err)
+		destinations[r.Destination]++
+	}
+	// Stream payloads are reported one by one, while the archive batches them.
+	assert.Equal(t, 2, destinations[conduit.DefaultDestinationName])
+	assert.Positive(t, destinations["archive"])
+}
+
+func TestConduit_Routes(t *testing.T) {
+	t.Parallel()
+
+	alerts := &bytes.Buffer{}
+	archive := &bytes.Buffer{}
+
+	// Rules can choose the destinations of an event by setting the route tag.
+	routeRule := rule.NewRule(
+		"route-by-id",
+		"routes events with ID 3 to the alerts",
+		rule.TypeTransform,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			if evt.Content().ID == "3" {
+				evt.Tags[pipeline.TagRoute] = "alerts"
+			}
+			return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+		},
+	)
+
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		ProcessingRules: []rule.Rule[testutils.DummyEvent]{routeRule},
+		Destinations: []conduit.Destination[testutils.DummyEvent]{
+			{Name: "alerts", Sink: sink.NewWriterSink[testutils.DummyEvent](alerts)},
+			{Name: "archive", Sink: sink.NewWriterSink[testutils.DummyEvent](archive)},
+		},
+		Routes: []pipeline.Route{
+			{
+				Fields:       map[string]string{"name": "Alert"},
+				Destinations: []string{"alerts"},
+				Continue:     true,
+			},
+		},
+		DefaultRoute: []string{"archive"},
+	})
+	assert.NoError(t, c.Start())
+
+	assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "1", Name: "Alert"}, nil)))
+	assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "2", Name: "Info"}, nil)))
+	assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "3", Name: "Info"}, nil)))
+
+	assert.NoError(t, c.Stop())
+
+	assert.Equal(t, "{\"id\":\"1\",\"name\":\"Alert\"}\n{\"id\":\"3\",\"name\":\"Info\"}\n", alerts.String())
+	assert.Equal(t, "{\"id\":\"2\",\"name\":\"Info\"}\n", archive.String())
+}
+
+func TestConduit_InvalidRoutes(t *testing.T) {
+	t.Parallel()
+
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		Sink:         sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+		DefaultRoute: []string{"missing"},
+	})
+
+	assert.ErrorContains(t, c.Start(), `unknown destination "missing"`)
+}
+
+func TestConduit_Metrics(t *testing.T) {
+	t.Parallel()
+
+	m := metrics.New()
+
+	dropPing := rule.NewRule(
+		"drop-ping",
+		"drops ping events",
+		rule.TypeFilter,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			return rule.FilterResult[testutils.DummyEvent]{Drop: evt.Content().Name == "ping", Reason: "ping"}
+		},
+	)
+
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		ProcessingRules: []rule.Rule[testutils.DummyEvent]{dropPing},
+		Sink:            sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+		Metrics:         m,
+	})
+	assert.NoError(t, c.Start())
+
+	for _, name := range []string{"ping", "pong", "ping"} {
+		assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "1", Name: name}, nil)))
+	}
+
+	assert.NoError(t, c.Stop())
+
+	buf := &bytes.Buffer{}
+	_, err := m.Registry().WriteTo(buf)
+	assert.NoError(t, err)
+
+	exposition := buf.String()
+	assert.Contains(t, exposition, "conduit_events_received_total 3\n")
+	assert.Contains(t, exposition, `conduit_events_filtered_total{rule="drop-ping",reason="ping"} 2`+"\n")
+	assert.Contains(t, exposition, "conduit_events_processed_total 1\n")
+	assert.Contains(t, exposition, `conduit_events_encoded_total{destination="default"} 1`+"\n")
+	assert.Contains(t, exposition, `conduit_sink_writes_total{destination="default",result="success"} 1`+"\n")
+	assert.Contains(t, exposition, `conduit_sink_write_duration_seconds_count{destination="default"} 1`+"\n")
+	assert.Contains(t, exposition, `conduit_sender_queue_length{destination="default"} 0`+"\n")
+}
+
+func TestConduit_Tracing(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	noop := rule.NewRule(
+		"noop",
+		"passes all events",
+		rule.TypeFilter,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			return rule.FilterResult[testutils.DummyEvent]{}
+		},
+	)
+
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		ProcessingRules: []rule.Rule[testutils.DummyEvent]{noop},
+		Sink:            sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+		Destinations: []conduit.Destination[testutils.DummyEvent]{
+			{
+				Name: "archive",
+				Sink: sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+				SendingStrategy: conduit.SendingStrategy{
+					Type:             strategy.Batch,
+					BufferLimitBytes: 1024,
+					FlushInterval:    time.Hour,
+				},
+			},
+		},
+		TracerProvider: tp,
+	})
+	assert.NoError(t, c.Start())
+
+	assert.NoError(t, c.Write(event.NewRawEvent(
+		testutils.DummyEvent{ID: "1", Name: "Test Event"},
+		&event.Metadata{TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	)))
+
+	assert.NoError(t, c.Stop())
+
+	spans := map[string][]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+
+	// The spans of the event belong to the trace it was written with.
+	for _, name := range []string{"conduit.ingest", "conduit.rule noop", "conduit.encode", "conduit.batch.add"} {
+		if assert.Len(t, spans[name], 1, name) {
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[name][0].SpanContext.TraceID().String(), name)
+		}
+	}
+
+	// The batch has its own trace, linked to the traces of its events.
+	if assert.Len(t, spans["conduit.batch.flush"], 1) {
+		flush := spans["conduit.batch.flush"][0]
+		if assert.Len(t, flush.Links, 1) {
+			assert.Equal(t, spans["conduit.ingest"][0].SpanContext.SpanID(), flush.Links[0].SpanContext.SpanID())
+		}
+	}
+
+	if assert.Len(t, spans["conduit.sink.write"], 2) {
+		parents := map[string]string{}
+		for _, span := range spans["conduit.sink.write"] {
+			for _, attr := range span.Attributes {
+				if attr.Key == tracing.AttributeDestination {
+					parents[attr.Value.AsString()] = span.Parent.SpanID().String()
+				}
+			}
+		}
+		assert.Equal(t, spans["conduit.ingest"][0].SpanContext.SpanID().String(), parents[conduit.DefaultDestinationName])
+		assert.Equal(t, spans["conduit.batch.flush"][0].SpanContext.SpanID().String(), parents["archive"])
+	}
+}
+
+func TestConduit_DropHandler(t *testing.T) {
+	t.Parallel()
+
+	dropPing := rule.NewRule(
+		"drop-ping",
+		"drops ping events",
+		rule.TypeFilter,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			return rule.FilterResult[testutils.DummyEvent]{Drop: evt.Content().Name == "ping", Reason: "ping"}
+		},
+	)
+
+	drops := &bytes.Buffer{}
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		ProcessingRules: []rule.Rule[testutils.DummyEvent]{dropPing},
+		Sink:            sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+		Routes: []pipeline.Route{
+			{Name: "pong", Fields: map[string]string{"name": "pong"}, Destinations: []string{conduit.DefaultDestinationName}},
+		},
+		DropHandler: sink.NewDropHandler(sink.NewWriterSink[testutils.DummyEvent](drops)),
+	})
+	assert.NoError(t, c.Start())
+
+	for _, name := range []string{"ping", "pong", "other"} {
+		assert.NoError(t, c.Write(event.NewRawEvent(
+			testutils.DummyEvent{ID: "1", Name: name},
+			&event.Metadata{Tags: event.Tags{"source": "test"}},
+		)))
+	}
+
+	assert.NoError(t, c.Stop())
+
+	records := []sink.DropRecord{}
+	decoder := json.NewDecoder(drops)
+	for decoder.More() {
+		var record sink.DropRecord
+		assert.NoError(t, decoder.Decode(&record))
+		records = append(records, record)
+	}
+
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, event.DropStageProcess, records[0].Stage)
+		assert.Equal(t, "drop-ping", records[0].Rule)
+		assert.Equal(t, "ping", records[0].Reason)
+		assert.JSONEq(t, `{"id":"1","name":"ping"}`, string(records[0].Content))
+		assert.Equal(t, "test", records[0].Metadata.Tags["source"])
+
+		assert.Equal(t, event.DropStageRoute, records[1].Stage)
+		assert.Equal(t, metrics.DropReasonUnrouted, records[1].Reason)
+		assert.JSONEq(t, `{"id":"1","name":"other"}`, string(records[1].Content))
+	}
+}
+
+func TestConduit_HaltOnRuleFailure(t *testing.T) {
+	t.Parallel()
+
+	failing := rule.WithFailurePolicy(rule.NewRule(
+		"failing",
+		"fails on invalid events",
+		rule.TypeTransform,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			if evt.Content().ID == "" {
+				return rule.ErrorResult[testutils.DummyEvent]{Err: errors.New("missing id")}
+			}
+			return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+		},
+	), rule.FailureHalt)
+
+	buf := &bytes.Buffer{}
+	halted := make(chan error, 1)
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		ProcessingRules: []rule.Rule[testutils.DummyEvent]{failing},
+		Sink:            sink.NewWriterSink[testutils.DummyEvent](buf),
+		HaltHandler: func(err error) {
+			halted <- err
+		},
+	})
+	assert.NoError(t, c.Start())
+
+	assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "1", Name: "valid"}, nil)))
+	assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{Name: "invalid"}, nil)))
+
+	err := <-halted
+	assert.ErrorContains(t, err, `rule "failing" failed: missing id`)
+	assert.Equal(t, err, c.Err())
+	assert.ErrorIs(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: "2", Name: "valid"}, nil)), err)
+
+	assert.NoError(t, c.Stop())
+	assert.Equal(t, "{\"id\":\"1\",\"name\":\"valid\"}\n", buf.String())
+}
+
+func TestConduit_NewMapped(t *testing.T) {
+	t.Parallel()
+
+	dropEmpty := rule.NewRule(
+		"drop-empty",
+		"drops empty messages",
+		rule.TypeFilter,
+		func(evt *event.Event[json.RawMessage]) rule.Result[json.RawMessage] {
+			return rule.FilterResult[json.RawMessage]{Drop: string(evt.Content()) == "{}", Reason: "empty"}
+		},
+	)
+	upperName := rule.NewRule(
+		"upper-name",
+		"uppercases the name",
+		rule.TypeTransform,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			content := evt.Content()
+			content.Name = strings.ToUpper(content.Name)
+			evt.SetContent(content)
+			return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+		},
+	)
+
+	parse := func(evt *event.Event[json.RawMessage]) (*event.Event[testutils.DummyEvent], error) {
+		var content testutils.DummyEvent
+		if err := json.Unmarshal(evt.Content(), &content); err != nil {
+			return nil, err
+		}
+		return event.Map(evt, content), nil
+	}
+
+	buf := &bytes.Buffer{}
+	var dropped []*event.DroppedEvent[json.RawMessage]
+	c := conduit.NewMapped(
+		conduit.Config[json.RawMessage]{
+			ProcessingRules: []rule.Rule[json.RawMessage]{dropEmpty},
+			DropHandler: func(d *event.DroppedEvent[json.RawMessage]) {
+				dropped = append(dropped, d)
+			},
+		},
+		parse,
+		conduit.Config[testutils.DummyEvent]{
+			ProcessingRules: []rule.Rule[testutils.DummyEvent]{upperName},
+			Sink:            sink.NewWriterSink[testutils.DummyEvent](buf),
+		},
+	)
+	assert.NoError(t, c.Start())
+
+	for _, msg := range []string{`{"id":"1","name":"first"}`, `{}`, `not json`, `{"id":"2","name":"second"}`} {
+		assert.NoError(t, c.Write(event.NewRawEvent(
+			json.RawMessage(msg),
+			&event.Metadata{Tags: event.Tags{"source": "test"}},
+		)))
+	}
+
+	assert.NoError(t, c.Stop())
+
+	assert.Equal(t, "{\"id\":\"1\",\"name\":\"FIRST\"}\n{\"id\":\"2\",\"name\":\"SECOND\"}\n", buf.String())
+	if assert.Len(t, dropped, 2) {
+		assert.Equal(t, event.DropStageProcess, dropped[0].Stage)
+		assert.Equal(t, event.DropStageMap, dropped[1].Stage)
+		assert.Equal(t, processor.ReasonMapFailed, dropped[1].Reason)
+		assert.Equal(t, "test", dropped[1].Event.Tags["source"])
+		assert.Error(t, dropped[1].Err)
+	}
+}
+
+func TestConduit_NewMapped_InvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	mapFn := func(evt *event.Event[json.RawMessage]) (*event.Event[testutils.DummyEvent], error) {
+		return nil, nil
+	}
+
+	c := conduit.NewMapped(
+		conduit.Config[json.RawMessage]{Sink: sink.NewWriterSink[json.RawMessage](&bytes.Buffer{})},
+		mapFn,
+		conduit.Config[testutils.DummyEvent]{Sink: sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{})},
+	)
+	assert.EqualError(t, c.Start(), "input of a mapped conduit must not have sinks or routes")
+
+	c = conduit.NewMapped(
+		conduit.Config[json.RawMessage]{},
+		mapFn,
+		conduit.Config[testutils.DummyEvent]{
+			Sink:         sink.NewWriterSink[testutils.DummyEvent](&bytes.Buffer{}),
+			DefaultRoute: []string{"missing"},
+		},
+	)
+	assert.ErrorContains(t, c.Start(), `unknown destination "missing"`)
+}
+
+func TestConduit_ReplaceRules(t *testing.T) {
+	t.Parallel()
+
+	rename := func(name string) rule.Rule[testutils.DummyEvent] {
+		return rule.NewRule("rename", "", rule.TypeTransform,
+			func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+				content := evt.Content()
+				content.Name = name
+				evt.SetContent(content)
+				return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+			},
+		)
+	}
+
+	buf := &bytes.Buffer{}
+	result := make(chan *sink.Result[testutils.DummyEvent], 10)
+	c := conduit.New(conduit.Config[testutils.DummyEvent]{
+		ProcessingRules: []rule.Rule[testutils.DummyEvent]{rename("v1")},
+		Sink:            sink.NewWriterSink[testutils.DummyEvent](buf),
+		Result:          result,
+	})
+	assert.NoError(t, c.Start())
+
+	// write waits for the event to reach the sink, so that it is processed before the rules are replaced
+	write := func(id string) {
+		assert.NoError(t, c.Write(event.NewRawEvent(testutils.DummyEvent{ID: id}, nil)))
+		<-result
+	}
+
+	assert.EqualError(t, c.RollbackRules(), "no processing rules to roll back to")
+
+	write("1")
+	assert.NoError(t, c.ReplaceRules([]rule.Rule[testutils.DummyEvent]{rename("v2")}))
+	write("2")
+
+	err := c.ReplaceRules([]rule.Rule[testutils.DummyEvent]{rename("v3"), nil})
+	assert.EqualError(t, err, "invalid processing rules: rule #1 is nil")
+	assert.Len(t, c.Rules(), 1)
+	write("3")
+
+	assert.NoError(t, c.RollbackRules())
+	write("4")
+	assert.Error(t, c.RollbackRules())
+
+	assert.NoError(t, c.Stop())
+
+	assert.Equal(t, `{"id":"1","name":"v1"}
+{"id":"2","name":"v2"}
+{"id":"3","name":"v2"}
+{"id":"4","name":"v1"}
+`, buf.String())
+}
@@ -0,0 +1,395 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mrtc0/conduit"
+	"github.com/mrtc0/conduit/pipeline"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/sender"
+	"github.com/mrtc0/conduit/sink"
+	"github.com/mrtc0/conduit/source"
+	"github.com/mrtc0/conduit/strategy"
+)
+
+// New creates a Conduit from the document with the factories of the registry.
+// If registry is nil, NewRegistry is used.
+// The fields of conduit.Config that cannot be written in a document, such as Metrics, are set by modify, if any.
+func New[T any](doc *Document, registry *Registry[T], modify ...func(*conduit.Config[T])) (*conduit.Conduit[T], error) {
+	config, err := NewConfig(doc, registry)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fn := range modify {
+		fn(&config)
+	}
+
+	return conduit.New(config), nil
+}
+
+// NewConfig creates the conduit.Config described by the document with the factories of the registry.
+// If registry is nil, NewRegistry is used.
+// The errors in the document are reported as a *PathError. If an error occurs, the sinks created so far are closed.
+func NewConfig[T any](doc *Document, registry *Registry[T]) (conduit.Config[T], error) {
+	if registry == nil {
+		registry = NewRegistry[T]()
+	}
+
+	b := &builder[T]{registry: registry}
+	config, err := b.build(doc)
+	if err != nil {
+		for _, s := range b.sinks {
+			_ = s.Close()
+		}
+		return conduit.Config[T]{}, err
+	}
+
+	return config, nil
+}
+
+// NewRules creates the processing rules of the document with the factories of the registry,
+// without creating its sources and sinks.
+// The rules without their own failure policy are given the rule_failure_policy of the document, or skip,
+// so that they keep the policy of the document when they replace the rules of a running Conduit.
+// If registry is nil, NewRegistry is used.
+func NewRules[T any](doc *Document, registry *Registry[T]) ([]rule.Rule[T], error) {
+	if registry == nil {
+		registry = NewRegistry[T]()
+	}
+
+	b := &builder[T]{registry: registry}
+	policy, rules, err := b.rules(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, r := range rules {
+		if _, ok := r.(rule.FailurePolicyProvider); !ok {
+			rules[i] = rule.WithFailurePolicy(r, policy)
+		}
+	}
+
+	return rules, nil
+}
+
+// Sinks returns the sinks of the configuration, such as to close them when the Conduit is not started.
+func Sinks[T any](config conduit.Config[T]) []sink.Sink[T] {
+	var sinks []sink.Sink[T]
+	for _, s := range []sink.Sink[T]{config.Sink, config.DeadLetterSink, config.RuleDeadLetterSink} {
+		if s != nil {
+			sinks = append(sinks, s)
+		}
+	}
+	for _, dest := range config.Destinations {
+		sinks = append(sinks, dest.Sink)
+		if dest.DeadLetterSink != nil {
+			sinks = append(sinks, dest.DeadLetterSink)
+		}
+	}
+
+	return sinks
+}
+
+type builder[T any] struct {
+	registry *Registry[T]
+	// sinks are the sinks created so far.
+	sinks []sink.Sink[T]
+}
+
+func (b *builder[T]) build(doc *Document) (conduit.Config[T], error) {
+	config := conduit.Config[T]{}
+
+	for i, c := range doc.Sources {
+		src, err := b.source(fmt.Sprintf("sources[%d]", i), c)
+		if err != nil {
+			return config, err
+		}
+		config.Sources = append(config.Sources, src)
+	}
+
+	var err error
+	if config.RuleFailurePolicy, config.ProcessingRules, err = b.rules(doc); err != nil {
+		return config, err
+	}
+	if config.RuleDeadLetterSink, err = b.optionalSink("rule_dead_letter_sink", doc.RuleDeadLetterSink); err != nil {
+		return config, err
+	}
+
+	if len(doc.Sink) == 0 && len(doc.Destinations) == 0 {
+		return config, &PathError{Path: "sink", Err: errors.New("sink or destinations are required")}
+	}
+	names := []string{}
+	if len(doc.Sink) > 0 {
+		if config.Sink, err = b.sink("sink", doc.Sink); err != nil {
+			return config, err
+		}
+		if config.SendingStrategy, err = sendingStrategy("sending_strategy", doc.SendingStrategy); err != nil {
+			return config, err
+		}
+		config.RetryPolicy = retryPolicy(doc.RetryPolicy)
+		if config.DeadLetterSink, err = b.optionalSink("dead_letter_sink", doc.DeadLetterSink); err != nil {
+			return config, err
+		}
+		names = append(names, conduit.DefaultDestinationName)
+	}
+
+	for i, d := range doc.Destinations {
+		path := fmt.Sprintf("destinations[%d]", i)
+		dest, err := b.destination(path, d)
+		if err != nil {
+			return config, err
+		}
+		if slices.Contains(names, dest.Name) {
+			return config, &PathError{Path: path + ".name", Err: fmt.Errorf("duplicate destination %q", dest.Name)}
+		}
+		names = append(names, dest.Name)
+		config.Destinations = append(config.Destinations, dest)
+	}
+
+	for i, r := range doc.Routes {
+		path := fmt.Sprintf("routes[%d]", i)
+		if len(r.Destinations) == 0 {
+			return config, &PathError{Path: path + ".destinations", Err: errors.New("destinations are required")}
+		}
+		if err := checkDestinations(path+".destinations", r.Destinations, names); err != nil {
+			return config, err
+		}
+		config.Routes = append(config.Routes, pipeline.Route{
+			Name:         r.Name,
+			Tags:         r.Tags,
+			Fields:       r.Fields,
+			Destinations: r.Destinations,
+			Continue:     r.Continue,
+		})
+	}
+	if err := checkDestinations("default_route", doc.DefaultRoute, names); err != nil {
+		return config, err
+	}
+	config.DefaultRoute = doc.DefaultRoute
+
+	return config, nil
+}
+
+// rules creates the processing rules of the document and parses its rule_failure_policy.
+func (b *builder[T]) rules(doc *Document) (rule.FailurePolicy, []rule.Rule[T], error) {
+	policy := rule.FailureSkip
+	if doc.RuleFailurePolicy != "" {
+		var err error
+		if policy, err = rule.ParseFailurePolicy(doc.RuleFailurePolicy); err != nil {
+			return policy, nil, &PathError{Path: "rule_failure_policy", Err: err}
+		}
+	}
+
+	var rules []rule.Rule[T]
+	for i, c := range doc.Rules {
+		r, err := b.rule(fmt.Sprintf("rules[%d]", i), c)
+		if err != nil {
+			return policy, nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	return policy, rules, nil
+}
+
+func (b *builder[T]) source(path string, c Component) (source.Source[T], error) {
+	spec, err := b.spec(path, c)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, ok := b.registry.sources[spec.Type]
+	if !ok {
+		return nil, &PathError{Path: path + ".type", Err: fmt.Errorf("unknown source type %q", spec.Type)}
+	}
+
+	src, err := factory(spec)
+	if err != nil {
+		return nil, withPath(path, err)
+	}
+
+	return src, nil
+}
+
+func (b *builder[T]) rule(path string, c Component) (rule.Rule[T], error) {
+	spec, err := b.spec(path, c)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy *rule.FailurePolicy
+	if value, ok := spec.fields["failure_policy"]; ok {
+		s, ok := value.(string)
+		if !ok {
+			return nil, typeError(path+".failure_policy", "a string", value)
+		}
+		p, err := rule.ParseFailurePolicy(s)
+		if err != nil {
+			return nil, &PathError{Path: path + ".failure_policy", Err: err}
+		}
+		policy = &p
+		delete(spec.fields, "failure_policy")
+	}
+
+	factory, ok := b.registry.rules[spec.Type]
+	if !ok {
+		return nil, &PathError{Path: path + ".type", Err: fmt.Errorf("unknown rule type %q", spec.Type)}
+	}
+
+	r, err := factory(spec)
+	if err != nil {
+		return nil, withPath(path, err)
+	}
+	if policy != nil {
+		// a rule with its own policy other than skip, such as redact, must not pass on the events it failed
+		if *policy == rule.FailureSkip && rule.PolicyOf(r, rule.FailureSkip) != rule.FailureSkip {
+			return nil, &PathError{Path: path + ".failure_policy", Err: fmt.Errorf("rule type %q does not allow failure policy %q", spec.Type, *policy)}
+		}
+		r = rule.WithFailurePolicy(r, *policy)
+	}
+
+	return r, nil
+}
+
+func (b *builder[T]) sink(path string, c Component) (sink.Sink[T], error) {
+	spec, err := b.spec(path, c)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, ok := b.registry.sinks[spec.Type]
+	if !ok {
+		return nil, &PathError{Path: path + ".type", Err: fmt.Errorf("unknown sink type %q", spec.Type)}
+	}
+
+	s, err := factory(spec)
+	if err != nil {
+		return nil, withPath(path, err)
+	}
+	b.sinks = append(b.sinks, s)
+
+	return s, nil
+}
+
+// optionalSink creates the sink if it is configured.
+func (b *builder[T]) optionalSink(path string, c Component) (sink.Sink[T], error) {
+	if len(c) == 0 {
+		return nil, nil
+	}
+
+	return b.sink(path, c)
+}
+
+func (b *builder[T]) destination(path string, d Destination) (conduit.Destination[T], error) {
+	dest := conduit.Destination[T]{
+		Name:        d.Name,
+		RetryPolicy: retryPolicy(d.RetryPolicy),
+		BufferSize:  d.BufferSize,
+
+		OverflowPolicy:  d.OverflowPolicy,
+		OverflowTimeout: d.OverflowTimeout,
+	}
+	if d.Name == "" {
+		return dest, &PathError{Path: path + ".name", Err: errors.New("name is required")}
+	}
+	switch d.OverflowPolicy {
+	case "", pipeline.OverflowBlock, pipeline.OverflowDrop:
+	default:
+		return dest, &PathError{Path: path + ".overflow_policy", Err: fmt.Errorf("unknown overflow policy %q", d.OverflowPolicy)}
+	}
+	if len(d.Sink) == 0 {
+		return dest, &PathError{Path: path + ".sink", Err: errors.New("sink is required")}
+	}
+
+	var err error
+	if dest.Sink, err = b.sink(path+".sink", d.Sink); err != nil {
+		return dest, err
+	}
+	if dest.SendingStrategy, err = sendingStrategy(path+".sending_strategy", d.SendingStrategy); err != nil {
+		return dest, err
+	}
+	if dest.DeadLetterSink, err = b.optionalSink(path+".dead_letter_sink", d.DeadLetterSink); err != nil {
+		return dest, err
+	}
+
+	return dest, nil
+}
+
+func (b *builder[T]) spec(path string, c Component) (Spec, error) {
+	value, ok := c["type"]
+	if !ok {
+		return Spec{}, &PathError{Path: path + ".type", Err: errors.New("type is required")}
+	}
+	typ, ok := value.(string)
+	if !ok {
+		return Spec{}, typeError(path+".type", "a string", value)
+	}
+
+	fields := make(map[string]any, len(c))
+	for key, value := range c {
+		if key != "type" {
+			fields[key] = value
+		}
+	}
+
+	return Spec{Path: path, Type: typ, Metrics: b.registry.metrics, fields: fields}, nil
+}
+
+// withPath returns err as a *PathError at the path, unless it already is one.
+func withPath(path string, err error) error {
+	var pathErr *PathError
+	if errors.As(err, &pathErr) {
+		return err
+	}
+
+	return &PathError{Path: path, Err: err}
+}
+
+func sendingStrategy(path string, s SendingStrategy) (conduit.SendingStrategy, error) {
+	switch s.Type {
+	case "", strategy.Stream:
+	case strategy.Batch:
+		if s.BufferLimitBytes <= 0 {
+			return conduit.SendingStrategy{}, &PathError{
+				Path: path + ".buffer_limit_bytes",
+				Err:  errors.New("must be positive for the batch strategy"),
+			}
+		}
+		if s.FlushInterval <= 0 {
+			return conduit.SendingStrategy{}, &PathError{
+				Path: path + ".flush_interval",
+				Err:  errors.New("must be positive for the batch strategy"),
+			}
+		}
+	default:
+		return conduit.SendingStrategy{}, &PathError{Path: path + ".type", Err: fmt.Errorf("unknown strategy %q", s.Type)}
+	}
+
+	return conduit.SendingStrategy{
+		Type:             s.Type,
+		BufferLimitBytes: s.BufferLimitBytes,
+		FlushInterval:    s.FlushInterval,
+	}, nil
+}
+
+func retryPolicy(p RetryPolicy) sender.RetryPolicy {
+	return sender.RetryPolicy{
+		MaxAttempts: p.MaxAttempts,
+		BaseBackoff: p.BaseBackoff,
+		MaxBackoff:  p.MaxBackoff,
+		Jitter:      p.Jitter,
+	}
+}
+
+func checkDestinations(path string, destinations, names []string) error {
+	for i, name := range destinations {
+		if !slices.Contains(names, name) {
+			return &PathError{Path: fmt.Sprintf("%s[%d]", path, i), Err: fmt.Errorf("unknown destination %q", name)}
+		}
+	}
+
+	return nil
+}
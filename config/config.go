@@ -0,0 +1,182 @@
+// Package config builds a conduit.Conduit from a YAML or JSON document describing
+// its sources, processing rules, sending strategy and sinks.
+//
+// Sources, rules and sinks are written as mappings with a type, which selects the factory
+// in a Registry that creates them from the other fields:
+//
+//	sources:
+//	  - type: http
+//	    addr: ":8080"
+//	rules:
+//	  - type: filter
+//	    name: drop-debug
+//	    condition: {field: level, op: equals, value: debug}
+//	    failure_policy: drop
+//	sink:
+//	  type: stdout
+//	sending_strategy:
+//	  type: batch
+//	  buffer_limit_bytes: 1048576
+//	  flush_interval: 5s
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mrtc0/conduit/pipeline"
+	"github.com/mrtc0/conduit/strategy"
+)
+
+// Document is the configuration of a Conduit.
+type Document struct {
+	// Sources are the sources of the events, in addition to Conduit.Write.
+	Sources []Component `json:"sources,omitempty"`
+	// Rules are the processing rules, applied in order.
+	// Each rule may have a failure_policy field, which is one of skip, drop, dead_letter and halt.
+	Rules []Component `json:"rules,omitempty"`
+	// RuleFailurePolicy is the failure policy of the rules without their own.
+	RuleFailurePolicy string `json:"rule_failure_policy,omitempty"`
+	// RuleDeadLetterSink is the sink of the events that a rule with the dead_letter failure policy failed to process.
+	RuleDeadLetterSink Component `json:"rule_dead_letter_sink,omitempty"`
+
+	// Sink is the default destination, named conduit.DefaultDestinationName.
+	Sink            Component       `json:"sink,omitempty"`
+	SendingStrategy SendingStrategy `json:"sending_strategy,omitempty"`
+	RetryPolicy     RetryPolicy     `json:"retry_policy,omitempty"`
+	DeadLetterSink  Component       `json:"dead_letter_sink,omitempty"`
+
+	// Destinations are additional destinations with their own sink and sending strategy.
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Routes select the destinations of the events. See conduit.Config.Routes.
+	Routes []Route `json:"routes,omitempty"`
+	// DefaultRoute are the destinations of the events matching no route.
+	DefaultRoute []string `json:"default_route,omitempty"`
+}
+
+// Component is a source, rule or sink, with its type in the type field.
+// An empty Component is not configured.
+type Component map[string]any
+
+// Type returns the type of the component.
+func (c Component) Type() string {
+	typ, _ := c["type"].(string)
+	return typ
+}
+
+// SendingStrategy is the configuration of conduit.SendingStrategy.
+type SendingStrategy struct {
+	// Type is either stream or batch. If empty, stream is used.
+	Type             strategy.StrategyType `json:"type,omitempty"`
+	BufferLimitBytes int                   `json:"buffer_limit_bytes,omitempty"`
+	FlushInterval    time.Duration         `json:"flush_interval,omitempty"`
+}
+
+// RetryPolicy is the configuration of sender.RetryPolicy.
+type RetryPolicy struct {
+	MaxAttempts int           `json:"max_attempts,omitempty"`
+	BaseBackoff time.Duration `json:"base_backoff,omitempty"`
+	MaxBackoff  time.Duration `json:"max_backoff,omitempty"`
+	Jitter      float64       `json:"jitter,omitempty"`
+}
+
+// Destination is the configuration of conduit.Destination.
+type Destination struct {
+	Name            string          `json:"name"`
+	Sink            Component       `json:"sink"`
+	SendingStrategy SendingStrategy `json:"sending_strategy,omitempty"`
+	RetryPolicy     RetryPolicy     `json:"retry_policy,omitempty"`
+	DeadLetterSink  Component       `json:"dead_letter_sink,omitempty"`
+	BufferSize      int             `json:"buffer_size,omitempty"`
+	// OverflowPolicy is either block or drop. If empty, block is used.
+	OverflowPolicy  pipeline.OverflowPolicy `json:"overflow_policy,omitempty"`
+	OverflowTimeout time.Duration           `json:"overflow_timeout,omitempty"`
+}
+
+// Route is the configuration of pipeline.Route.
+type Route struct {
+	Name         string            `json:"name,omitempty"`
+	Tags         map[string]string `json:"tags,omitempty"`
+	Fields       map[string]string `json:"fields,omitempty"`
+	Destinations []string          `json:"destinations"`
+	Continue     bool              `json:"continue,omitempty"`
+}
+
+// Parse parses a YAML or JSON document.
+func Parse(data []byte) (*Document, error) {
+	var tree any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	tree, err := fromYAML("", tree)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{}
+	if err := decode("", tree, doc); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// ParseFile parses a YAML or JSON document in the file.
+func ParseFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path) //#nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	return Parse(data)
+}
+
+// fromYAML converts the mappings decoded by yaml into map[string]any, like the ones decoded from JSON.
+func fromYAML(path string, value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			converted, err := fromYAML(join(path, key), item)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for key, item := range v {
+			s, ok := key.(string)
+			if !ok {
+				return nil, &PathError{Path: path, Err: fmt.Errorf("key %v must be a string", key)}
+			}
+			converted, err := fromYAML(join(path, s), item)
+			if err != nil {
+				return nil, err
+			}
+			m[s] = converted
+		}
+		return m, nil
+	case []any:
+		for i, item := range v {
+			converted, err := fromYAML(fmt.Sprintf("%s[%d]", path, i), item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case time.Time:
+		// an unquoted timestamp is kept as written
+		return v.Format(time.RFC3339Nano), nil
+	case int, int64, uint64, float64, string, bool, nil:
+		return v, nil
+	}
+
+	return nil, &PathError{Path: path, Err: errors.New("unsupported value")}
+}
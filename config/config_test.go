@@ -0,0 +1,339 @@
+package config_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit"
+	"github.com/mrtc0/conduit/config"
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/sink"
+	"github.com/mrtc0/conduit/strategy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output.json")
+	debug := filepath.Join(dir, "debug.json")
+
+	doc, err := config.Parse([]byte(`
+rules:
+  - type: filter
+    name: drop-health
+    condition:
+      field: path
+      op: prefix
+      value: /health
+  - type: transform
+    name: normalize
+    operations:
+      - {op: rename, from: msg, to: message}
+      - {op: set, to: env, value: prod}
+  - type: redact
+    paths: [user.email]
+    failure_policy: drop
+sink:
+  type: file
+  path: ` + output + `
+destinations:
+  - name: debug
+    sink: {type: file, path: ` + debug + `}
+    sending_strategy:
+      type: batch
+      buffer_limit_bytes: 1024
+      flush_interval: 1m
+routes:
+  - fields: {level: debug}
+    destinations: [debug]
+default_route: [default]
+`))
+	require.NoError(t, err)
+
+	c, err := config.New[map[string]any](doc, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+
+	for _, content := range []map[string]any{
+		{"path": "/health", "msg": "ok"},
+		{"path": "/login", "msg": "login", "user": map[string]any{"email": "alice@example.com"}},
+		{"path": "/login", "msg": "trace", "level": "debug"},
+	} {
+		require.NoError(t, c.Write(event.NewRawEvent(content, nil)))
+	}
+	require.NoError(t, c.Stop())
+
+	got, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"path":"/login","message":"login","env":"prod","user":{"email":"[REDACTED]"}}`, string(got))
+
+	got, err = os.ReadFile(debug)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"path":"/login","message":"trace","env":"prod","level":"debug"}`, string(got))
+}
+
+func TestNewConfig(t *testing.T) {
+	t.Parallel()
+
+	doc, err := config.Parse([]byte(`{
+		"rules": [
+			{"type": "dedup", "keys": ["id"], "window": "5m", "failure_policy": "halt"},
+			{"type": "sample", "rate": 0.5, "keys": ["id"]}
+		],
+		"rule_failure_policy": "dead_letter",
+		"sink": {"type": "stdout"},
+		"sending_strategy": {"type": "batch", "buffer_limit_bytes": 2048, "flush_interval": "10s"},
+		"retry_policy": {"max_attempts": 3, "base_backoff": "100ms", "max_backoff": "5s", "jitter": 0.2}
+	}`))
+	require.NoError(t, err)
+
+	c, err := config.NewConfig[map[string]any](doc, nil)
+	require.NoError(t, err)
+
+	require.Len(t, c.ProcessingRules, 2)
+	assert.Equal(t, rule.FailureHalt, rule.PolicyOf(c.ProcessingRules[0], rule.FailureSkip))
+	assert.Equal(t, rule.FailureDeadLetter, c.RuleFailurePolicy)
+	assert.Equal(t, conduit.SendingStrategy{
+		Type:             strategy.Batch,
+		BufferLimitBytes: 2048,
+		FlushInterval:    10 * time.Second,
+	}, c.SendingStrategy)
+	assert.Equal(t, 3, c.RetryPolicy.MaxAttempts)
+	assert.Equal(t, 100*time.Millisecond, c.RetryPolicy.BaseBackoff)
+	assert.Equal(t, 5*time.Second, c.RetryPolicy.MaxBackoff)
+	assert.NotNil(t, c.Sink)
+}
+
+func TestNewRules(t *testing.T) {
+	t.Parallel()
+
+	doc, err := config.Parse([]byte(`
+rules:
+  - {type: sample, rate: 0.5, failure_policy: halt}
+  - {type: split, path: items}
+  - {type: redact, paths: [card]}
+  - {type: redact, paths: [card], failure_policy: halt}
+rule_failure_policy: dead_letter
+sink: {type: file, path: /nonexistent/output.json}
+`))
+	require.NoError(t, err)
+
+	_, err = config.NewConfig[map[string]any](doc, nil)
+	require.Error(t, err)
+
+	rules, err := config.NewRules[map[string]any](doc, nil)
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+	assert.Equal(t, rule.FailureHalt, rule.PolicyOf(rules[0], rule.FailureSkip))
+	assert.Equal(t, rule.FailureDeadLetter, rule.PolicyOf(rules[1], rule.FailureSkip))
+	assert.Equal(t, rule.FailureDrop, rule.PolicyOf(rules[2], rule.FailureSkip))
+	assert.Equal(t, rule.FailureHalt, rule.PolicyOf(rules[3], rule.FailureSkip))
+}
+
+func TestNewRules_LookupFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "customers.csv")
+	require.NoError(t, os.WriteFile(path, []byte("id,name\n123,Big Company\n"), 0600))
+
+	doc, err := config.Parse([]byte(`
+rules:
+  - type: lookup
+    source: customer.id
+    target: customer
+    file: {name: customers, path: ` + path + `, key_column: id, poll_interval: 10ms}
+`))
+	require.NoError(t, err)
+
+	m := metrics.New()
+	registry := config.NewRegistry[map[string]any]()
+	registry.SetMetrics(m)
+	rules, err := config.NewRules(doc, registry)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+
+	// the file is polled while the rule is started, as the processor applying it does
+	starter, ok := rules[0].(rule.Starter)
+	require.True(t, ok)
+	starter.Start()
+	defer starter.Stop()
+
+	lookup := func() any {
+		evt := event.NewEvent(&event.RawEvent[map[string]any]{
+			Content: map[string]any{"customer": map[string]any{"id": "123"}},
+		})
+		rules[0].Apply(evt)
+		return evt.Content()["customer"]
+	}
+	assert.Equal(t, map[string]any{"id": "123", "name": "Big Company"}, lookup())
+
+	require.NoError(t, os.WriteFile(path, []byte("id,name\n123,Big Company Inc.\n"), 0600))
+	assert.Eventually(t, func() bool {
+		return lookup().(map[string]any)["name"] == "Big Company Inc."
+	}, 5*time.Second, 10*time.Millisecond)
+
+	buf := &strings.Builder{}
+	_, err = m.Registry().WriteTo(buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `conduit_lookup_table_entries{table="customers"} 1`)
+}
+
+func TestNewConfig_Registry(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	registry := config.NewRegistry[map[string]any]()
+	registry.RegisterRule("uppercase", func(spec config.Spec) (rule.Rule[map[string]any], error) {
+		var c struct {
+			Field string `json:"field"`
+		}
+		if err := spec.Decode(&c); err != nil {
+			return nil, err
+		}
+
+		return rule.NewRule("uppercase", "", rule.TypeTransform,
+			func(evt *event.Event[map[string]any]) rule.Result[map[string]any] {
+				content := evt.Content()
+				content[c.Field] = strings.ToUpper(content[c.Field].(string))
+				return rule.TransformResult[map[string]any]{Event: evt}
+			},
+		), nil
+	})
+	registry.RegisterSink("memory", func(spec config.Spec) (sink.Sink[map[string]any], error) {
+		return sink.NewWriterSink[map[string]any](buf), nil
+	})
+
+	doc, err := config.Parse([]byte(`
+rules:
+  - {type: uppercase, field: name}
+sink: {type: memory}
+`))
+	require.NoError(t, err)
+
+	c, err := config.New(doc, registry)
+	require.NoError(t, err)
+	require.NoError(t, c.Start())
+	require.NoError(t, c.Write(event.NewRawEvent(map[string]any{"name": "alice"}, nil)))
+	require.NoError(t, c.Stop())
+
+	assert.Equal(t, "{\"name\":\"ALICE\"}\n", buf.String())
+
+	doc, err = config.Parse([]byte(`
+rules:
+  - {type: uppercase, fields: name}
+sink: {type: memory}
+`))
+	require.NoError(t, err)
+	_, err = config.NewConfig(doc, registry)
+	assert.EqualError(t, err, "rules[0].fields: unknown field")
+}
+
+func TestNewConfig_Errors(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		doc     string
+		wantErr string
+	}{
+		"unknown top-level field": {
+			doc:     "sinks: {type: stdout}",
+			wantErr: "sinks: unknown field",
+		},
+		"wrong type": {
+			doc:     "sink: {type: stdout}\ndestinations: [{name: a, sink: {type: stdout}, buffer_size: many}]",
+			wantErr: `destinations[0].buffer_size: expected an integer, got "many"`,
+		},
+		"invalid duration": {
+			doc:     "sink: {type: stdout}\nretry_policy: {base_backoff: 10}",
+			wantErr: `retry_policy.base_backoff: expected a duration such as "5s", got 10`,
+		},
+		"missing sink": {
+			doc:     "rules: []",
+			wantErr: "sink: sink or destinations are required",
+		},
+		"missing type": {
+			doc:     "sink: {path: out.json}",
+			wantErr: "sink.type: type is required",
+		},
+		"unknown rule type": {
+			doc:     "sink: {type: stdout}\nrules: [{type: filter, condition: {field: a, op: exists}}, {type: magic}]",
+			wantErr: `rules[1].type: unknown rule type "magic"`,
+		},
+		"unknown field in a rule": {
+			doc:     "sink: {type: stdout}\nrules: [{type: filter, condition: {field: a, op: exists, vaule: 1}}]",
+			wantErr: "rules[0].condition.vaule: unknown field",
+		},
+		"nested field type": {
+			doc:     "sink: {type: stdout}\nrules: [{type: filter, condition: {all: [{field: a, op: exists}, {field: [b]}]}}]",
+			wantErr: "rules[0].condition.all[1].field: expected a string, got a list",
+		},
+		"invalid rule": {
+			doc:     "sink: {type: stdout}\nrules: [{type: dedup, keys: [id]}]",
+			wantErr: "rules[0]: window must be positive",
+		},
+		"invalid failure policy": {
+			doc:     "sink: {type: stdout}\nrules: [{type: sample, rate: 0.1, failure_policy: retry}]",
+			wantErr: `rules[0].failure_policy: unknown failure policy "retry"`,
+		},
+		"skip failure policy of redact rule": {
+			doc:     "sink: {type: stdout}\nrules: [{type: redact, paths: [card], failure_policy: skip}]",
+			wantErr: `rules[0].failure_policy: rule type "redact" does not allow failure policy "skip"`,
+		},
+		"missing environment variable": {
+			doc:     "sink: {type: stdout}\nrules: [{type: redact, paths: [a], mode: hmac, hmac_key_env: CONDUIT_TEST_UNSET}]",
+			wantErr: "rules[0]: environment variable CONDUIT_TEST_UNSET is not set",
+		},
+		"batch without flush interval": {
+			doc:     "sink: {type: stdout}\nsending_strategy: {type: batch, buffer_limit_bytes: 1024}",
+			wantErr: "sending_strategy.flush_interval: must be positive for the batch strategy",
+		},
+		"unknown overflow policy": {
+			doc:     "sink: {type: stdout}\ndestinations: [{name: a, sink: {type: stdout}, overflow_policy: wait}]",
+			wantErr: `destinations[0].overflow_policy: unknown overflow policy "wait"`,
+		},
+		"duplicate destination": {
+			doc:     "sink: {type: stdout}\ndestinations: [{name: default, sink: {type: stdout}}]",
+			wantErr: `destinations[0].name: duplicate destination "default"`,
+		},
+		"lookup table and file": {
+			doc:     "sink: {type: stdout}\nrules: [{type: lookup, source: id, target: c, table: {}, file: {path: c.csv}}]",
+			wantErr: "rules[0]: table and file are mutually exclusive",
+		},
+		"lookup composite key with cidr": {
+			doc:     "sink: {type: stdout}\nrules: [{type: lookup, source: ip, target: c, match: cidr, composite_sources: [port]}]",
+			wantErr: "rules[0]: composite keys cannot be matched as CIDR",
+		},
+		"missing lookup file": {
+			doc:     "sink: {type: stdout}\nrules: [{type: lookup, source: id, target: c, file: {path: /nonexistent/c.csv}}]",
+			wantErr: "rules[0].file: failed to load lookup table /nonexistent/c.csv: open /nonexistent/c.csv: no such file or directory",
+		},
+		"unknown route destination": {
+			doc:     "sink: {type: stdout}\nroutes: [{tags: {a: b}, destinations: [default, archive]}]",
+			wantErr: `routes[0].destinations[1]: unknown destination "archive"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			doc, err := config.Parse([]byte(tc.doc))
+			if err == nil {
+				_, err = config.NewConfig[map[string]any](doc, nil)
+			}
+			assert.EqualError(t, err, tc.wantErr)
+
+			var pathErr *config.PathError
+			assert.ErrorAs(t, err, &pathErr)
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/sink"
+	"github.com/mrtc0/conduit/source"
+)
+
+// SourceFactory creates a source from its configuration.
+type SourceFactory[T any] func(spec Spec) (source.Source[T], error)
+
+// RuleFactory creates a processing rule from its configuration.
+type RuleFactory[T any] func(spec Spec) (rule.Rule[T], error)
+
+// SinkFactory creates a sink from its configuration.
+type SinkFactory[T any] func(spec Spec) (sink.Sink[T], error)
+
+// Registry holds the factories of the sources, rules and sinks by their type.
+// It is not safe to register factories while building a Conduit.
+type Registry[T any] struct {
+	sources map[string]SourceFactory[T]
+	rules   map[string]RuleFactory[T]
+	sinks   map[string]SinkFactory[T]
+	metrics *metrics.Metrics
+}
+
+// NewRegistry creates a Registry with the built-in factories:
+//   - sources: file, http and syslog
+//   - rules: filter, transform, lookup, redact, dedup, rate_limit, sample and split
+//   - sinks: stdout and file
+func NewRegistry[T any]() *Registry[T] {
+	r := &Registry[T]{
+		sources: map[string]SourceFactory[T]{},
+		rules:   map[string]RuleFactory[T]{},
+		sinks:   map[string]SinkFactory[T]{},
+	}
+
+	r.RegisterSource("file", newFileSource[T])
+	r.RegisterSource("http", newHTTPSource[T])
+	r.RegisterSource("syslog", newSyslogSource[T])
+
+	r.RegisterRule("filter", newFilterRule[T])
+	r.RegisterRule("transform", newTransformRule[T])
+	r.RegisterRule("lookup", newLookupRule[T])
+	r.RegisterRule("redact", newRedactRule[T])
+	r.RegisterRule("dedup", newDedupRule[T])
+	r.RegisterRule("rate_limit", newRateLimitRule[T])
+	r.RegisterRule("sample", newSampleRule[T])
+	r.RegisterRule("split", newSplitRule[T])
+
+	r.RegisterSink("stdout", newStdoutSink[T])
+	r.RegisterSink("file", newFileSink[T])
+
+	return r
+}
+
+// RegisterSource registers the factory of the sources of the type, replacing any registered one.
+func (r *Registry[T]) RegisterSource(typ string, factory SourceFactory[T]) {
+	r.sources[typ] = factory
+}
+
+// RegisterRule registers the factory of the rules of the type, replacing any registered one.
+func (r *Registry[T]) RegisterRule(typ string, factory RuleFactory[T]) {
+	r.rules[typ] = factory
+}
+
+// RegisterSink registers the factory of the sinks of the type, replacing any registered one.
+func (r *Registry[T]) RegisterSink(typ string, factory SinkFactory[T]) {
+	r.sinks[typ] = factory
+}
+
+// SetMetrics sets the metrics passed to the factories in Spec.Metrics.
+func (r *Registry[T]) SetMetrics(m *metrics.Metrics) {
+	r.metrics = m
+}
+
+// tlsConfig is the configuration of a TLS server certificate.
+type tlsConfig struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+func (c *tlsConfig) load() (*tls.Config, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// env returns the value of the environment variable, or an error if it is named but not set.
+func env(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+
+	return value, nil
+}
+
+func newFileSource[T any](spec Spec) (source.Source[T], error) {
+	var c struct {
+		Paths             []string      `json:"paths"`
+		CheckpointPath    string        `json:"checkpoint_path,omitempty"`
+		ReadFromBeginning bool          `json:"read_from_beginning,omitempty"`
+		PollInterval      time.Duration `json:"poll_interval,omitempty"`
+		MaxLineSize       int           `json:"max_line_size,omitempty"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	return source.NewFileSource(source.FileSourceConfig[T]{
+		Paths:             c.Paths,
+		CheckpointPath:    c.CheckpointPath,
+		ReadFromBeginning: c.ReadFromBeginning,
+		PollInterval:      c.PollInterval,
+		MaxLineSize:       c.MaxLineSize,
+	})
+}
+
+func newHTTPSource[T any](spec Spec) (source.Source[T], error) {
+	var c struct {
+		Addr                string        `json:"addr,omitempty"`
+		TLS                 *tlsConfig    `json:"tls,omitempty"`
+		MaxBodySize         int64         `json:"max_body_size,omitempty"`
+		BearerTokenEnv      string        `json:"bearer_token_env,omitempty"`
+		HMACSecretEnv       string        `json:"hmac_secret_env,omitempty"`
+		HMACHeader          string        `json:"hmac_header,omitempty"`
+		BackpressureTimeout time.Duration `json:"backpressure_timeout,omitempty"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := c.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+	bearerToken, err := env(c.BearerTokenEnv)
+	if err != nil {
+		return nil, err
+	}
+	hmacSecret, err := env(c.HMACSecretEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	return source.NewHTTPSource(source.HTTPSourceConfig[T]{
+		Addr:                c.Addr,
+		TLSConfig:           tlsConfig,
+		MaxBodySize:         c.MaxBodySize,
+		BearerToken:         bearerToken,
+		HMACSecret:          []byte(hmacSecret),
+		HMACHeader:          c.HMACHeader,
+		BackpressureTimeout: c.BackpressureTimeout,
+	})
+}
+
+func newSyslogSource[T any](spec Spec) (source.Source[T], error) {
+	var c struct {
+		Network        string     `json:"network"`
+		Addr           string     `json:"addr"`
+		TLS            *tlsConfig `json:"tls,omitempty"`
+		MaxMessageSize int        `json:"max_message_size,omitempty"`
+		// Location is the IANA time zone of RFC 3164 timestamps, such as "Asia/Tokyo".
+		Location string `json:"location,omitempty"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := c.TLS.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var location *time.Location
+	if c.Location != "" {
+		if location, err = time.LoadLocation(c.Location); err != nil {
+			return nil, fmt.Errorf("invalid location: %w", err)
+		}
+	}
+
+	return source.NewSyslogSource(source.SyslogSourceConfig[T]{
+		Network:        c.Network,
+		Addr:           c.Addr,
+		TLSConfig:      tlsConfig,
+		MaxMessageSize: c.MaxMessageSize,
+		Location:       location,
+	})
+}
+
+func newFilterRule[T any](spec Spec) (rule.Rule[T], error) {
+	var filter rule.FieldFilter
+	if err := spec.Decode(&filter); err != nil {
+		return nil, err
+	}
+
+	return rule.NewFieldFilterRule[T](filter)
+}
+
+func newTransformRule[T any](spec Spec) (rule.Rule[T], error) {
+	var c struct {
+		Name       string                `json:"name,omitempty"`
+		Operations []rule.FieldOperation `json:"operations"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	return rule.NewFieldTransformRule[T](c.Name, c.Operations...)
+}
+
+func newLookupRule[T any](spec Spec) (rule.Rule[T], error) {
+	var c struct {
+		Source string           `json:"source"`
+		Target string           `json:"target"`
+		Table  rule.LookupTable `json:"table,omitempty"`
+		// File is the file of the table, reloaded when it changes, instead of Table.
+		File             *rule.LookupFileConfig `json:"file,omitempty"`
+		CompositeSources []string               `json:"composite_sources,omitempty"`
+		KeySeparator     string                 `json:"key_separator,omitempty"`
+		Match            rule.LookupMatch       `json:"match,omitempty"`
+		CaseInsensitive  bool                   `json:"case_insensitive,omitempty"`
+		Default          rule.LookupTableEntry  `json:"default,omitempty"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.Source == "" || c.Target == "" {
+		return nil, errors.New("source and target are required")
+	}
+
+	opts := []rule.LookupRuleOptionsFunc[T]{
+		rule.WithLookupMatch[T](c.Match),
+		rule.WithLookupCompositeKey[T](c.KeySeparator, c.CompositeSources...),
+		rule.WithLookupDefault[T](c.Default),
+	}
+	if c.CaseInsensitive {
+		opts = append(opts, rule.WithLookupCaseInsensitive[T]())
+	}
+
+	if c.File == nil {
+		return rule.NewLookupRule(c.Table, c.Source, c.Target, opts...)
+	}
+	if c.Table != nil {
+		return nil, errors.New("table and file are mutually exclusive")
+	}
+
+	file, err := rule.NewLookupFile(*c.File, rule.WithLookupFileMetrics(spec.Metrics))
+	if err != nil {
+		return nil, &PathError{Path: spec.Path + ".file", Err: err}
+	}
+
+	return rule.NewLookupRuleWithProvider(file, c.Source, c.Target, opts...)
+}
+
+func newRedactRule[T any](spec Spec) (rule.Rule[T], error) {
+	var c struct {
+		rule.Redaction
+		// HMACKeyEnv is the environment variable holding the key of the hmac mode.
+		HMACKeyEnv string `json:"hmac_key_env,omitempty"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	key, err := env(c.HMACKeyEnv)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		c.HMACKey = []byte(key)
+	}
+
+	return rule.NewRedactRule[T](c.Redaction)
+}
+
+func newDedupRule[T any](spec Spec) (rule.Rule[T], error) {
+	var dedup rule.Dedup
+	if err := spec.Decode(&dedup); err != nil {
+		return nil, err
+	}
+
+	return rule.NewDedupRule[T](dedup)
+}
+
+func newRateLimitRule[T any](spec Spec) (rule.Rule[T], error) {
+	var limit rule.RateLimit
+	if err := spec.Decode(&limit); err != nil {
+		return nil, err
+	}
+
+	return rule.NewRateLimitRule[T](limit)
+}
+
+func newSampleRule[T any](spec Spec) (rule.Rule[T], error) {
+	var sample rule.Sample
+	if err := spec.Decode(&sample); err != nil {
+		return nil, err
+	}
+
+	return rule.NewSampleRule[T](sample)
+}
+
+func newSplitRule[T any](spec Spec) (rule.Rule[T], error) {
+	var c struct {
+		Name string `json:"name,omitempty"`
+		Path string `json:"path"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	return rule.NewSplitRule[T](c.Name, c.Path)
+}
+
+func newStdoutSink[T any](spec Spec) (sink.Sink[T], error) {
+	var c struct{}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+
+	// os.Stdout is hidden behind an io.Writer so that closing the sink does not close it.
+	return sink.NewWriterSink[T](struct{ io.Writer }{os.Stdout}), nil
+}
+
+func newFileSink[T any](spec Spec) (sink.Sink[T], error) {
+	var c struct {
+		Path string `json:"path"`
+	}
+	if err := spec.Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.Path == "" {
+		return nil, errors.New("path is required")
+	}
+
+	return sink.NewFileSink[T](c.Path)
+}
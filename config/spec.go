@@ -0,0 +1,293 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mrtc0/conduit/metrics"
+)
+
+// PathError is an error in the value at a path of a document, such as "rules[2].condition.op".
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// Spec is the configuration of a source, rule or sink in a document, passed to the factory of its type.
+type Spec struct {
+	// Path is the path of the component in the document, such as "rules[2]".
+	Path string
+	// Type is the type of the component.
+	Type string
+	// Metrics records the metrics of the component, such as the reloads of a lookup file.
+	// It is nil unless set by Registry.SetMetrics.
+	Metrics *metrics.Metrics
+
+	fields map[string]any
+}
+
+// Decode decodes the fields of the component, except its type, into v,
+// which is usually a pointer to a struct with json tags.
+// time.Duration values are written as strings such as "5s".
+// Unknown fields and values of the wrong type are reported as a *PathError.
+func (s Spec) Decode(v any) error {
+	return decode(s.Path, s.fields, v)
+}
+
+// decode decodes a value of a document into v, checking the value against the type of v first
+// so that errors point at the offending path.
+func decode(path string, value any, v any) error {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Pointer {
+		return fmt.Errorf("cannot decode into %T", v)
+	}
+
+	normalized, err := normalize(path, value, t.Elem())
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return &PathError{Path: path, Err: err}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return &PathError{Path: path, Err: err}
+	}
+
+	return nil
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textType        = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// normalize checks that the value can be decoded into the type and converts durations into nanoseconds.
+func normalize(path string, value any, t reflect.Type) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	if t == durationType {
+		s, ok := value.(string)
+		if !ok {
+			return nil, &PathError{Path: path, Err: fmt.Errorf("expected a duration such as \"5s\", got %s", describe(value))}
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, &PathError{Path: path, Err: fmt.Errorf("invalid duration %q", s)}
+		}
+		return int64(d), nil
+	}
+
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return value, nil
+	}
+	if reflect.PointerTo(t).Implements(textType) {
+		if _, ok := value.(string); !ok {
+			return nil, typeError(path, "a string", value)
+		}
+		return value, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return normalize(path, value, t.Elem())
+	case reflect.Interface:
+		return value, nil
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			return nil, typeError(path, "a string", value)
+		}
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			return nil, typeError(path, "a boolean", value)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := number(value)
+		if !ok || f != math.Trunc(f) {
+			return nil, typeError(path, "an integer", value)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := number(value); !ok {
+			return nil, typeError(path, "a number", value)
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// []byte is a base64 encoded string
+			if _, ok := value.(string); !ok {
+				return nil, typeError(path, "a string", value)
+			}
+			return value, nil
+		}
+		items, ok := value.([]any)
+		if !ok {
+			return nil, typeError(path, "a list", value)
+		}
+		normalized := make([]any, len(items))
+		for i, item := range items {
+			v, err := normalize(fmt.Sprintf("%s[%d]", path, i), item, t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			normalized[i] = v
+		}
+		return normalized, nil
+	case reflect.Map:
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil, typeError(path, "a mapping", value)
+		}
+		normalized := make(map[string]any, len(fields))
+		for _, key := range sortedKeys(fields) {
+			v, err := normalize(join(path, key), fields[key], t.Elem())
+			if err != nil {
+				return nil, err
+			}
+			normalized[key] = v
+		}
+		return normalized, nil
+	case reflect.Struct:
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil, typeError(path, "a mapping", value)
+		}
+		structFields := jsonFields(t)
+		normalized := make(map[string]any, len(fields))
+		for _, key := range sortedKeys(fields) {
+			field, ok := structFields[key]
+			if !ok {
+				return nil, &PathError{Path: join(path, key), Err: fmt.Errorf("unknown field")}
+			}
+			v, err := normalize(join(path, key), fields[key], field)
+			if err != nil {
+				return nil, err
+			}
+			normalized[key] = v
+		}
+		return normalized, nil
+	}
+
+	return value, nil
+}
+
+// jsonFields returns the types of the fields of the struct by their JSON names, including promoted fields.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	// promoted fields are shadowed by the fields of the outer struct
+	var embedded []reflect.Type
+
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+
+	for _, e := range embedded {
+		for name, ft := range jsonFields(e) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+
+	return fields
+}
+
+func number(value any) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+
+	return 0, false
+}
+
+func typeError(path, expected string, value any) error {
+	return &PathError{Path: path, Err: fmt.Errorf("expected %s, got %s", expected, describe(value))}
+}
+
+func describe(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "a mapping"
+	}
+	if f, ok := number(value); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/processor/rule"
+)
+
+// DefaultRuleWatchInterval is the default interval at which a RuleWatcher checks its file for changes.
+const DefaultRuleWatchInterval = 5 * time.Second
+
+// RuleReplacer replaces the processing rules of a running pipeline, such as a conduit.Conduit.
+type RuleReplacer[T any] interface {
+	ReplaceRules(rules []rule.Rule[T]) error
+}
+
+// RuleWatcherConfig is the configuration of a RuleWatcher.
+type RuleWatcherConfig[T any] struct {
+	// Path is the path of the configuration file.
+	Path string
+	// Registry holds the factories of the rules. If nil, NewRegistry is used.
+	Registry *Registry[T]
+	// PollInterval is the interval at which the file is checked for changes.
+	// If zero, DefaultRuleWatchInterval is used.
+	PollInterval time.Duration
+	// ErrorHandler is called with the errors of reloading the rules.
+	// If not specified, the errors are logged.
+	ErrorHandler func(err error)
+}
+
+// RuleWatcher replaces the processing rules of a running pipeline when the rules of its configuration file change.
+// Only the rules and rule_failure_policy of the file are applied; changes to the other parts, such as the sinks, are not.
+// The new rules are created with NewRules before they replace the running ones,
+// so a file that fails to parse or build keeps the running rules.
+// The file should be replaced atomically, such as by renaming a temporary file, so that a partially written file is not loaded.
+type RuleWatcher[T any] struct {
+	config RuleWatcherConfig[T]
+	target RuleReplacer[T]
+
+	mu sync.Mutex
+	// digest is the digest of the content of the file last loaded, even if it failed,
+	// so that an invalid file is reported once rather than at every check.
+	digest [sha256.Size]byte
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewRuleWatcher creates a RuleWatcher replacing the rules of the target with the rules of the file.
+func NewRuleWatcher[T any](target RuleReplacer[T], config RuleWatcherConfig[T]) (*RuleWatcher[T], error) {
+	if target == nil {
+		return nil, errors.New("no target is specified")
+	}
+	if config.Path == "" {
+		return nil, errors.New("no path is specified")
+	}
+
+	if config.Registry == nil {
+		config.Registry = NewRegistry[T]()
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultRuleWatchInterval
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(err error) {
+			log.Error(err.Error())
+		}
+	}
+
+	return &RuleWatcher[T]{config: config, target: target}, nil
+}
+
+// Start starts checking the file for changes.
+// The current content of the file is expected to be in use by the target already, such as when it was created by New,
+// so the rules are replaced on the first change only.
+func (w *RuleWatcher[T]) Start(ctx context.Context) error {
+	data, err := os.ReadFile(w.config.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	w.mu.Lock()
+	w.digest = sha256.Sum256(data)
+	w.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.cancel = cancel
+	w.done = make(chan struct{})
+
+	go w.run(ctx)
+
+	return nil
+}
+
+// Stop stops checking the file and waits for a reload in progress to finish.
+func (w *RuleWatcher[T]) Stop() {
+	if w.cancel == nil {
+		return
+	}
+
+	w.cancel()
+	<-w.done
+}
+
+// Reload replaces the rules of the target with the rules of the file, even if the file has not changed.
+// If the file is invalid or the target rejects the rules, the running rules are kept and an error is returned.
+func (w *RuleWatcher[T]) Reload() error {
+	data, err := os.ReadFile(w.config.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.load(data)
+}
+
+func (w *RuleWatcher[T]) run(ctx context.Context) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := w.check(); err != nil {
+			w.config.ErrorHandler(err)
+		}
+	}
+}
+
+// check reloads the rules if the content of the file has changed.
+func (w *RuleWatcher[T]) check() error {
+	data, err := os.ReadFile(w.config.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if sha256.Sum256(data) == w.digest {
+		return nil
+	}
+
+	return w.load(data)
+}
+
+func (w *RuleWatcher[T]) load(data []byte) error {
+	w.digest = sha256.Sum256(data)
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		// an empty file is more likely being written than meant to remove all the rules
+		return fmt.Errorf("failed to reload rules from %s, keeping the running rules: file is empty", w.config.Path)
+	}
+	doc, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to reload rules from %s, keeping the running rules: %w", w.config.Path, err)
+	}
+	rules, err := NewRules(doc, w.config.Registry)
+	if err != nil {
+		return fmt.Errorf("failed to reload rules from %s, keeping the running rules: %w", w.config.Path, err)
+	}
+	if err := w.target.ReplaceRules(rules); err != nil {
+		return fmt.Errorf("failed to reload rules from %s, keeping the running rules: %w", w.config.Path, err)
+	}
+
+	log.Info(fmt.Sprintf("reloaded %d rules from %s", len(rules), w.config.Path))
+	return nil
+}
@@ -0,0 +1,112 @@
+package config_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/config"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type ruleTarget struct {
+	mu      sync.Mutex
+	rules   [][]rule.Rule[map[string]any]
+	wantErr error
+}
+
+func (t *ruleTarget) ReplaceRules(rules []rule.Rule[map[string]any]) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.wantErr != nil {
+		return t.wantErr
+	}
+	t.rules = append(t.rules, rules)
+	return nil
+}
+
+func (t *ruleTarget) replaced() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.rules)
+}
+
+func TestRuleWatcher(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "conduit.yaml")
+	write := func(content string) {
+		tmp := path + ".tmp"
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+		require.NoError(t, os.Rename(tmp, path))
+	}
+	write("rules: [{type: sample, rate: 0.5}]\nsink: {type: stdout}")
+
+	errs := make(chan error, 10)
+	target := &ruleTarget{}
+	w, err := config.NewRuleWatcher[map[string]any](target, config.RuleWatcherConfig[map[string]any]{
+		Path:         path,
+		PollInterval: 10 * time.Millisecond,
+		ErrorHandler: func(err error) { errs <- err },
+	})
+	require.NoError(t, err)
+	require.NoError(t, w.Start(context.Background()))
+	defer w.Stop()
+
+	// the rules in use are not replaced until the file changes
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, target.replaced())
+
+	write("rules: [{type: sample, rate: 0.5}, {type: split, path: items}]\nsink: {type: stdout}")
+	assert.Eventually(t, func() bool { return target.replaced() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// an invalid file is reported once and keeps the running rules
+	write("rules: [{type: sample, rate: 2}]\nsink: {type: stdout}")
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "keeping the running rules: rules[0]: ")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error is reported")
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, errs)
+	assert.Equal(t, 1, target.replaced())
+
+	w.Stop()
+	target.mu.Lock()
+	require.Len(t, target.rules[0], 2)
+	target.mu.Unlock()
+}
+
+func TestRuleWatcher_Reload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "conduit.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("rules: [{type: split, path: items}]"), 0600))
+
+	target := &ruleTarget{}
+	w, err := config.NewRuleWatcher[map[string]any](target, config.RuleWatcherConfig[map[string]any]{Path: path})
+	require.NoError(t, err)
+
+	require.NoError(t, w.Reload())
+	assert.Equal(t, 1, target.replaced())
+
+	require.NoError(t, os.WriteFile(path, []byte("\n"), 0600))
+	assert.ErrorContains(t, w.Reload(), "keeping the running rules: file is empty")
+
+	require.NoError(t, os.WriteFile(path, []byte("rules: []"), 0600))
+	target.wantErr = errors.New("rejected")
+	assert.ErrorContains(t, w.Reload(), "keeping the running rules: rejected")
+	assert.Equal(t, 1, target.replaced())
+
+	_, err = config.NewRuleWatcher[map[string]any](target, config.RuleWatcherConfig[map[string]any]{})
+	assert.EqualError(t, err, "no path is specified")
+}
@@ -0,0 +1,61 @@
+package event
+
+// DropStage is the stage of the pipeline where an event was dropped.
+type DropStage string
+
+const (
+	// DropStageProcess is the stage of the processing rules, where filter rules drop events.
+	DropStageProcess DropStage = "process"
+	// DropStageMap is the stage mapping events to another type, where events that fail to be mapped are dropped.
+	DropStageMap DropStage = "map"
+	// DropStageRoute is the stage of the router, where events matching no route are dropped.
+	DropStageRoute DropStage = "route"
+	// DropStageBuffer is the stage of the destination buffers, where events are dropped when a buffer is full.
+	DropStageBuffer DropStage = "buffer"
+	// DropStageEncode is the stage of the sending strategies, where events that fail to be encoded are dropped.
+	DropStageEncode DropStage = "encode"
+	// DropStageBatch is the stage of the batch strategy, where events larger than the batch buffer are dropped.
+	DropStageBatch DropStage = "batch"
+)
+
+// DroppedEvent describes an event that was discarded before reaching a sink.
+type DroppedEvent[T any] struct {
+	// Event is the dropped event.
+	Event *Event[T]
+	// Stage is the stage of the pipeline where the event was dropped.
+	Stage DropStage
+	// Rule is the name of the rule that dropped the event, if it was dropped by a rule.
+	Rule string
+	// Reason explains why the event was dropped.
+	Reason string
+	// Destination is the name of the destination the event was dropped for, if it was dropped by a single destination.
+	Destination string
+	// Err is the error that caused the drop, if any.
+	Err error
+}
+
+// DropHandler is called for each dropped event.
+// It is called synchronously from the goroutines of the pipeline,
+// so it must be safe for concurrent use and should return quickly.
+type DropHandler[T any] func(dropped *DroppedEvent[T])
+
+// Handle calls the handler with the dropped event. It does nothing on a nil DropHandler.
+func (h DropHandler[T]) Handle(dropped *DroppedEvent[T]) {
+	if h == nil {
+		return
+	}
+
+	h(dropped)
+}
+
+// WithDestination returns a DropHandler that sets the destination of the dropped events before calling h.
+func (h DropHandler[T]) WithDestination(name string) DropHandler[T] {
+	if h == nil {
+		return nil
+	}
+
+	return func(dropped *DroppedEvent[T]) {
+		dropped.Destination = name
+		h(dropped)
+	}
+}
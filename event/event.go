@@ -25,6 +25,9 @@ func NewEvent[T any](rawEvent *RawEvent[T]) *Event[T] {
 		if !rawEvent.Metadata.IngestionTime.IsZero() {
 			metadata.IngestionTime = rawEvent.Metadata.IngestionTime
 		}
+
+		metadata.TraceParent = rawEvent.Metadata.TraceParent
+		metadata.TraceState = rawEvent.Metadata.TraceState
 	}
 
 	return &Event[T]{
@@ -33,6 +36,27 @@ func NewEvent[T any](rawEvent *RawEvent[T]) *Event[T] {
 	}
 }
 
+// Derive returns a new event with the content, inheriting a copy of the metadata of e.
+// It is used to create the events split from e.
+func (e *Event[T]) Derive(content T) *Event[T] {
+	return Map(e, content)
+}
+
+// Map returns a new event of type U with the content, inheriting a copy of the metadata of evt.
+// It is used to convert events from one type to another.
+func Map[T, U any](evt *Event[T], content U) *Event[U] {
+	metadata := evt.Metadata
+	metadata.Tags = make(Tags, len(evt.Tags))
+	for k, v := range evt.Tags {
+		metadata.Tags[k] = v
+	}
+
+	return &Event[U]{
+		Metadata: metadata,
+		content:  content,
+	}
+}
+
 func (e *Event[T]) Content() T {
 	return e.content
 }
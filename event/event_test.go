@@ -152,3 +152,23 @@ func TestEvent_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestEvent_Derive(t *testing.T) {
+	t.Parallel()
+
+	parent := event.NewEvent(&event.RawEvent[testutils.DummyEvent]{
+		Content: testutils.DummyEvent{ID: "parent"},
+		Metadata: &event.Metadata{
+			Tags:          event.Tags{"source": "feed"},
+			IngestionTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			TraceParent:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+	})
+
+	child := parent.Derive(testutils.DummyEvent{ID: "child"})
+	assert.Equal(t, testutils.DummyEvent{ID: "child"}, child.Content())
+	assert.Equal(t, parent.Metadata, child.Metadata)
+
+	child.Tags["record"] = "1"
+	assert.Equal(t, event.Tags{"source": "feed"}, parent.Tags, "the tags are copied")
+}
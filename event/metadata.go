@@ -5,6 +5,11 @@ import "time"
 type Tags map[string]string
 
 type Metadata struct {
-	Tags          Tags
-	IngestionTime time.Time
+	Tags          Tags      `json:"tags,omitempty"`
+	IngestionTime time.Time `json:"ingestion_time"`
+
+	// TraceParent is the W3C traceparent of the trace the event belongs to, if any.
+	TraceParent string `json:"traceparent,omitempty"`
+	// TraceState is the W3C tracestate accompanying TraceParent.
+	TraceState string `json:"tracestate,omitempty"`
 }
@@ -63,7 +63,9 @@ func Example_batchStrategy() {
 		},
 	})
 
-	c.Start()
+	if err := c.Start(); err != nil {
+		log.Fatalf("Error starting conduit: %v", err)
+	}
 
 	quit := make(chan struct{}, 1)
 
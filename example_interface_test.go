@@ -53,7 +53,9 @@ func Example() {
 		Sink:            sink.NewStdoutSink[cloudevent.Event](),
 	})
 
-	c.Start()
+	if err := c.Start(); err != nil {
+		log.Fatalf("Error starting conduit: %v", err)
+	}
 
 	events := []*event.RawEvent[cloudevent.Event]{
 		event.NewRawEvent(eventsGenerator("example.event.ping", "test message 1"), nil),
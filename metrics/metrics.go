@@ -0,0 +1,404 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// DropReasonBufferFull is the reason of events dropped because the buffer of a destination is full.
+	DropReasonBufferFull = "buffer_full"
+	// DropReasonUnrouted is the reason of events dropped because they match no route.
+	DropReasonUnrouted = "unrouted"
+	// DropReasonTooLarge is the reason of events dropped because they exceed the batch buffer limit.
+	DropReasonTooLarge = "too_large"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// Metrics records the metrics of every stage of a Conduit.
+// All methods can be called on a nil *Metrics, in which case nothing is recorded,
+// so components can hold an optional *Metrics without checking it.
+type Metrics struct {
+	registry *Registry
+
+	eventsReceived    *Counter
+	eventsProcessed   *Counter
+	eventsFiltered    *CounterVec
+	eventsTransformed *CounterVec
+	eventsSplit       *CounterVec
+	ruleFailures      *CounterVec
+	mapFailures       *Counter
+	eventsDropped     *CounterVec
+
+	eventsEncoded    *CounterVec
+	encodeFailures   *CounterVec
+	eventsBatched    *CounterVec
+	batchFlushes     *CounterVec
+	batchSize        *HistogramVec
+	batchBufferBytes *GaugeVec
+
+	sinkWrites        *CounterVec
+	sinkWriteDuration *HistogramVec
+	deadLettered      *CounterVec
+
+	senderQueueLength       *GaugeVec
+	destinationBufferLength *GaugeVec
+
+	lookupReloads          *CounterVec
+	lookupEntries          *GaugeVec
+	lookupReloadTimestamps *GaugeVec
+}
+
+// New creates Metrics registered to a new Registry.
+func New() *Metrics {
+	return NewWithRegistry(NewRegistry())
+}
+
+// NewWithRegistry creates Metrics registered to the given Registry.
+func NewWithRegistry(r *Registry) *Metrics {
+	return &Metrics{
+		registry: r,
+
+		eventsReceived: r.NewCounterVec(
+			"conduit_events_received_total",
+			"Number of events received from Write and the sources.",
+		).With(),
+		eventsProcessed: r.NewCounterVec(
+			"conduit_events_processed_total",
+			"Number of events that passed all processing rules.",
+		).With(),
+		eventsFiltered: r.NewCounterVec(
+			"conduit_events_filtered_total",
+			"Number of events dropped by filter rules.",
+			"rule", "reason",
+		),
+		eventsTransformed: r.NewCounterVec(
+			"conduit_events_transformed_total",
+			"Number of events transformed by transform rules.",
+			"rule",
+		),
+		eventsSplit: r.NewCounterVec(
+			"conduit_events_split_total",
+			"Number of events produced by split rules.",
+			"rule",
+		),
+		ruleFailures: r.NewCounterVec(
+			"conduit_rule_failures_total",
+			"Number of events that rules failed to process, by the failure policy applied.",
+			"rule", "policy",
+		),
+		mapFailures: r.NewCounterVec(
+			"conduit_map_failures_total",
+			"Number of events that failed to be mapped to the output type.",
+		).With(),
+		eventsDropped: r.NewCounterVec(
+			"conduit_events_dropped_total",
+			"Number of processed events that were not delivered to a destination.",
+			"destination", "reason",
+		),
+
+		eventsEncoded: r.NewCounterVec(
+			"conduit_events_encoded_total",
+			"Number of events encoded into payloads.",
+			"destination",
+		),
+		encodeFailures: r.NewCounterVec(
+			"conduit_event_encode_failures_total",
+			"Number of events that failed to be encoded.",
+			"destination",
+		),
+		eventsBatched: r.NewCounterVec(
+			"conduit_events_batched_total",
+			"Number of events added to a batch.",
+			"destination",
+		),
+		batchFlushes: r.NewCounterVec(
+			"conduit_batch_flushes_total",
+			"Number of batches flushed to the sender.",
+			"destination",
+		),
+		batchSize: r.NewHistogramVec(
+			"conduit_batch_size_bytes",
+			"Size of the flushed batches in bytes.",
+			DefaultSizeBuckets,
+			"destination",
+		),
+		batchBufferBytes: r.NewGaugeVec(
+			"conduit_batch_buffer_bytes",
+			"Size of the events buffered by the batch strategy in bytes.",
+			"destination",
+		),
+
+		sinkWrites: r.NewCounterVec(
+			"conduit_sink_writes_total",
+			"Number of payload writes to sinks, including retries.",
+			"destination", "result",
+		),
+		sinkWriteDuration: r.NewHistogramVec(
+			"conduit_sink_write_duration_seconds",
+			"Latency of payload writes to sinks.",
+			DefaultDurationBuckets,
+			"destination",
+		),
+		deadLettered: r.NewCounterVec(
+			"conduit_payloads_dead_lettered_total",
+			"Number of payloads written to the dead-letter sink.",
+			"destination",
+		),
+
+		senderQueueLength: r.NewGaugeVec(
+			"conduit_sender_queue_length",
+			"Number of payloads waiting in the queue of the sender.",
+			"destination",
+		),
+		destinationBufferLength: r.NewGaugeVec(
+			"conduit_destination_buffer_length",
+			"Number of events waiting in the buffer of a destination.",
+			"destination",
+		),
+
+		lookupReloads: r.NewCounterVec(
+			"conduit_lookup_table_reloads_total",
+			"Number of reloads of lookup tables from their files.",
+			"table", "result",
+		),
+		lookupEntries: r.NewGaugeVec(
+			"conduit_lookup_table_entries",
+			"Number of entries in a lookup table.",
+			"table",
+		),
+		lookupReloadTimestamps: r.NewGaugeVec(
+			"conduit_lookup_table_last_reload_timestamp_seconds",
+			"Unix time of the last successful load of a lookup table.",
+			"table",
+		),
+	}
+}
+
+// Registry returns the Registry the metrics are registered to.
+func (m *Metrics) Registry() *Registry {
+	if m == nil {
+		return nil
+	}
+
+	return m.registry
+}
+
+// Handler returns an http.Handler serving the metrics in the Prometheus text exposition format.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+
+	return m.registry
+}
+
+func (m *Metrics) EventReceived() {
+	if m == nil {
+		return
+	}
+	m.eventsReceived.Inc()
+}
+
+func (m *Metrics) EventProcessed() {
+	if m == nil {
+		return
+	}
+	m.eventsProcessed.Inc()
+}
+
+// EventFiltered records an event dropped by a filter rule.
+// The reason should come from a small set of values, since each reason is a separate time series.
+func (m *Metrics) EventFiltered(rule, reason string) {
+	if m == nil {
+		return
+	}
+	m.eventsFiltered.With(rule, reason).Inc()
+}
+
+func (m *Metrics) EventTransformed(rule string) {
+	if m == nil {
+		return
+	}
+	m.eventsTransformed.With(rule).Inc()
+}
+
+// EventSplit records an event split into n events by a split rule.
+func (m *Metrics) EventSplit(rule string, n int) {
+	if m == nil {
+		return
+	}
+	m.eventsSplit.With(rule).Add(float64(n))
+}
+
+// RuleFailed records an event that a rule failed to process and the failure policy applied to it.
+func (m *Metrics) RuleFailed(rule, policy string) {
+	if m == nil {
+		return
+	}
+	m.ruleFailures.With(rule, policy).Inc()
+}
+
+// MapFailed records an event that failed to be mapped to the output type.
+func (m *Metrics) MapFailed() {
+	if m == nil {
+		return
+	}
+	m.mapFailures.Inc()
+}
+
+// EventUnrouted records an event that matched no route and was not sent to any destination.
+func (m *Metrics) EventUnrouted() {
+	if m == nil {
+		return
+	}
+	m.eventsDropped.With("", DropReasonUnrouted).Inc()
+}
+
+// LookupTableReloaded records a reload of the lookup table, which failed if err is not nil.
+func (m *Metrics) LookupTableReloaded(table string, err error) {
+	if m == nil {
+		return
+	}
+
+	result := resultSuccess
+	if err != nil {
+		result = resultFailure
+	}
+	m.lookupReloads.With(table, result).Inc()
+}
+
+// SetLookupTableFunc sets the functions returning the number of entries of the lookup table
+// and the time it was last loaded successfully.
+func (m *Metrics) SetLookupTableFunc(table string, entries func() int, loadedAt func() time.Time) {
+	if m == nil {
+		return
+	}
+
+	m.lookupEntries.SetFunc(func() float64 { return float64(entries()) }, table)
+	m.lookupReloadTimestamps.SetFunc(func() float64 {
+		return float64(loadedAt().UnixNano()) / float64(time.Second)
+	}, table)
+}
+
+// Destination returns the metrics of the destination with the given name.
+func (m *Metrics) Destination(name string) *DestinationMetrics {
+	if m == nil {
+		return nil
+	}
+
+	return &DestinationMetrics{
+		metrics:           m,
+		name:              name,
+		eventsEncoded:     m.eventsEncoded.With(name),
+		encodeFailures:    m.encodeFailures.With(name),
+		eventsBatched:     m.eventsBatched.With(name),
+		batchFlushes:      m.batchFlushes.With(name),
+		batchSize:         m.batchSize.With(name),
+		sinkWriteSuccess:  m.sinkWrites.With(name, resultSuccess),
+		sinkWriteFailure:  m.sinkWrites.With(name, resultFailure),
+		sinkWriteDuration: m.sinkWriteDuration.With(name),
+		deadLettered:      m.deadLettered.With(name),
+	}
+}
+
+// DestinationMetrics records the metrics of the strategy and the sender of a destination.
+// Like Metrics, all methods can be called on a nil *DestinationMetrics.
+type DestinationMetrics struct {
+	metrics *Metrics
+	name    string
+
+	eventsEncoded     *Counter
+	encodeFailures    *Counter
+	eventsBatched     *Counter
+	batchFlushes      *Counter
+	batchSize         *Histogram
+	sinkWriteSuccess  *Counter
+	sinkWriteFailure  *Counter
+	sinkWriteDuration *Histogram
+	deadLettered      *Counter
+}
+
+func (d *DestinationMetrics) EventDropped(reason string) {
+	if d == nil {
+		return
+	}
+	d.metrics.eventsDropped.With(d.name, reason).Inc()
+}
+
+func (d *DestinationMetrics) EventEncoded() {
+	if d == nil {
+		return
+	}
+	d.eventsEncoded.Inc()
+}
+
+func (d *DestinationMetrics) EncodeFailed() {
+	if d == nil {
+		return
+	}
+	d.encodeFailures.Inc()
+}
+
+func (d *DestinationMetrics) EventBatched() {
+	if d == nil {
+		return
+	}
+	d.eventsBatched.Inc()
+}
+
+// BatchFlushed records a batch of the given size in bytes sent to the sender.
+func (d *DestinationMetrics) BatchFlushed(size int) {
+	if d == nil {
+		return
+	}
+	d.batchFlushes.Inc()
+	d.batchSize.Observe(float64(size))
+}
+
+// SinkWrite records a write to the sink that took the given duration and returned err.
+func (d *DestinationMetrics) SinkWrite(duration time.Duration, err error) {
+	if d == nil {
+		return
+	}
+
+	if err != nil {
+		d.sinkWriteFailure.Inc()
+	} else {
+		d.sinkWriteSuccess.Inc()
+	}
+	d.sinkWriteDuration.Observe(duration.Seconds())
+}
+
+func (d *DestinationMetrics) DeadLettered() {
+	if d == nil {
+		return
+	}
+	d.deadLettered.Inc()
+}
+
+// SetSenderQueueLengthFunc sets the function returning the number of payloads queued in the sender.
+func (d *DestinationMetrics) SetSenderQueueLengthFunc(fn func() int) {
+	if d == nil {
+		return
+	}
+	d.metrics.senderQueueLength.SetFunc(func() float64 { return float64(fn()) }, d.name)
+}
+
+// SetBufferLengthFunc sets the function returning the number of events buffered for the destination.
+func (d *DestinationMetrics) SetBufferLengthFunc(fn func() int) {
+	if d == nil {
+		return
+	}
+	d.metrics.destinationBufferLength.SetFunc(func() float64 { return float64(fn()) }, d.name)
+}
+
+// SetBatchBufferBytesFunc sets the function returning the size of the events buffered by the batch strategy.
+func (d *DestinationMetrics) SetBatchBufferBytesFunc(fn func() int) {
+	if d == nil {
+		return
+	}
+	d.metrics.batchBufferBytes.SetFunc(func() float64 { return float64(fn()) }, d.name)
+}
@@ -0,0 +1,419 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+
+	// ContentType is the content type of the Prometheus text exposition format.
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+var (
+	// DefaultDurationBuckets are the default histogram buckets for durations in seconds.
+	DefaultDurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the default histogram buckets for sizes in bytes.
+	DefaultSizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304}
+)
+
+// Registry holds metric families and writes them in the Prometheus text exposition format.
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]family
+}
+
+// family is a metric with all of its label combinations.
+type family interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]family{}}
+}
+
+func (r *Registry) register(name string, f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.families[name]; exists {
+		panic(fmt.Sprintf("metric %q is already registered", name))
+	}
+	r.families[name] = f
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format, sorted by name.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.RUnlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// desc describes a metric family.
+type desc struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.typ)
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf(
+			"metric %q has %d labels, but %d values are given",
+			d.name, len(d.labelNames), len(labelValues),
+		))
+	}
+
+	return strings.Join(labelValues, "\xff")
+}
+
+// writeSample writes a sample line with the labels of the family and the extra label, if any.
+func (d *desc) writeSample(
+	w *bufio.Writer,
+	suffix string,
+	labelValues []string,
+	extraName, extraValue string,
+	value float64,
+) {
+	w.WriteString(d.name)
+	w.WriteString(suffix)
+
+	if len(labelValues) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, name := range d.labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", name, escapeLabelValue(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(labelValues) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, escapeLabelValue(extraValue))
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// sortedKeys returns the keys of series in a stable order.
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	desc
+
+	mu     sync.RWMutex
+	series map[string]*Counter
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	labelValues []string
+	bits        atomic.Uint64
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{name: name, help: help, typ: typeCounter, labelNames: labelNames},
+		series: map[string]*Counter{},
+	}
+	r.register(name, c)
+
+	return c
+}
+
+// With returns the counter for the given label values, in the order of the label names.
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	key := c.key(labelValues)
+
+	c.mu.RLock()
+	counter, exists := c.series[key]
+	c.mu.RUnlock()
+	if exists {
+		return counter
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if counter, exists := c.series[key]; exists {
+		return counter
+	}
+	counter = &Counter{labelValues: slices.Clone(labelValues)}
+	c.series[key] = counter
+
+	return counter
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.series) {
+		counter := c.series[key]
+		c.writeSample(w, "", counter.labelValues, "", "", counter.Value())
+	}
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative, to the counter.
+func (c *Counter) Add(v float64) {
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	desc
+
+	buckets []float64
+
+	mu     sync.RWMutex
+	series map[string]*Histogram
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	labelValues []string
+	buckets     []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec registers a histogram with the given upper bounds of the buckets and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+
+	h := &HistogramVec{
+		desc:    desc{name: name, help: help, typ: typeHistogram, labelNames: labelNames},
+		buckets: buckets,
+		series:  map[string]*Histogram{},
+	}
+	r.register(name, h)
+
+	return h
+}
+
+// With returns the histogram for the given label values, in the order of the label names.
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	key := h.key(labelValues)
+
+	h.mu.RLock()
+	histogram, exists := h.series[key]
+	h.mu.RUnlock()
+	if exists {
+		return histogram
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if histogram, exists := h.series[key]; exists {
+		return histogram
+	}
+	histogram = &Histogram{
+		labelValues: slices.Clone(labelValues),
+		buckets:     h.buckets,
+		counts:      make([]uint64, len(h.buckets)),
+	}
+	h.series[key] = histogram
+
+	return histogram
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		histogram := h.series[key]
+
+		histogram.mu.Lock()
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += histogram.counts[i]
+			h.writeSample(w, "_bucket", histogram.labelValues, "le", formatFloat(upperBound), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", histogram.labelValues, "le", "+Inf", float64(histogram.count))
+		h.writeSample(w, "_sum", histogram.labelValues, "", "", histogram.sum)
+		h.writeSample(w, "_count", histogram.labelValues, "", "", float64(histogram.count))
+		histogram.mu.Unlock()
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// GaugeVec is a gauge partitioned by labels, whose values are read from functions when collected.
+type GaugeVec struct {
+	desc
+
+	mu     sync.RWMutex
+	series map[string]*gaugeFunc
+}
+
+type gaugeFunc struct {
+	labelValues []string
+	fn          func() float64
+}
+
+// NewGaugeVec registers a gauge with the given label names.
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{
+		desc:   desc{name: name, help: help, typ: typeGauge, labelNames: labelNames},
+		series: map[string]*gaugeFunc{},
+	}
+	r.register(name, g)
+
+	return g
+}
+
+// SetFunc sets the function returning the value of the gauge with the given label values.
+// It replaces the function previously set for the same label values.
+func (g *GaugeVec) SetFunc(fn func() float64, labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.series[key] = &gaugeFunc{labelValues: slices.Clone(labelValues), fn: fn}
+}
+
+// Delete removes the gauge with the given label values.
+func (g *GaugeVec) Delete(labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.series, key)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(g.series) {
+		gauge := g.series[key]
+		g.writeSample(w, "", gauge.labelValues, "", "", gauge.fn())
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
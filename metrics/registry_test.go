@@ -0,0 +1,78 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	r := metrics.NewRegistry()
+
+	requests := r.NewCounterVec("requests_total", "Number of requests.", "method", "path")
+	requests.With("GET", "/").Inc()
+	requests.With("POST", `/a"b\c`).Add(2.5)
+	requests.With("GET", "/").Inc()
+
+	latency := r.NewHistogramVec("latency_seconds", "Request latency\nin seconds.", []float64{1, 0.1})
+	latency.With().Observe(0.05)
+	latency.With().Observe(0.1)
+	latency.With().Observe(3)
+
+	queue := r.NewGaugeVec("queue_length", "Queue length.", "queue")
+	queue.SetFunc(func() float64 { return 3 }, "b")
+	queue.SetFunc(func() float64 { return 1 }, "a")
+	queue.SetFunc(func() float64 { return 2 }, "a")
+
+	buf := &strings.Builder{}
+	_, err := r.WriteTo(buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# HELP latency_seconds Request latency\nin seconds.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 2
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.15
+latency_seconds_count 3
+# HELP queue_length Queue length.
+# TYPE queue_length gauge
+queue_length{queue="a"} 2
+queue_length{queue="b"} 3
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/"} 2
+requests_total{method="POST",path="/a\"b\\c"} 2.5
+`, buf.String())
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	r := metrics.NewRegistry()
+	r.NewCounterVec("events_total", "Number of events.").With().Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, metrics.ContentType, rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "events_total 1\n")
+}
+
+func TestRegistry_Invalid(t *testing.T) {
+	t.Parallel()
+
+	r := metrics.NewRegistry()
+	counter := r.NewCounterVec("events_total", "Number of events.", "type")
+
+	assert.Panics(t, func() { r.NewCounterVec("events_total", "Number of events.") })
+	assert.Panics(t, func() { counter.With("a", "b") })
+}
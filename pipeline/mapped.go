@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor"
+	"github.com/mrtc0/conduit/processor/rule"
+)
+
+var _ Provider[any] = (*mappedProvider[any, any])(nil)
+
+// mappedProvider processes events of type T, maps them to U and passes them to a downstream Provider[U].
+type mappedProvider[T, U any] struct {
+	input    chan *event.Event[T]
+	mapInput chan *event.Event[T]
+
+	processor  *processor.Processor[T]
+	mapper     *processor.Mapper[T, U]
+	downstream Provider[U]
+}
+
+// NewMappedProvider creates a Provider that applies the processing rules to the events of type T,
+// maps the processed events to U with fn, and passes them to the downstream Provider,
+// which applies its own rules and sends them to its branches.
+// The options configure the processing of the events of type T; WithRouter is ignored,
+// since the events are routed by the downstream Provider.
+func NewMappedProvider[T, U any](
+	processingRules []rule.Rule[T],
+	fn processor.MapFunc[T, U],
+	downstream Provider[U],
+	opts ...PipelineOptionsFunc[T],
+) Provider[T] {
+	p := &Pipeline[T]{}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	input := make(chan *event.Event[T])
+	mapInput := make(chan *event.Event[T])
+
+	processorOpts := append([]processor.ProcessorOptionsFunc[T]{
+		processor.WithMetrics[T](p.metrics),
+		processor.WithTracer[T](p.tracer),
+		processor.WithDropHandler(p.onDrop),
+	}, p.processorOpts...)
+
+	return &mappedProvider[T, U]{
+		input:     input,
+		mapInput:  mapInput,
+		processor: processor.NewProcessor(processingRules, input, mapInput, processorOpts...),
+		mapper: processor.NewMapper(fn, mapInput, downstream.PipelineInput(),
+			processor.WithMapperMetrics[T, U](p.metrics),
+			processor.WithMapperTracer[T, U](p.tracer),
+			processor.WithMapperDropHandler[T, U](p.onDrop),
+		),
+		downstream: downstream,
+	}
+}
+
+func (p *mappedProvider[T, U]) Start() {
+	p.downstream.Start()
+	p.mapper.Start()
+	p.processor.Start()
+}
+
+func (p *mappedProvider[T, U]) Stop() error {
+	close(p.input)
+	p.processor.WaitStop()
+
+	close(p.mapInput)
+	p.mapper.WaitStop()
+
+	return p.downstream.Stop()
+}
+
+func (p *mappedProvider[T, U]) Flush(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+		p.processor.Flush(ctx)
+		p.mapper.Flush(ctx)
+	}
+
+	return p.downstream.Flush(ctx)
+}
+
+func (p *mappedProvider[T, U]) PipelineInput() chan *event.Event[T] {
+	return p.input
+}
+
+// SetRules replaces the processing rules of the events of type T, leaving the rules of the downstream Provider.
+func (p *mappedProvider[T, U]) SetRules(rules []rule.Rule[T]) error {
+	return p.processor.SetRules(rules)
+}
+
+func (p *mappedProvider[T, U]) Rules() []rule.Rule[T] {
+	return p.processor.Rules()
+}
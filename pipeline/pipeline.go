@@ -2,12 +2,16 @@ package pipeline
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
 	"github.com/mrtc0/conduit/processor"
 	"github.com/mrtc0/conduit/processor/rule"
 	"github.com/mrtc0/conduit/strategy"
+	"github.com/mrtc0/conduit/tracing"
 )
 
 type StrategyOption struct {
@@ -16,39 +20,206 @@ type StrategyOption struct {
 	FlushInterval time.Duration
 }
 
+var (
+	// DefaultBranchBufferSize is the default number of events buffered for each branch of a fan-out pipeline.
+	DefaultBranchBufferSize = 1024
+)
+
+// OverflowPolicy defines what happens to an event for a branch whose buffer is full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock waits until the buffer of the branch has room, holding up the other branches meanwhile.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDrop drops the event if the buffer of the branch is still full after the overflow timeout.
+	OverflowDrop OverflowPolicy = "drop"
+)
+
+// Branch is a destination of a Pipeline with its own sending strategy.
+type Branch[T any] struct {
+	// Name identifies the branch in logs.
+	Name string
+	// StrategyOption configures the sending strategy of the branch.
+	StrategyOption *StrategyOption
+	// SinkInput is the channel where the payloads of the branch are sent, usually the input of a Sender.
+	SinkInput chan<- *event.Payload[T]
+	// BufferSize is the number of events buffered for the branch when the Pipeline has several branches.
+	// If zero, DefaultBranchBufferSize is used.
+	BufferSize int
+	// OverflowPolicy defines what happens to an event when the buffer of the branch is full.
+	// If empty, OverflowBlock is used.
+	OverflowPolicy OverflowPolicy
+	// OverflowTimeout is how long an event waits for room in the buffer before it is dropped with OverflowDrop.
+	// If zero, the event is dropped as soon as the buffer is full.
+	OverflowTimeout time.Duration
+}
+
 type Pipeline[T any] struct {
 	input         chan *event.Event[T]
 	strategyInput chan *event.Event[T]
 
 	processor *processor.Processor[T]
-	strategy  strategy.SendingStrategy[T]
+	branches  []*branch[T]
+	// router selects the branches of each event. If nil, events are sent to every branch.
+	router  *Router[T]
+	metrics *metrics.Metrics
+	tracer  *tracing.Tracer
+	onDrop  event.DropHandler[T]
+
+	processorOpts []processor.ProcessorOptionsFunc[T]
+
+	// fanOutDone is closed when the events are distributed to the branches.
+	// It is nil when the processor sends events directly to a single branch.
+	fanOutDone chan struct{}
+}
+
+type branch[T any] struct {
+	name     string
+	input    chan *event.Event[T]
+	strategy strategy.SendingStrategy[T]
+	metrics  *metrics.DestinationMetrics
+
+	overflowPolicy  OverflowPolicy
+	overflowTimeout time.Duration
 }
 
 func NewPipeline[T any](
 	processingRules []rule.Rule[T],
 	strategyOption *StrategyOption,
 	sinkInput chan<- *event.Payload[T],
+) *Pipeline[T] {
+	return NewFanOutPipeline(processingRules, []Branch[T]{
+		{StrategyOption: strategyOption, SinkInput: sinkInput},
+	})
+}
+
+type PipelineOptionsFunc[T any] func(*Pipeline[T])
+
+// WithRouter sends each event only to the branches selected by the router.
+// The router must be created with the names of the branches of the Pipeline.
+func WithRouter[T any](router *Router[T]) PipelineOptionsFunc[T] {
+	return func(p *Pipeline[T]) {
+		p.router = router
+	}
+}
+
+// WithMetrics records the metrics of the processor, the strategies and the branches in m.
+func WithMetrics[T any](m *metrics.Metrics) PipelineOptionsFunc[T] {
+	return func(p *Pipeline[T]) {
+		p.metrics = m
+	}
+}
+
+// WithTracer creates spans for the rules and the strategies of the Pipeline.
+func WithTracer[T any](t *tracing.Tracer) PipelineOptionsFunc[T] {
+	return func(p *Pipeline[T]) {
+		p.tracer = t
+	}
+}
+
+// WithDropHandler calls h for each event dropped by the rules, the router, a full branch buffer or a strategy.
+func WithDropHandler[T any](h event.DropHandler[T]) PipelineOptionsFunc[T] {
+	return func(p *Pipeline[T]) {
+		p.onDrop = h
+	}
+}
+
+// WithProcessorOptions configures the processor of the Pipeline, such as the failure policy of its rules.
+func WithProcessorOptions[T any](opts ...processor.ProcessorOptionsFunc[T]) PipelineOptionsFunc[T] {
+	return func(p *Pipeline[T]) {
+		p.processorOpts = append(p.processorOpts, opts...)
+	}
+}
+
+// NewFanOutPipeline creates a Pipeline that sends every processed event to each of the branches,
+// or to the branches selected by the router given WithRouter.
+// With a single branch and no router, the processor sends events directly to its strategy.
+// Otherwise each branch buffers events on its own, so that a slow branch does not block the others until its buffer is full.
+func NewFanOutPipeline[T any](
+	processingRules []rule.Rule[T],
+	branches []Branch[T],
+	opts ...PipelineOptionsFunc[T],
 ) *Pipeline[T] {
 	input := make(chan *event.Event[T])
 	strategyInput := make(chan *event.Event[T])
 
-	processor := processor.NewProcessor(processingRules, input, strategyInput)
-	strategy := newStrategy(strategyInput, sinkInput, strategyOption)
-
-	return &Pipeline[T]{
-		processor:     processor,
-		strategy:      strategy,
+	p := &Pipeline[T]{
 		input:         input,
 		strategyInput: strategyInput,
 	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	processorOpts := append([]processor.ProcessorOptionsFunc[T]{
+		processor.WithMetrics[T](p.metrics),
+		processor.WithTracer[T](p.tracer),
+		processor.WithDropHandler(p.onDrop),
+	}, p.processorOpts...)
+	p.processor = processor.NewProcessor(processingRules, input, strategyInput, processorOpts...)
+
+	if len(branches) == 1 && p.router == nil {
+		b := branches[0]
+		p.branches = []*branch[T]{{
+			name:     b.Name,
+			input:    strategyInput,
+			strategy: p.newStrategy(strategyInput, b, p.metrics.Destination(b.Name)),
+		}}
+
+		return p
+	}
+
+	p.fanOutDone = make(chan struct{})
+	for _, b := range branches {
+		bufferSize := b.BufferSize
+		if bufferSize <= 0 {
+			bufferSize = DefaultBranchBufferSize
+		}
+
+		branchInput := make(chan *event.Event[T], bufferSize)
+		destinationMetrics := p.metrics.Destination(b.Name)
+		destinationMetrics.SetBufferLengthFunc(func() int {
+			return len(branchInput)
+		})
+
+		p.branches = append(p.branches, &branch[T]{
+			name:     b.Name,
+			input:    branchInput,
+			strategy: p.newStrategy(branchInput, b, destinationMetrics),
+			metrics:  destinationMetrics,
+
+			overflowPolicy:  b.OverflowPolicy,
+			overflowTimeout: b.OverflowTimeout,
+		})
+	}
+
+	return p
 }
 
 func (p *Pipeline[T]) Input() chan *event.Event[T] {
 	return p.input
 }
 
+// SetRules replaces the processing rules. See processor.Processor.SetRules.
+func (p *Pipeline[T]) SetRules(rules []rule.Rule[T]) error {
+	return p.processor.SetRules(rules)
+}
+
+// Rules returns the current processing rules.
+func (p *Pipeline[T]) Rules() []rule.Rule[T] {
+	return p.processor.Rules()
+}
+
 func (p *Pipeline[T]) Start() {
-	p.strategy.Start()
+	for _, b := range p.branches {
+		b.strategy.Start()
+	}
+
+	if p.fanOutDone != nil {
+		go p.fanOut()
+	}
+
 	p.processor.Start()
 }
 
@@ -57,25 +228,113 @@ func (p *Pipeline[T]) Stop() error {
 	p.processor.WaitStop()
 
 	close(p.strategyInput)
-	p.strategy.WaitStop()
+
+	if p.fanOutDone != nil {
+		<-p.fanOutDone
+
+		for _, b := range p.branches {
+			close(b.input)
+		}
+	}
+
+	for _, b := range p.branches {
+		b.strategy.WaitStop()
+	}
 
 	return nil
 }
 
 func (p *Pipeline[T]) Flush(ctx context.Context) {
 	p.processor.Flush(ctx)
-	p.strategy.Flush(ctx)
+
+	for _, b := range p.branches {
+		b.strategy.Flush(ctx)
+	}
+}
+
+// fanOut distributes the processed events to the branches, handling a full branch with its OverflowPolicy.
+func (p *Pipeline[T]) fanOut() {
+	defer close(p.fanOutDone)
+
+	for evt := range p.strategyInput {
+		if p.router == nil {
+			for _, b := range p.branches {
+				p.send(b, evt)
+			}
+			continue
+		}
+
+		destinations := p.router.route(evt)
+		if len(destinations) == 0 {
+			p.metrics.EventUnrouted()
+			p.onDrop.Handle(&event.DroppedEvent[T]{
+				Event:  evt,
+				Stage:  event.DropStageRoute,
+				Reason: metrics.DropReasonUnrouted,
+			})
+			continue
+		}
+
+		for _, i := range destinations {
+			p.send(p.branches[i], evt)
+		}
+	}
 }
 
-func newStrategy[T any](
+func (p *Pipeline[T]) send(b *branch[T], evt *event.Event[T]) {
+	if b.overflowPolicy != OverflowDrop {
+		b.input <- evt
+		return
+	}
+
+	select {
+	case b.input <- evt:
+		return
+	default:
+	}
+
+	if b.overflowTimeout > 0 {
+		timer := time.NewTimer(b.overflowTimeout)
+		defer timer.Stop()
+
+		select {
+		case b.input <- evt:
+			return
+		case <-timer.C:
+		}
+	}
+
+	b.metrics.EventDropped(metrics.DropReasonBufferFull)
+	log.Warn(fmt.Sprintf("buffer of destination %q is full, dropping event", b.name))
+	p.onDrop.Handle(&event.DroppedEvent[T]{
+		Event:       evt,
+		Stage:       event.DropStageBuffer,
+		Reason:      metrics.DropReasonBufferFull,
+		Destination: b.name,
+	})
+}
+
+func (p *Pipeline[T]) newStrategy(
 	inputChan strategy.InputChannel[T],
-	outputChan chan<- *event.Payload[T],
-	opt *StrategyOption,
+	b Branch[T],
+	destinationMetrics *metrics.DestinationMetrics,
 ) strategy.SendingStrategy[T] {
+	opt := b.StrategyOption
+	onDrop := p.onDrop.WithDestination(b.Name)
+
 	switch opt.StrategyType {
 	case strategy.Batch:
-		return strategy.NewBatchStrategy(inputChan, outputChan, opt.FlushInterval, opt.BufferLimit)
+		return strategy.NewBatchStrategy(
+			inputChan, b.SinkInput, opt.FlushInterval, opt.BufferLimit,
+			strategy.WithMetrics[T](destinationMetrics),
+			strategy.WithTracer[T](p.tracer),
+			strategy.WithDropHandler(onDrop),
+		)
 	default: // Default to Stream strategy if no specific type is provided
-		return strategy.NewStreamStrategy(inputChan, outputChan)
+		return strategy.NewStreamStrategy(inputChan, b.SinkInput,
+			strategy.WithStreamMetrics[T](destinationMetrics),
+			strategy.WithStreamTracer[T](p.tracer),
+			strategy.WithStreamDropHandler(onDrop),
+		)
 	}
 }
@@ -2,14 +2,20 @@ package pipeline_test
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/pipeline"
 	"github.com/mrtc0/conduit/processor/rule"
 	"github.com/mrtc0/conduit/sender"
 	"github.com/mrtc0/conduit/sink"
 	"github.com/mrtc0/conduit/strategy"
 	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPipeline(t *testing.T) {
@@ -34,3 +40,157 @@ func TestPipeline(t *testing.T) {
 
 	p.Flush(context.Background())
 }
+
+func TestFanOutPipeline(t *testing.T) {
+	t.Parallel()
+
+	fast := make(chan *event.Payload[testutils.DummyEvent], 10)
+	// The slow branch never reads its payloads, so only its buffer and the strategy can hold events.
+	slow := make(chan *event.Payload[testutils.DummyEvent])
+
+	p := pipeline.NewFanOutPipeline(
+		[]rule.Rule[testutils.DummyEvent]{},
+		[]pipeline.Branch[testutils.DummyEvent]{
+			{Name: "fast", StrategyOption: &pipeline.StrategyOption{StrategyType: strategy.Stream}, SinkInput: fast},
+			{
+				Name:           "slow",
+				StrategyOption: &pipeline.StrategyOption{StrategyType: strategy.Stream},
+				SinkInput:      slow,
+				BufferSize:     1,
+				OverflowPolicy: pipeline.OverflowDrop,
+			},
+		},
+	)
+	p.Start()
+
+	for i := range 5 {
+		p.Input() <- event.NewEvent(event.NewRawEvent(testutils.DummyEvent{ID: strconv.Itoa(i)}, nil))
+	}
+
+	for i := range 5 {
+		select {
+		case payload := <-fast:
+			assert.Equal(t, fmt.Sprintf("{\"id\":\"%d\",\"name\":\"\"}\n", i), string(payload.JSONEncodedContent))
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for payload of the fast branch")
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		assert.NoError(t, p.Stop())
+	}()
+
+	// The slow branch holds at most one event in its strategy and one in its buffer.
+	received := 0
+	for done := false; !done; {
+		select {
+		case <-slow:
+			received++
+		case <-stopped:
+			done = true
+		}
+	}
+	assert.LessOrEqual(t, received, 2)
+	assert.GreaterOrEqual(t, received, 1)
+}
+
+func TestFanOutPipeline_Overflow(t *testing.T) {
+	t.Parallel()
+
+	newPipeline := func(
+		fast, slow chan *event.Payload[testutils.DummyEvent],
+		policy pipeline.OverflowPolicy,
+		timeout time.Duration,
+		opts ...pipeline.PipelineOptionsFunc[testutils.DummyEvent],
+	) *pipeline.Pipeline[testutils.DummyEvent] {
+		return pipeline.NewFanOutPipeline(
+			[]rule.Rule[testutils.DummyEvent]{},
+			[]pipeline.Branch[testutils.DummyEvent]{
+				{Name: "fast", StrategyOption: &pipeline.StrategyOption{StrategyType: strategy.Stream}, SinkInput: fast},
+				{
+					Name:            "slow",
+					StrategyOption:  &pipeline.StrategyOption{StrategyType: strategy.Stream},
+					SinkInput:       slow,
+					BufferSize:      1,
+					OverflowPolicy:  policy,
+					OverflowTimeout: timeout,
+				},
+			},
+			opts...,
+		)
+	}
+	write := func(p *pipeline.Pipeline[testutils.DummyEvent]) {
+		go func() {
+			for i := range 5 {
+				p.Input() <- event.NewEvent(event.NewRawEvent(testutils.DummyEvent{ID: strconv.Itoa(i)}, nil))
+			}
+		}()
+	}
+	receive := func(t *testing.T, ch chan *event.Payload[testutils.DummyEvent], n int) {
+		t.Helper()
+		for i := range n {
+			select {
+			case payload := <-ch:
+				assert.Equal(t, fmt.Sprintf("{\"id\":\"%d\",\"name\":\"\"}\n", i), string(payload.JSONEncodedContent))
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for payload %d", i)
+			}
+		}
+	}
+
+	t.Run("blocks by default", func(t *testing.T) {
+		t.Parallel()
+
+		fast := make(chan *event.Payload[testutils.DummyEvent], 10)
+		slow := make(chan *event.Payload[testutils.DummyEvent])
+		p := newPipeline(fast, slow, "", 0)
+		p.Start()
+		write(p)
+
+		// the fast branch is held up once the buffer of the slow branch is full
+		assert.Never(t, func() bool { return len(fast) == 5 }, 100*time.Millisecond, 10*time.Millisecond)
+
+		receive(t, slow, 5)
+		receive(t, fast, 5)
+		assert.NoError(t, p.Stop())
+	})
+
+	t.Run("drops after the timeout", func(t *testing.T) {
+		t.Parallel()
+
+		var dropped atomic.Int32
+		fast := make(chan *event.Payload[testutils.DummyEvent], 10)
+		slow := make(chan *event.Payload[testutils.DummyEvent])
+		p := newPipeline(fast, slow, pipeline.OverflowDrop, 20*time.Millisecond,
+			pipeline.WithDropHandler(func(d *event.DroppedEvent[testutils.DummyEvent]) {
+				assert.Equal(t, "slow", d.Destination)
+				assert.Equal(t, event.DropStageBuffer, d.Stage)
+				dropped.Add(1)
+			}),
+		)
+		p.Start()
+		write(p)
+
+		receive(t, fast, 5)
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			assert.NoError(t, p.Stop())
+		}()
+
+		received := 0
+		for done := false; !done; {
+			select {
+			case <-slow:
+				received++
+			case <-stopped:
+				done = true
+			}
+		}
+		assert.Positive(t, dropped.Load())
+		assert.Equal(t, 5, received+int(dropped.Load()))
+	})
+}
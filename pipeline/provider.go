@@ -14,6 +14,10 @@ type Provider[T any] interface {
 	Stop() error
 	Flush(ctx context.Context) error
 	PipelineInput() chan *event.Event[T]
+	// SetRules replaces the processing rules of the events of type T.
+	SetRules(rules []rule.Rule[T]) error
+	// Rules returns the current processing rules of the events of type T.
+	Rules() []rule.Rule[T]
 }
 
 type provider[T any] struct {
@@ -30,6 +34,17 @@ func NewProvider[T any](
 	}
 }
 
+// NewFanOutProvider creates a Provider whose pipeline sends every processed event to each of the branches.
+func NewFanOutProvider[T any](
+	processingRules []rule.Rule[T],
+	branches []Branch[T],
+	opts ...PipelineOptionsFunc[T],
+) *provider[T] {
+	return &provider[T]{
+		pipeline: NewFanOutPipeline(processingRules, branches, opts...),
+	}
+}
+
 func (p *provider[T]) Start() {
 	p.pipeline.Start()
 }
@@ -52,3 +67,11 @@ func (p *provider[T]) Flush(ctx context.Context) error {
 func (p *provider[T]) PipelineInput() chan *event.Event[T] {
 	return p.pipeline.Input()
 }
+
+func (p *provider[T]) SetRules(rules []rule.Rule[T]) error {
+	return p.pipeline.SetRules(rules)
+}
+
+func (p *provider[T]) Rules() []rule.Rule[T] {
+	return p.pipeline.Rules()
+}
@@ -0,0 +1,209 @@
+package pipeline
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+	"github.com/tidwall/gjson"
+)
+
+// TagRoute is the tag that overrides the routes of an event.
+// Processing rules can set it to a comma separated list of destination names
+// to send the event to exactly those destinations.
+const TagRoute = "conduit.route"
+
+// Route sends the events that match all of its conditions to the given destinations.
+type Route struct {
+	// Name identifies the route in errors.
+	Name string
+	// Tags matches events whose tags have the given values.
+	Tags map[string]string
+	// Fields matches events whose content has the given values at the given gjson paths.
+	Fields map[string]string
+	// Destinations are the names of the destinations the matching events are sent to.
+	Destinations []string
+	// Continue also evaluates the following routes when the route matches,
+	// so that the event is sent to the destinations of every matching route.
+	// By default, the first matching route wins.
+	Continue bool
+}
+
+// Routing decides which branches of a Pipeline receive an event.
+type Routing struct {
+	// Routes are evaluated in order.
+	Routes []Route
+	// Default are the names of the destinations of the events that match no route.
+	// If empty, the events that match no route are dropped.
+	Default []string
+}
+
+// Router routes events to the branches of a Pipeline.
+type Router[T any] struct {
+	routes   []compiledRoute
+	defaults []int
+	branches map[string]int
+}
+
+type compiledRoute struct {
+	route        Route
+	destinations []int
+}
+
+// NewRouter creates a Router for the branches with the given names.
+// It returns an error if a route refers to an unknown destination.
+func NewRouter[T any](routing Routing, branchNames []string) (*Router[T], error) {
+	r := &Router[T]{
+		branches: make(map[string]int, len(branchNames)),
+	}
+
+	for i, name := range branchNames {
+		if _, exists := r.branches[name]; exists {
+			return nil, fmt.Errorf("duplicate destination name %q", name)
+		}
+		r.branches[name] = i
+	}
+
+	for i, route := range routing.Routes {
+		if len(route.Tags) == 0 && len(route.Fields) == 0 {
+			return nil, fmt.Errorf("route %s has no conditions", routeName(route, i))
+		}
+
+		destinations, err := r.resolve(route.Destinations)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route %s: %w", routeName(route, i), err)
+		}
+
+		r.routes = append(r.routes, compiledRoute{route: route, destinations: destinations})
+	}
+
+	defaults, err := r.resolve(routing.Default)
+	if err != nil {
+		return nil, fmt.Errorf("invalid default route: %w", err)
+	}
+	r.defaults = defaults
+
+	return r, nil
+}
+
+func routeName(route Route, index int) string {
+	if route.Name != "" {
+		return fmt.Sprintf("%q", route.Name)
+	}
+
+	return fmt.Sprintf("#%d", index)
+}
+
+func (r *Router[T]) resolve(names []string) ([]int, error) {
+	indexes := make([]int, 0, len(names))
+	for _, name := range names {
+		index, exists := r.branches[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown destination %q", name)
+		}
+		indexes = append(indexes, index)
+	}
+
+	return indexes, nil
+}
+
+// route returns the indexes of the branches the event is sent to.
+func (r *Router[T]) route(evt *event.Event[T]) []int {
+	if names, ok := evt.Tags[TagRoute]; ok {
+		return r.routeByTag(names)
+	}
+
+	var (
+		destinations []int
+		content      []byte
+		matched      bool
+	)
+
+	for _, compiled := range r.routes {
+		if !matchTags(compiled.route.Tags, evt.Tags) {
+			continue
+		}
+
+		if len(compiled.route.Fields) > 0 {
+			if content == nil {
+				data, err := evt.MarshalJSON()
+				if err != nil {
+					log.Warn(fmt.Sprintf("failed to marshal event content for routing: %v", err))
+					continue
+				}
+				content = data
+			}
+
+			if !matchFields(compiled.route.Fields, content) {
+				continue
+			}
+		}
+
+		matched = true
+		destinations = appendUnique(destinations, compiled.destinations...)
+
+		if !compiled.route.Continue {
+			break
+		}
+	}
+
+	if !matched {
+		return r.defaults
+	}
+
+	return destinations
+}
+
+func (r *Router[T]) routeByTag(names string) []int {
+	var destinations []int
+
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		index, exists := r.branches[name]
+		if !exists {
+			log.Warn(fmt.Sprintf("event is routed to unknown destination %q", name))
+			continue
+		}
+
+		destinations = appendUnique(destinations, index)
+	}
+
+	return destinations
+}
+
+func matchTags(want map[string]string, tags event.Tags) bool {
+	for key, value := range want {
+		if actual, ok := tags[key]; !ok || actual != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchFields(want map[string]string, content []byte) bool {
+	for path, value := range want {
+		result := gjson.GetBytes(content, path)
+		if !result.Exists() || result.String() != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func appendUnique(indexes []int, values ...int) []int {
+	for _, value := range values {
+		if !slices.Contains(indexes, value) {
+			indexes = append(indexes, value)
+		}
+	}
+
+	return indexes
+}
@@ -0,0 +1,114 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Route(t *testing.T) {
+	t.Parallel()
+
+	branches := []string{"archive", "alerts", "audit"}
+
+	testCases := map[string]struct {
+		routing Routing
+		tags    event.Tags
+		content testutils.DummyEvent
+		want    []int
+	}{
+		"first matching route wins": {
+			routing: Routing{Routes: []Route{
+				{Tags: map[string]string{"env": "prod"}, Destinations: []string{"alerts"}},
+				{Tags: map[string]string{"env": "prod"}, Destinations: []string{"audit"}},
+			}},
+			tags: event.Tags{"env": "prod"},
+			want: []int{1},
+		},
+		"continue sends to every matching route": {
+			routing: Routing{Routes: []Route{
+				{Tags: map[string]string{"env": "prod"}, Destinations: []string{"alerts", "archive"}, Continue: true},
+				{Fields: map[string]string{"name": "login"}, Destinations: []string{"audit", "archive"}},
+			}},
+			tags:    event.Tags{"env": "prod"},
+			content: testutils.DummyEvent{Name: "login"},
+			want:    []int{1, 0, 2},
+		},
+		"all conditions must match": {
+			routing: Routing{
+				Routes: []Route{{
+					Tags:         map[string]string{"env": "prod"},
+					Fields:       map[string]string{"name": "login"},
+					Destinations: []string{"audit"},
+				}},
+				Default: []string{"archive"},
+			},
+			tags:    event.Tags{"env": "prod"},
+			content: testutils.DummyEvent{Name: "logout"},
+			want:    []int{0},
+		},
+		"no match without default route": {
+			routing: Routing{Routes: []Route{
+				{Fields: map[string]string{"id": "1"}, Destinations: []string{"audit"}},
+			}},
+			content: testutils.DummyEvent{ID: "2"},
+			want:    []int{},
+		},
+		"route tag overrides routes": {
+			routing: Routing{Routes: []Route{
+				{Tags: map[string]string{"env": "prod"}, Destinations: []string{"alerts"}},
+			}},
+			tags: event.Tags{"env": "prod", TagRoute: "audit, unknown,archive"},
+			want: []int{2, 0},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			router, err := NewRouter[testutils.DummyEvent](tc.routing, branches)
+			require.NoError(t, err)
+
+			evt := event.NewEvent(event.NewRawEvent(tc.content, &event.Metadata{Tags: tc.tags}))
+			assert.Equal(t, tc.want, router.route(evt))
+		})
+	}
+}
+
+func TestNewRouter_Invalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		routing  Routing
+		branches []string
+	}{
+		"unknown destination": {
+			routing:  Routing{Routes: []Route{{Tags: map[string]string{"a": "b"}, Destinations: []string{"missing"}}}},
+			branches: []string{"archive"},
+		},
+		"unknown default destination": {
+			routing:  Routing{Default: []string{"missing"}},
+			branches: []string{"archive"},
+		},
+		"route without conditions": {
+			routing:  Routing{Routes: []Route{{Destinations: []string{"archive"}}}},
+			branches: []string{"archive"},
+		},
+		"duplicate destination names": {
+			branches: []string{"archive", "archive"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewRouter[testutils.DummyEvent](tc.routing, tc.branches)
+			assert.Error(t, err)
+		})
+	}
+}
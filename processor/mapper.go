@@ -0,0 +1,155 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/tracing"
+)
+
+const (
+	// ReasonMapFailed is the reason of the events dropped because they failed to be mapped.
+	ReasonMapFailed = "map_failed"
+	// ReasonMappedToNil is the reason of the events dropped because they were mapped to nil.
+	ReasonMappedToNil = "mapped_to_nil"
+)
+
+// MapFunc maps an event to an event of another type, usually created with event.Map
+// so that the metadata is carried over.
+// If it returns a nil event without an error, the event is dropped.
+type MapFunc[T, U any] func(*event.Event[T]) (*event.Event[U], error)
+
+// Mapper is a stage mapping the events from a Processor[T] to the input of a Processor[U].
+type Mapper[T, U any] struct {
+	fn         MapFunc[T, U]
+	inputChan  chan *event.Event[T]
+	outputChan chan *event.Event[U]
+
+	metrics *metrics.Metrics
+	tracer  *tracing.Tracer
+	onDrop  event.DropHandler[T]
+
+	quit chan struct{}
+}
+
+type MapperOptionsFunc[T, U any] func(*Mapper[T, U])
+
+// WithMapperMetrics records the events that failed to be mapped in m.
+func WithMapperMetrics[T, U any](m *metrics.Metrics) MapperOptionsFunc[T, U] {
+	return func(mp *Mapper[T, U]) {
+		mp.metrics = m
+	}
+}
+
+// WithMapperTracer creates a span for each mapped event.
+func WithMapperTracer[T, U any](t *tracing.Tracer) MapperOptionsFunc[T, U] {
+	return func(mp *Mapper[T, U]) {
+		mp.tracer = t
+	}
+}
+
+// WithMapperDropHandler calls h for each event that failed to be mapped or was mapped to nil.
+func WithMapperDropHandler[T, U any](h event.DropHandler[T]) MapperOptionsFunc[T, U] {
+	return func(mp *Mapper[T, U]) {
+		mp.onDrop = h
+	}
+}
+
+func NewMapper[T, U any](
+	fn MapFunc[T, U],
+	inputChan chan *event.Event[T],
+	outputChan chan *event.Event[U],
+	opts ...MapperOptionsFunc[T, U],
+) *Mapper[T, U] {
+	m := &Mapper[T, U]{
+		fn:         fn,
+		inputChan:  inputChan,
+		outputChan: outputChan,
+		quit:       make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+func (m *Mapper[T, U]) Start() {
+	go m.run()
+}
+
+func (m *Mapper[T, U]) WaitStop() {
+	<-m.quit
+}
+
+func (m *Mapper[T, U]) Flush(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	default:
+		if len(m.inputChan) == 0 {
+			return
+		}
+		m.mapMessage(<-m.inputChan)
+	}
+}
+
+func (m *Mapper[T, U]) run() {
+	defer close(m.quit)
+
+	for evt := range m.inputChan {
+		m.mapMessage(evt)
+	}
+}
+
+func (m *Mapper[T, U]) mapMessage(evt *event.Event[T]) {
+	if mapped := m.Map(evt); mapped != nil {
+		m.outputChan <- mapped
+	}
+}
+
+// Map maps the event, returning nil if it is dropped.
+func (m *Mapper[T, U]) Map(evt *event.Event[T]) *event.Event[U] {
+	span := m.tracer.Start(&evt.Metadata, "conduit.map")
+	defer span.End()
+
+	mapped, err := m.safeMap(evt)
+	if err != nil {
+		tracing.RecordError(span, err)
+		m.metrics.MapFailed()
+		log.Warn(fmt.Sprintf("failed to map event: %v", err))
+		m.onDrop.Handle(&event.DroppedEvent[T]{
+			Event:  evt,
+			Stage:  event.DropStageMap,
+			Reason: ReasonMapFailed,
+			Err:    err,
+		})
+		return nil
+	}
+	if mapped == nil {
+		m.onDrop.Handle(&event.DroppedEvent[T]{
+			Event:  evt,
+			Stage:  event.DropStageMap,
+			Reason: ReasonMappedToNil,
+		})
+		return nil
+	}
+
+	return mapped
+}
+
+// safeMap calls the map function, recovering from a panic in it.
+func (m *Mapper[T, U]) safeMap(evt *event.Event[T]) (mapped *event.Event[U], err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Error(fmt.Sprintf("map function panicked: %v\n%s", v, debug.Stack()))
+			mapped, err = nil, fmt.Errorf("map function panicked: %v", v)
+		}
+	}()
+
+	return m.fn(evt)
+}
@@ -0,0 +1,89 @@
+package processor_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapper_Map(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		fn          processor.MapFunc[string, testutils.DummyEvent]
+		want        *testutils.DummyEvent
+		wantReason  string
+		wantErrText string
+	}{
+		"mapped": {
+			fn: func(evt *event.Event[string]) (*event.Event[testutils.DummyEvent], error) {
+				return event.Map(evt, testutils.DummyEvent{ID: evt.Content()}), nil
+			},
+			want: &testutils.DummyEvent{ID: "1"},
+		},
+		"error": {
+			fn: func(evt *event.Event[string]) (*event.Event[testutils.DummyEvent], error) {
+				return nil, errors.New("invalid")
+			},
+			wantReason:  processor.ReasonMapFailed,
+			wantErrText: "invalid",
+		},
+		"nil": {
+			fn: func(evt *event.Event[string]) (*event.Event[testutils.DummyEvent], error) {
+				return nil, nil
+			},
+			wantReason: processor.ReasonMappedToNil,
+		},
+		"panic": {
+			fn: func(evt *event.Event[string]) (*event.Event[testutils.DummyEvent], error) {
+				_, err := strconv.Atoi(evt.Content())
+				panic(err)
+			},
+			wantReason:  processor.ReasonMapFailed,
+			wantErrText: "map function panicked",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var dropped []*event.DroppedEvent[string]
+			m := processor.NewMapper(tc.fn, nil, nil,
+				processor.WithMapperDropHandler[string, testutils.DummyEvent](func(d *event.DroppedEvent[string]) {
+					dropped = append(dropped, d)
+				}),
+			)
+
+			input := event.NewEvent(&event.RawEvent[string]{
+				Content:  "1",
+				Metadata: &event.Metadata{Tags: event.Tags{"source": "test"}},
+			})
+			got := m.Map(input)
+
+			if tc.want != nil {
+				require.NotNil(t, got)
+				assert.Equal(t, *tc.want, got.Content())
+				assert.Equal(t, event.Tags{"source": "test"}, got.Tags)
+				assert.Empty(t, dropped)
+				return
+			}
+
+			assert.Nil(t, got)
+			require.Len(t, dropped, 1)
+			assert.Equal(t, event.DropStageMap, dropped[0].Stage)
+			assert.Equal(t, tc.wantReason, dropped[0].Reason)
+			if tc.wantErrText != "" {
+				assert.ErrorContains(t, dropped[0].Err, tc.wantErrText)
+			} else {
+				assert.NoError(t, dropped[0].Err)
+			}
+		})
+	}
+}
@@ -2,34 +2,186 @@ package processor
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
 	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/sink"
 	"github.com/mrtc0/conduit/strategy"
+	"github.com/mrtc0/conduit/tracing"
 )
 
+// ErrHalted is the reason of the events dropped after a rule with rule.FailureHalt failed.
+var ErrHalted = errors.New("processor is halted")
+
+// ReasonEmptySplit is the reason of the events dropped because a rule split them into no events.
+const ReasonEmptySplit = "empty_split"
+
 type Processor[T any] struct {
-	rules      []rule.Rule[T]
+	// rules is the current rule set, which is replaced as a whole by SetRules.
+	rules atomic.Pointer[ruleSet[T]]
+	// rulesMu serializes the replacements of the rules with starting and stopping them.
+	rulesMu sync.Mutex
+	// started reports whether the rules are started, from Start until the processor stops.
+	started bool
+
 	inputChan  chan *event.Event[T]
 	outputChan chan *event.Event[T]
 
+	metrics *metrics.Metrics
+	tracer  *tracing.Tracer
+	onDrop  event.DropHandler[T]
+
+	failurePolicy  rule.FailurePolicy
+	deadLetterSink sink.Sink[T]
+	deadLetterMu   sync.Mutex
+	onHalt         func(err error)
+	haltErr        atomic.Pointer[error]
+	timeNowFunc    func() time.Time
+
 	quit chan struct{}
 }
 
+// ruleSet is a list of rules with their names used in metrics and their failure policies.
+type ruleSet[T any] struct {
+	rules    []rule.Rule[T]
+	names    []string
+	policies []rule.FailurePolicy
+}
+
+func newRuleSet[T any](rules []rule.Rule[T], fallback rule.FailurePolicy) *ruleSet[T] {
+	rs := &ruleSet[T]{
+		rules:    rules,
+		names:    make([]string, len(rules)),
+		policies: make([]rule.FailurePolicy, len(rules)),
+	}
+	for i, r := range rules {
+		rs.names[i] = rule.Name(r)
+		if rs.names[i] == "" {
+			rs.names[i] = fmt.Sprintf("#%d", i)
+		}
+		rs.policies[i] = rule.PolicyOf(r, fallback)
+	}
+
+	return rs
+}
+
+type ProcessorOptionsFunc[T any] func(*Processor[T])
+
+// WithMetrics records the received, filtered, transformed and processed events in m.
+func WithMetrics[T any](m *metrics.Metrics) ProcessorOptionsFunc[T] {
+	return func(p *Processor[T]) {
+		p.metrics = m
+	}
+}
+
+// WithTracer creates a span for each rule applied to an event.
+func WithTracer[T any](t *tracing.Tracer) ProcessorOptionsFunc[T] {
+	return func(p *Processor[T]) {
+		p.tracer = t
+	}
+}
+
+// WithDropHandler calls h for each event dropped by a filter rule.
+func WithDropHandler[T any](h event.DropHandler[T]) ProcessorOptionsFunc[T] {
+	return func(p *Processor[T]) {
+		p.onDrop = h
+	}
+}
+
+// WithFailurePolicy sets the failure policy of the rules that do not have their own.
+// If not specified, rule.FailureSkip is used.
+func WithFailurePolicy[T any](policy rule.FailurePolicy) ProcessorOptionsFunc[T] {
+	return func(p *Processor[T]) {
+		p.failurePolicy = policy
+	}
+}
+
+// WithDeadLetterSink sets the sink where the events are written when a rule with rule.FailureDeadLetter fails.
+// Without it, such events are dropped.
+func WithDeadLetterSink[T any](s sink.Sink[T]) ProcessorOptionsFunc[T] {
+	return func(p *Processor[T]) {
+		p.deadLetterSink = s
+	}
+}
+
+// WithHaltHandler calls fn with the error of the rule when a rule with rule.FailureHalt fails.
+// It is called once from the goroutine of the processor.
+func WithHaltHandler[T any](fn func(err error)) ProcessorOptionsFunc[T] {
+	return func(p *Processor[T]) {
+		p.onHalt = fn
+	}
+}
+
 func NewProcessor[T any](
 	rules []rule.Rule[T],
 	inputChan chan *event.Event[T],
 	outputChan strategy.InputChannel[T],
+	opts ...ProcessorOptionsFunc[T],
 ) *Processor[T] {
-	return &Processor[T]{
-		rules:      rules,
-		inputChan:  inputChan,
-		outputChan: outputChan,
-		quit:       make(chan struct{}),
+	p := &Processor[T]{
+		inputChan:   inputChan,
+		outputChan:  outputChan,
+		timeNowFunc: time.Now,
+		quit:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(p)
 	}
+
+	p.rules.Store(newRuleSet(rules, p.failurePolicy))
+
+	return p
 }
 
+// SetRules replaces the rules of the processor.
+// An event being processed is processed by the previous rules to the end, and the following events by the new ones.
+// If one of the rules is nil, the rules are not replaced and an error is returned.
+// If the processor is running, the new rules that are rule.Starter are started and the previous ones stopped.
+func (p *Processor[T]) SetRules(rules []rule.Rule[T]) error {
+	for i, r := range rules {
+		if r == nil {
+			return fmt.Errorf("rule #%d is nil", i)
+		}
+	}
+
+	p.rulesMu.Lock()
+	defer p.rulesMu.Unlock()
+
+	// the new rules are started first, so that the rules kept from the previous ones keep working
+	if p.started {
+		startRules(rules)
+	}
+	previous := p.rules.Swap(newRuleSet(slices.Clone(rules), p.failurePolicy))
+	if p.started {
+		stopRules(previous.rules)
+	}
+
+	return nil
+}
+
+// Rules returns the current rules of the processor.
+func (p *Processor[T]) Rules() []rule.Rule[T] {
+	return slices.Clone(p.rules.Load().rules)
+}
+
+// Start starts the rules that are rule.Starter, and processes the events until the input channel is closed.
 func (p *Processor[T]) Start() {
+	p.rulesMu.Lock()
+	p.started = true
+	startRules(p.rules.Load().rules)
+	p.rulesMu.Unlock()
+
 	go p.run()
 }
 
@@ -61,17 +213,81 @@ func (p *Processor[T]) run() {
 	for evt := range p.inputChan {
 		p.processMessage(evt)
 	}
+
+	p.rulesMu.Lock()
+	p.started = false
+	stopRules(p.rules.Load().rules)
+	p.rulesMu.Unlock()
+}
+
+func startRules[T any](rules []rule.Rule[T]) {
+	for _, r := range rules {
+		if starter, ok := r.(rule.Starter); ok {
+			starter.Start()
+		}
+	}
+}
+
+func stopRules[T any](rules []rule.Rule[T]) {
+	for _, r := range rules {
+		if starter, ok := r.(rule.Starter); ok {
+			starter.Stop()
+		}
+	}
+}
+
+// Err returns the error of the rule that halted the processor, or nil if it is not halted.
+func (p *Processor[T]) Err() error {
+	if err := p.haltErr.Load(); err != nil {
+		return *err
+	}
+
+	return nil
 }
 
 func (p *Processor[T]) processMessage(evt *event.Event[T]) {
-	if passed := p.ApplyRules(evt); passed {
-		p.outputChan <- evt
+	p.metrics.EventReceived()
+
+	if err := p.Err(); err != nil {
+		p.onDrop.Handle(&event.DroppedEvent[T]{
+			Event:  evt,
+			Stage:  event.DropStageProcess,
+			Reason: ErrHalted.Error(),
+			Err:    err,
+		})
+		return
+	}
+
+	for _, out := range p.Process(evt) {
+		p.metrics.EventProcessed()
+		p.outputChan <- out
 	}
 }
 
+// ApplyRules applies the rules to the event and reports whether any event passed all of them.
+// Since rules may replace or split the event, use Process to get the events that passed.
 func (p *Processor[T]) ApplyRules(evt *event.Event[T]) bool {
-	for _, r := range p.rules {
-		result := r.Apply(evt)
+	return len(p.Process(evt)) > 0
+}
+
+// Process applies the rules to the event and returns the events that passed all of them.
+// It returns no events if the event was dropped, and several events if it was split.
+func (p *Processor[T]) Process(evt *event.Event[T]) []*event.Event[T] {
+	// the rule set is loaded once, so that the event is not processed by a mix of old and new rules
+	return p.applyRules(p.rules.Load(), 0, evt)
+}
+
+// applyRules applies the rules from the start-th one to the event.
+func (p *Processor[T]) applyRules(rs *ruleSet[T], start int, evt *event.Event[T]) []*event.Event[T] {
+	for i := start; i < len(rs.rules); i++ {
+		result := p.applyRule(rs, i, evt)
+
+		if errorResult, ok := result.(rule.ErrorResult[T]); ok {
+			if passed := p.handleFailure(rs, i, evt, errorResult.Err); !passed {
+				return nil
+			}
+			continue
+		}
 
 		if result.TypeOf() == rule.TypeFilter {
 			// cast to FilterRuleResult
@@ -81,7 +297,14 @@ func (p *Processor[T]) ApplyRules(evt *event.Event[T]) bool {
 				continue
 			}
 			if filterResult.Drop {
-				return false
+				p.metrics.EventFiltered(rs.names[i], filterResult.Reason)
+				p.onDrop.Handle(&event.DroppedEvent[T]{
+					Event:  evt,
+					Stage:  event.DropStageProcess,
+					Rule:   rs.names[i],
+					Reason: filterResult.Reason,
+				})
+				return nil
 			}
 		}
 
@@ -95,8 +318,142 @@ func (p *Processor[T]) ApplyRules(evt *event.Event[T]) bool {
 			if transformResult.Event != nil {
 				evt = transformResult.Event // Update the event with the transformed one
 			}
+			p.metrics.EventTransformed(rs.names[i])
+		}
+
+		if result.TypeOf() == rule.TypeSplit {
+			splitResult, ok := result.(rule.SplitResult[T])
+			if !ok {
+				continue
+			}
+			return p.split(rs, i, evt, splitResult.Events)
+		}
+	}
+
+	return []*event.Event[T]{evt} // Message passed all rules
+}
+
+// split passes the events split from evt by the i-th rule to the remaining rules.
+func (p *Processor[T]) split(rs *ruleSet[T], i int, evt *event.Event[T], children []*event.Event[T]) []*event.Event[T] {
+	var events []*event.Event[T]
+	for _, child := range children {
+		if child != nil {
+			events = append(events, child)
 		}
 	}
 
-	return true // Message passed all rules
+	p.metrics.EventSplit(rs.names[i], len(events))
+	if len(events) == 0 {
+		p.metrics.EventFiltered(rs.names[i], ReasonEmptySplit)
+		p.onDrop.Handle(&event.DroppedEvent[T]{
+			Event:  evt,
+			Stage:  event.DropStageProcess,
+			Rule:   rs.names[i],
+			Reason: ReasonEmptySplit,
+		})
+		return nil
+	}
+
+	var passed []*event.Event[T]
+	for _, child := range events {
+		passed = append(passed, p.applyRules(rs, i+1, child)...)
+	}
+
+	return passed
+}
+
+// applyRule applies the i-th rule to the event in a span.
+func (p *Processor[T]) applyRule(rs *ruleSet[T], i int, evt *event.Event[T]) rule.Result[T] {
+	span := p.tracer.Start(&evt.Metadata, "conduit.rule "+rs.names[i],
+		trace.WithAttributes(tracing.AttributeRuleName.String(rs.names[i])),
+	)
+	defer span.End()
+
+	result := rule.SafeApply(rs.rules[i], evt)
+
+	if errorResult, ok := result.(rule.ErrorResult[T]); ok {
+		tracing.RecordError(span, errorResult.Err)
+	}
+	if splitResult, ok := result.(rule.SplitResult[T]); ok {
+		span.SetAttributes(tracing.AttributeRuleSplit.Int(len(splitResult.Events)))
+	}
+	if filterResult, ok := result.(rule.FilterResult[T]); ok {
+		span.SetAttributes(tracing.AttributeRuleDropped.Bool(filterResult.Drop))
+		if filterResult.Drop && filterResult.Reason != "" {
+			span.SetAttributes(tracing.AttributeRuleReason.String(filterResult.Reason))
+		}
+	}
+
+	return result
+}
+
+// handleFailure handles an event that the i-th rule failed to process according to the failure policy of the rule.
+// It returns whether the event is passed to the next rule.
+func (p *Processor[T]) handleFailure(rs *ruleSet[T], i int, evt *event.Event[T], err error) bool {
+	name, policy := rs.names[i], rs.policies[i]
+	p.metrics.RuleFailed(name, policy.String())
+
+	var panicErr *rule.PanicError
+	if errors.As(err, &panicErr) {
+		log.Error(fmt.Sprintf("rule %q panicked: %v\n%s", name, panicErr.Value, panicErr.Stack))
+	} else {
+		log.Warn(fmt.Sprintf("rule %q failed: %v", name, err))
+	}
+
+	switch policy {
+	case rule.FailureSkip:
+		return true
+	case rule.FailureDeadLetter:
+		if p.writeDeadLetter(name, evt, err) {
+			return false
+		}
+	case rule.FailureHalt:
+		p.halt(fmt.Errorf("rule %q failed: %w", name, err))
+	}
+
+	p.onDrop.Handle(&event.DroppedEvent[T]{
+		Event:  evt,
+		Stage:  event.DropStageProcess,
+		Rule:   name,
+		Reason: "rule failed",
+		Err:    err,
+	})
+
+	return false
+}
+
+// writeDeadLetter writes the event to the dead-letter sink and returns whether it was written.
+func (p *Processor[T]) writeDeadLetter(ruleName string, evt *event.Event[T], ruleErr error) bool {
+	if p.deadLetterSink == nil {
+		log.Warn(fmt.Sprintf("no dead-letter sink for rule %q, dropping event", ruleName))
+		return false
+	}
+
+	payload, err := sink.NewRuleDeadLetterPayload(evt, ruleName, ruleErr, p.timeNowFunc())
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to create dead-letter payload: %v", err))
+		return false
+	}
+
+	p.deadLetterMu.Lock()
+	defer p.deadLetterMu.Unlock()
+
+	if err := p.deadLetterSink.Write(payload); err != nil {
+		log.Error(fmt.Sprintf("failed to write event to dead-letter sink: %v", err))
+		return false
+	}
+
+	return true
+}
+
+// halt stops passing events to the output, so that no event is processed without the failed rule.
+func (p *Processor[T]) halt(err error) {
+	if !p.haltErr.CompareAndSwap(nil, &err) {
+		return
+	}
+
+	log.Error(fmt.Sprintf("processor is halted: %v", err))
+	if p.onHalt != nil {
+		p.onHalt(err)
+	}
 }
@@ -1,14 +1,20 @@
 package processor_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/processor"
 	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/sink"
 	"github.com/mrtc0/conduit/testutils"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestProcessor_ApplyRules(t *testing.T) {
@@ -110,3 +116,296 @@ func TestProcessor_ApplyRules(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessor_FailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	failing := rule.NewRule(
+		"failing",
+		"Fails to process all events",
+		rule.TypeTransform,
+		func(evt *event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent] {
+			return rule.ErrorResult[*testutils.DummyEvent]{Err: errors.New("lookup failed")}
+		},
+	)
+	panicking := rule.NewRule(
+		"panicking",
+		"Panics on all events",
+		rule.TypeTransform,
+		func(evt *event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent] {
+			panic("unexpected")
+		},
+	)
+	rename := rule.NewRule(
+		"rename",
+		"Renames all events",
+		rule.TypeTransform,
+		func(evt *event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent] {
+			evt.Content().Name = "renamed"
+			return rule.TransformResult[*testutils.DummyEvent]{Event: evt}
+		},
+	)
+
+	testCases := map[string]struct {
+		rule           rule.Rule[*testutils.DummyEvent]
+		defaultPolicy  rule.FailurePolicy
+		wantPassed     bool
+		wantName       string
+		wantDropped    bool
+		wantDeadLetter bool
+		wantHalted     bool
+	}{
+		"skip by default": {
+			rule:       failing,
+			wantPassed: true,
+			wantName:   "renamed",
+		},
+		"skip a panicking rule": {
+			rule:       panicking,
+			wantPassed: true,
+			wantName:   "renamed",
+		},
+		"drop": {
+			rule:        rule.WithFailurePolicy(failing, rule.FailureDrop),
+			wantName:    "original",
+			wantDropped: true,
+		},
+		"default policy": {
+			rule:          panicking,
+			defaultPolicy: rule.FailureDrop,
+			wantName:      "original",
+			wantDropped:   true,
+		},
+		"dead letter": {
+			rule:           rule.WithFailurePolicy(failing, rule.FailureDeadLetter),
+			wantName:       "original",
+			wantDeadLetter: true,
+		},
+		"halt": {
+			rule:        rule.WithFailurePolicy(panicking, rule.FailureHalt),
+			wantName:    "original",
+			wantDropped: true,
+			wantHalted:  true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var dropped []*event.DroppedEvent[*testutils.DummyEvent]
+			var haltErr error
+			deadLetters := &bytes.Buffer{}
+
+			p := processor.NewProcessor(
+				[]rule.Rule[*testutils.DummyEvent]{tc.rule, rename}, nil, nil,
+				processor.WithFailurePolicy[*testutils.DummyEvent](tc.defaultPolicy),
+				processor.WithDeadLetterSink(sink.NewWriterSink[*testutils.DummyEvent](deadLetters)),
+				processor.WithDropHandler(func(d *event.DroppedEvent[*testutils.DummyEvent]) {
+					dropped = append(dropped, d)
+				}),
+				processor.WithHaltHandler[*testutils.DummyEvent](func(err error) {
+					haltErr = err
+				}),
+			)
+
+			input := event.NewEvent(&event.RawEvent[*testutils.DummyEvent]{
+				Content: &testutils.DummyEvent{ID: "1", Name: "original"},
+			})
+			assert.Equal(t, tc.wantPassed, p.ApplyRules(input))
+			assert.Equal(t, tc.wantName, input.Content().Name)
+
+			if tc.wantDropped {
+				require.Len(t, dropped, 1)
+				assert.Equal(t, event.DropStageProcess, dropped[0].Stage)
+				assert.Equal(t, rule.Name(tc.rule), dropped[0].Rule)
+				assert.Error(t, dropped[0].Err)
+			} else {
+				assert.Empty(t, dropped)
+			}
+
+			if tc.wantDeadLetter {
+				var record sink.DeadLetterRecord
+				require.NoError(t, json.Unmarshal(deadLetters.Bytes(), &record))
+				assert.Equal(t, "failing", record.Rule)
+				assert.Equal(t, "lookup failed", record.Error)
+				assert.JSONEq(t, `{"id":"1","name":"original"}`, record.Content)
+			} else {
+				assert.Empty(t, deadLetters.String())
+			}
+
+			if tc.wantHalted {
+				assert.ErrorContains(t, haltErr, `rule "panicking" failed: rule panicked: unexpected`)
+				assert.Equal(t, haltErr, p.Err())
+			} else {
+				assert.NoError(t, p.Err())
+			}
+		})
+	}
+}
+
+func TestProcessor_Split(t *testing.T) {
+	t.Parallel()
+
+	type envelope struct {
+		Records []string `json:"records"`
+	}
+
+	split := rule.NewRule(
+		"split",
+		"Splits the records of the envelope",
+		rule.TypeSplit,
+		func(evt *event.Event[envelope]) rule.Result[envelope] {
+			var contents []envelope
+			for _, record := range evt.Content().Records {
+				contents = append(contents, envelope{Records: []string{record}})
+			}
+			return rule.Split(evt, contents...)
+		},
+	)
+	dropDebug := rule.NewRule(
+		"drop-debug",
+		"Drops debug records",
+		rule.TypeFilter,
+		func(evt *event.Event[envelope]) rule.Result[envelope] {
+			return rule.FilterResult[envelope]{Drop: evt.Content().Records[0] == "debug", Reason: "debug"}
+		},
+	)
+	tag := rule.NewRule(
+		"tag",
+		"Tags the record",
+		rule.TypeTransform,
+		func(evt *event.Event[envelope]) rule.Result[envelope] {
+			evt.Tags["record"] = evt.Content().Records[0]
+			return rule.TransformResult[envelope]{Event: evt}
+		},
+	)
+
+	var dropped []*event.DroppedEvent[envelope]
+	p := processor.NewProcessor(
+		[]rule.Rule[envelope]{split, dropDebug, tag}, nil, nil,
+		processor.WithDropHandler(func(d *event.DroppedEvent[envelope]) {
+			dropped = append(dropped, d)
+		}),
+	)
+
+	input := event.NewEvent(&event.RawEvent[envelope]{
+		Content:  envelope{Records: []string{"a", "debug", "b"}},
+		Metadata: &event.Metadata{Tags: event.Tags{"source": "feed"}},
+	})
+
+	out := p.Process(input)
+	require.Len(t, out, 2)
+	assert.Equal(t, envelope{Records: []string{"a"}}, out[0].Content())
+	assert.Equal(t, event.Tags{"source": "feed", "record": "a"}, out[0].Tags)
+	assert.Equal(t, envelope{Records: []string{"b"}}, out[1].Content())
+	assert.Equal(t, event.Tags{"source": "feed", "record": "b"}, out[1].Tags)
+	assert.Equal(t, event.Tags{"source": "feed"}, input.Tags, "the split event is not changed")
+
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "drop-debug", dropped[0].Rule)
+
+	dropped = nil
+	assert.Empty(t, p.Process(event.NewEvent(&event.RawEvent[envelope]{Content: envelope{}})))
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "split", dropped[0].Rule)
+	assert.Equal(t, processor.ReasonEmptySplit, dropped[0].Reason)
+}
+
+func TestProcessor_SetRules(t *testing.T) {
+	t.Parallel()
+
+	tag := func(name string) rule.Rule[testutils.DummyEvent] {
+		return rule.NewRule(name, "", rule.TypeTransform,
+			func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+				evt.Tags[name] = "applied"
+				return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+			},
+		)
+	}
+	failing := rule.NewRule("failing", "", rule.TypeTransform,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			return rule.ErrorResult[testutils.DummyEvent]{Err: errors.New("boom")}
+		},
+	)
+	newEvent := func() *event.Event[testutils.DummyEvent] {
+		return event.NewEvent(&event.RawEvent[testutils.DummyEvent]{Content: testutils.DummyEvent{ID: "1"}})
+	}
+
+	var p *processor.Processor[testutils.DummyEvent]
+	// replace replaces the rules while an event is being processed
+	replace := rule.NewRule("replace", "", rule.TypeTransform,
+		func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+			require.NoError(t, p.SetRules([]rule.Rule[testutils.DummyEvent]{tag("new"), failing}))
+			return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+		},
+	)
+	p = processor.NewProcessor(
+		[]rule.Rule[testutils.DummyEvent]{replace, tag("old")}, nil, nil,
+		processor.WithFailurePolicy[testutils.DummyEvent](rule.FailureDrop),
+	)
+
+	// the event being processed is processed by the previous rules to the end
+	out := p.Process(newEvent())
+	require.Len(t, out, 1)
+	assert.Equal(t, event.Tags{"old": "applied"}, out[0].Tags)
+
+	// the new rules are given the failure policy of the processor
+	assert.Empty(t, p.Process(newEvent()))
+	assert.Len(t, p.Rules(), 2)
+
+	err := p.SetRules([]rule.Rule[testutils.DummyEvent]{tag("ignored"), nil})
+	assert.EqualError(t, err, "rule #1 is nil")
+	assert.Equal(t, "new", rule.Name(p.Rules()[0]))
+}
+
+// startedRule is a rule counting the Start calls not followed by Stop.
+type startedRule struct {
+	rule.Rule[testutils.DummyEvent]
+
+	starts atomic.Int32
+}
+
+func (r *startedRule) Start() {
+	r.starts.Add(1)
+}
+
+func (r *startedRule) Stop() {
+	r.starts.Add(-1)
+}
+
+func TestProcessor_StartRules(t *testing.T) {
+	t.Parallel()
+
+	newRule := func() *startedRule {
+		return &startedRule{Rule: rule.NewRule("started", "", rule.TypeTransform,
+			func(evt *event.Event[testutils.DummyEvent]) rule.Result[testutils.DummyEvent] {
+				return rule.TransformResult[testutils.DummyEvent]{Event: evt}
+			},
+		)}
+	}
+	first, second := newRule(), newRule()
+
+	input := make(chan *event.Event[testutils.DummyEvent])
+	p := processor.NewProcessor([]rule.Rule[testutils.DummyEvent]{first}, input, nil)
+
+	// the rules are not started until the processor is
+	require.NoError(t, p.SetRules([]rule.Rule[testutils.DummyEvent]{first}))
+	assert.Equal(t, int32(0), first.starts.Load())
+
+	p.Start()
+	assert.Equal(t, int32(1), first.starts.Load())
+
+	// the new rules are started and the replaced ones stopped, and the rules kept stay started
+	require.NoError(t, p.SetRules([]rule.Rule[testutils.DummyEvent]{first, second}))
+	assert.Equal(t, int32(1), first.starts.Load())
+	assert.Equal(t, int32(1), second.starts.Load())
+
+	require.NoError(t, p.SetRules([]rule.Rule[testutils.DummyEvent]{rule.WithFailurePolicy[testutils.DummyEvent](second, rule.FailureDrop)}))
+	assert.Equal(t, int32(0), first.starts.Load())
+	assert.Equal(t, int32(1), second.starts.Load())
+
+	close(input)
+	p.WaitStop()
+	assert.Equal(t, int32(0), second.starts.Load())
+}
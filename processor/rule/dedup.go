@@ -0,0 +1,149 @@
+package rule
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/strategy"
+)
+
+var (
+	_ Rule[any] = (*DedupRule[any])(nil)
+)
+
+const (
+	// DefaultDedupMaxKeys is the default number of keys remembered by a DedupRule.
+	DefaultDedupMaxKeys = 100000
+	// ReasonDuplicate is the reason of the events dropped by a DedupRule.
+	ReasonDuplicate = "duplicate"
+)
+
+// Dedup configures a DedupRule.
+type Dedup struct {
+	// Name identifies the rule in metrics and logs.
+	Name string `json:"name,omitempty"`
+	// Keys are the gjson paths of the values identifying an event.
+	// If empty, an event is identified by its whole JSON encoded content.
+	Keys []string `json:"keys,omitempty"`
+	// Window is how long the key of a passed event is remembered.
+	// An event is dropped when an event with the same key was passed within the window before it.
+	Window time.Duration `json:"window"`
+	// MaxKeys bounds the number of remembered keys. When it is reached, the least recently seen key is forgotten.
+	// If zero, DefaultDedupMaxKeys is used.
+	MaxKeys int `json:"max_keys,omitempty"`
+	// CountTag is the tag set to the number of duplicates dropped since the previous event with the same key passed.
+	// It is set on the next passed event with the key, if any duplicates were dropped.
+	// If empty, the count is not emitted.
+	CountTag string `json:"count_tag,omitempty"`
+}
+
+// DedupRule is a filter rule that drops the events whose key was seen within a time window.
+type DedupRule[T any] struct {
+	name     string
+	keys     []string
+	window   time.Duration
+	countTag string
+	clock    strategy.Clock
+
+	mu   sync.Mutex
+	seen *keyLRU[*dedupEntry]
+}
+
+type dedupEntry struct {
+	// passedAt is when the last event with the key passed, which starts the window.
+	passedAt time.Time
+	// suppressed is the number of duplicates dropped since passedAt.
+	suppressed int
+}
+
+type DedupRuleOptionsFunc[T any] func(*DedupRule[T])
+
+// WithDedupClock sets the clock measuring the window. If not specified, strategy.DefaultClock is used.
+func WithDedupClock[T any](clock strategy.Clock) DedupRuleOptionsFunc[T] {
+	return func(r *DedupRule[T]) {
+		r.clock = clock
+	}
+}
+
+// NewDedupRule creates a DedupRule.
+func NewDedupRule[T any](dedup Dedup, opts ...DedupRuleOptionsFunc[T]) (*DedupRule[T], error) {
+	if dedup.Window <= 0 {
+		return nil, errors.New("window must be positive")
+	}
+	if dedup.MaxKeys < 0 {
+		return nil, errors.New("max keys must not be negative")
+	}
+
+	maxKeys := dedup.MaxKeys
+	if maxKeys == 0 {
+		maxKeys = DefaultDedupMaxKeys
+	}
+
+	r := &DedupRule[T]{
+		name:     dedup.Name,
+		keys:     dedup.Keys,
+		window:   dedup.Window,
+		countTag: dedup.CountTag,
+		clock:    strategy.DefaultClock,
+		seen:     newKeyLRU[*dedupEntry](maxKeys),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r, nil
+}
+
+func (r *DedupRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *DedupRule[T]) RuleType() RuleType {
+	return TypeFilter
+}
+
+func (r *DedupRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	key, err := keyOf(evt, r.keys)
+	if err != nil {
+		return ErrorResult[T]{Err: err}
+	}
+
+	now := r.clock.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.seen.get(key)
+	if !ok {
+		r.seen.add(key, &dedupEntry{passedAt: now})
+		return FilterResult[T]{Drop: false}
+	}
+
+	if now.Sub(entry.passedAt) < r.window {
+		entry.suppressed++
+		return FilterResult[T]{Drop: true, Reason: ReasonDuplicate}
+	}
+
+	if entry.suppressed > 0 && r.countTag != "" {
+		if evt.Tags == nil {
+			evt.Tags = event.Tags{}
+		}
+		evt.Tags[r.countTag] = strconv.Itoa(entry.suppressed)
+	}
+	entry.passedAt = now
+	entry.suppressed = 0
+
+	return FilterResult[T]{Drop: false}
+}
+
+// Len returns the number of remembered keys.
+func (r *DedupRule[T]) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.seen.len()
+}
@@ -0,0 +1,94 @@
+package rule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDedupRule(t *testing.T) {
+	t.Parallel()
+
+	clock := testutils.NewMockClock()
+	r, err := rule.NewDedupRule(rule.Dedup{
+		Name:     "dedup-webhooks",
+		Keys:     []string{"id"},
+		Window:   time.Minute,
+		CountTag: "dedup.suppressed",
+	}, rule.WithDedupClock[webhook](clock))
+	require.NoError(t, err)
+
+	_, dropped := applyFilter(r, webhook{ID: "a", Attempt: 1})
+	assert.False(t, dropped)
+
+	clock.Add(30 * time.Second)
+	_, dropped = applyFilter(r, webhook{ID: "a", Attempt: 2})
+	assert.True(t, dropped, "retry within the window")
+	_, dropped = applyFilter(r, webhook{ID: "a", Attempt: 3})
+	assert.True(t, dropped, "retry within the window")
+	_, dropped = applyFilter(r, webhook{ID: "b", Attempt: 1})
+	assert.False(t, dropped, "different key")
+
+	// The window starts when an event passes, so duplicates do not extend it.
+	clock.Add(30 * time.Second)
+	evt, dropped := applyFilter(r, webhook{ID: "a", Attempt: 4})
+	assert.False(t, dropped, "after the window")
+	assert.Equal(t, "2", evt.Tags["dedup.suppressed"])
+
+	evt, dropped = applyFilter(r, webhook{ID: "b", Attempt: 2})
+	assert.True(t, dropped)
+	assert.NotContains(t, evt.Tags, "dedup.suppressed")
+
+	clock.Add(time.Minute)
+	evt, dropped = applyFilter(r, webhook{ID: "a", Attempt: 5})
+	assert.False(t, dropped)
+	assert.NotContains(t, evt.Tags, "dedup.suppressed", "no duplicates in the last window")
+}
+
+func TestDedupRule_WholeContent(t *testing.T) {
+	t.Parallel()
+
+	r, err := rule.NewDedupRule[webhook](rule.Dedup{Window: time.Hour})
+	require.NoError(t, err)
+
+	_, dropped := applyFilter(r, webhook{ID: "a", Attempt: 1})
+	assert.False(t, dropped)
+	_, dropped = applyFilter(r, webhook{ID: "a", Attempt: 2})
+	assert.False(t, dropped)
+
+	evt := event.NewEvent(&event.RawEvent[webhook]{Content: webhook{ID: "a", Attempt: 1}})
+	assert.Equal(t, rule.FilterResult[webhook]{Drop: true, Reason: rule.ReasonDuplicate}, r.Apply(evt))
+}
+
+func TestDedupRule_MaxKeys(t *testing.T) {
+	t.Parallel()
+
+	r, err := rule.NewDedupRule[webhook](rule.Dedup{Keys: []string{"id"}, Window: time.Hour, MaxKeys: 2})
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "a", "c"} {
+		applyFilter(r, webhook{ID: id})
+	}
+	assert.Equal(t, 2, r.Len())
+
+	// "b" was the least recently seen key, so it was forgotten.
+	_, dropped := applyFilter(r, webhook{ID: "a"})
+	assert.True(t, dropped)
+	_, dropped = applyFilter(r, webhook{ID: "b"})
+	assert.False(t, dropped)
+}
+
+func TestNewDedupRule_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := rule.NewDedupRule[webhook](rule.Dedup{})
+	assert.ErrorContains(t, err, "window must be positive")
+
+	_, err = rule.NewDedupRule[webhook](rule.Dedup{Window: time.Second, MaxKeys: -1})
+	assert.ErrorContains(t, err, "max keys must not be negative")
+}
@@ -0,0 +1,141 @@
+package rule
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+// FailurePolicy defines what happens to an event when a rule fails to process it,
+// either by returning an ErrorResult or by panicking.
+type FailurePolicy int
+
+const (
+	// FailureSkip skips the failed rule and passes the event unchanged to the next rule.
+	FailureSkip FailurePolicy = iota
+	// FailureDrop drops the event.
+	FailureDrop
+	// FailureDeadLetter writes the event with the error to the dead-letter sink of the rules.
+	FailureDeadLetter
+	// FailureHalt drops the event and halts the processing of all following events.
+	FailureHalt
+)
+
+var failurePolicyNames = map[FailurePolicy]string{
+	FailureSkip:       "skip",
+	FailureDrop:       "drop",
+	FailureDeadLetter: "dead_letter",
+	FailureHalt:       "halt",
+}
+
+func (p FailurePolicy) String() string {
+	if name, ok := failurePolicyNames[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("FailurePolicy(%d)", int(p))
+}
+
+// ParseFailurePolicy parses the name of a FailurePolicy, such as "skip" or "dead_letter".
+func ParseFailurePolicy(s string) (FailurePolicy, error) {
+	for policy, name := range failurePolicyNames {
+		if strings.EqualFold(s, name) {
+			return policy, nil
+		}
+	}
+
+	return FailureSkip, fmt.Errorf("unknown failure policy %q", s)
+}
+
+// FailurePolicyProvider is implemented by rules that have their own FailurePolicy.
+type FailurePolicyProvider interface {
+	FailurePolicy() FailurePolicy
+}
+
+// PolicyOf returns the FailurePolicy of the rule if it implements FailurePolicyProvider, or fallback.
+func PolicyOf[T any](r Rule[T], fallback FailurePolicy) FailurePolicy {
+	if provider, ok := r.(FailurePolicyProvider); ok {
+		return provider.FailurePolicy()
+	}
+
+	return fallback
+}
+
+// WithFailurePolicy returns the rule with the given FailurePolicy.
+// FailureSkip does not override the own policy of a rule that is not FailureSkip, such as RedactRule,
+// so that the events the rule failed are not passed on.
+func WithFailurePolicy[T any](r Rule[T], policy FailurePolicy) Rule[T] {
+	if policy == FailureSkip {
+		policy = PolicyOf(r, FailureSkip)
+	}
+
+	return &policyRule[T]{Rule: r, policy: policy}
+}
+
+type policyRule[T any] struct {
+	Rule[T]
+
+	policy FailurePolicy
+}
+
+func (r *policyRule[T]) FailurePolicy() FailurePolicy {
+	return r.policy
+}
+
+func (r *policyRule[T]) RuleName() string {
+	return Name(r.Rule)
+}
+
+func (r *policyRule[T]) Start() {
+	if starter, ok := r.Rule.(Starter); ok {
+		starter.Start()
+	}
+}
+
+func (r *policyRule[T]) Stop() {
+	if starter, ok := r.Rule.(Starter); ok {
+		starter.Stop()
+	}
+}
+
+// PanicError is the error of a rule that panicked while processing an event.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the goroutine when it panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("rule panicked: %v", e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error.
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// SafeApply applies the rule to the event and recovers from a panic in the rule,
+// which is returned as an ErrorResult with a *PanicError.
+// A nil result is also returned as an ErrorResult.
+func SafeApply[T any](r Rule[T], evt *event.Event[T]) (result Result[T]) {
+	defer func() {
+		if v := recover(); v != nil {
+			result = ErrorResult[T]{Err: &PanicError{Value: v, Stack: debug.Stack()}}
+		}
+	}()
+
+	result = r.Apply(evt)
+	if result == nil {
+		return ErrorResult[T]{Err: errors.New("rule returned no result")}
+	}
+
+	return result
+}
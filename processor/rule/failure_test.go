@@ -0,0 +1,93 @@
+package rule_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeApply(t *testing.T) {
+	t.Parallel()
+
+	errBoom := errors.New("boom")
+
+	testCases := map[string]struct {
+		fn        func(*event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent]
+		wantPanic any
+		wantErr   error
+	}{
+		"panic with a value": {
+			fn: func(evt *event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent] {
+				var content *testutils.DummyEvent
+				content.Name = "nil pointer"
+				return rule.TransformResult[*testutils.DummyEvent]{Event: evt}
+			},
+			wantPanic: "runtime error: invalid memory address or nil pointer dereference",
+		},
+		"panic with an error": {
+			fn: func(evt *event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent] {
+				panic(errBoom)
+			},
+			wantPanic: errBoom.Error(),
+			wantErr:   errBoom,
+		},
+		"nil result": {
+			fn: func(evt *event.Event[*testutils.DummyEvent]) rule.Result[*testutils.DummyEvent] {
+				return nil
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := rule.NewRule("failing", "", rule.TypeTransform, tc.fn)
+			result := rule.SafeApply(r, event.NewEvent(&event.RawEvent[*testutils.DummyEvent]{}))
+
+			errorResult, ok := result.(rule.ErrorResult[*testutils.DummyEvent])
+			require.True(t, ok)
+			assert.Equal(t, rule.TypeError, errorResult.TypeOf())
+
+			var panicErr *rule.PanicError
+			if tc.wantPanic == nil {
+				assert.False(t, errors.As(errorResult.Err, &panicErr))
+				return
+			}
+			require.ErrorAs(t, errorResult.Err, &panicErr)
+			assert.Contains(t, panicErr.Error(), tc.wantPanic)
+			assert.NotEmpty(t, panicErr.Stack)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, errorResult.Err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	r := rule.NewRule[*testutils.DummyEvent]("named", "", rule.TypeFilter, nil)
+	assert.Equal(t, rule.FailureHalt, rule.PolicyOf(r, rule.FailureHalt))
+
+	withPolicy := rule.WithFailurePolicy(r, rule.FailureDeadLetter)
+	assert.Equal(t, rule.FailureDeadLetter, rule.PolicyOf(withPolicy, rule.FailureHalt))
+	assert.Equal(t, "named", rule.Name(withPolicy))
+	assert.Equal(t, rule.TypeFilter, withPolicy.RuleType())
+
+	for _, policy := range []rule.FailurePolicy{
+		rule.FailureSkip, rule.FailureDrop, rule.FailureDeadLetter, rule.FailureHalt,
+	} {
+		parsed, err := rule.ParseFailurePolicy(policy.String())
+		assert.NoError(t, err)
+		assert.Equal(t, policy, parsed)
+	}
+
+	_, err := rule.ParseFailurePolicy("retry")
+	assert.Error(t, err)
+}
@@ -0,0 +1,437 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var (
+	_ Rule[any] = (*FieldFilterRule[any])(nil)
+)
+
+// Operator compares the value at the path of a Condition.
+type Operator string
+
+const (
+	// OpEquals matches values equal to Value, which is required. Null values are matched with OpIsNull.
+	OpEquals Operator = "equals"
+	// OpNotEquals matches values not equal to Value, including missing values. Value is required.
+	OpNotEquals Operator = "not_equals"
+	// OpIn matches values equal to one of Values.
+	OpIn Operator = "in"
+	// OpRegex matches string values matching the regular expression in Value.
+	OpRegex Operator = "regex"
+	// OpPrefix matches string values starting with Value.
+	OpPrefix Operator = "prefix"
+	// OpGreaterThan matches numeric values greater than Value.
+	OpGreaterThan Operator = "gt"
+	// OpGreaterOrEqual matches numeric values greater than or equal to Value.
+	OpGreaterOrEqual Operator = "gte"
+	// OpLessThan matches numeric values less than Value.
+	OpLessThan Operator = "lt"
+	// OpLessOrEqual matches numeric values less than or equal to Value.
+	OpLessOrEqual Operator = "lte"
+	// OpExists matches present values. If Value is false, it matches missing values instead.
+	OpExists Operator = "exists"
+	// OpIsNull matches null values. If Value is false, it matches present values other than null instead.
+	OpIsNull Operator = "is_null"
+)
+
+// Condition is a predicate on the JSON encoded content of an event, configured as data.
+// It is either a comparison of the value at the gjson path Field using Op,
+// or a combination of conditions with All, Any or Not.
+type Condition struct {
+	// Field is the gjson path of the compared value, such as "user.name" or "tags.#".
+	Field string `json:"field,omitempty"`
+	// Op is the operator comparing the value at Field.
+	Op Operator `json:"op,omitempty"`
+	// Value is the operand of Op, a string, a number or a bool.
+	Value any `json:"value,omitempty"`
+	// Values are the operands of OpIn.
+	Values []any `json:"values,omitempty"`
+
+	// All matches when all of the conditions match.
+	All []Condition `json:"all,omitempty"`
+	// Any matches when at least one of the conditions matches.
+	Any []Condition `json:"any,omitempty"`
+	// Not matches when the condition does not match.
+	Not *Condition `json:"not,omitempty"`
+}
+
+// Matcher is a compiled Condition.
+type Matcher interface {
+	// Match reports whether the JSON document matches the condition.
+	Match(json string) bool
+}
+
+// CompileCondition validates the condition and compiles it into a Matcher.
+func CompileCondition(c Condition) (Matcher, error) {
+	set := 0
+	if c.Field != "" || c.Op != "" {
+		set++
+	}
+	if c.All != nil {
+		set++
+	}
+	if c.Any != nil {
+		set++
+	}
+	if c.Not != nil {
+		set++
+	}
+	if set != 1 {
+		return nil, errors.New("condition must have exactly one of field, all, any or not")
+	}
+
+	switch {
+	case c.All != nil:
+		matchers, err := compileConditions(c.All)
+		if err != nil {
+			return nil, fmt.Errorf("invalid all condition: %w", err)
+		}
+		return allMatcher(matchers), nil
+	case c.Any != nil:
+		matchers, err := compileConditions(c.Any)
+		if err != nil {
+			return nil, fmt.Errorf("invalid any condition: %w", err)
+		}
+		return anyMatcher(matchers), nil
+	case c.Not != nil:
+		matcher, err := CompileCondition(*c.Not)
+		if err != nil {
+			return nil, fmt.Errorf("invalid not condition: %w", err)
+		}
+		return notMatcher{matcher}, nil
+	default:
+		matcher, err := compileField(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid condition on field %q: %w", c.Field, err)
+		}
+		return matcher, nil
+	}
+}
+
+func compileConditions(conditions []Condition) ([]Matcher, error) {
+	if len(conditions) == 0 {
+		return nil, errors.New("no conditions")
+	}
+
+	matchers := make([]Matcher, 0, len(conditions))
+	for i, c := range conditions {
+		matcher, err := CompileCondition(c)
+		if err != nil {
+			return nil, fmt.Errorf("condition #%d: %w", i, err)
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	return matchers, nil
+}
+
+func compileField(c Condition) (Matcher, error) {
+	if c.Field == "" {
+		return nil, errors.New("field is required")
+	}
+
+	m := &fieldMatcher{path: c.Field, op: c.Op}
+
+	switch c.Op {
+	case OpEquals, OpNotEquals:
+		// a missing value is decoded as nil, so it is rejected rather than compared with null
+		if c.Value == nil {
+			return nil, errors.New("value is required, use is_null to match null values")
+		}
+		value, err := newOperand(c.Value)
+		if err != nil {
+			return nil, err
+		}
+		m.values = []operand{value}
+	case OpIn:
+		if len(c.Values) == 0 {
+			return nil, errors.New("values are required")
+		}
+		for _, v := range c.Values {
+			value, err := newOperand(v)
+			if err != nil {
+				return nil, err
+			}
+			m.values = append(m.values, value)
+		}
+	case OpRegex:
+		pattern, ok := c.Value.(string)
+		if !ok {
+			return nil, errors.New("value must be a regular expression string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		m.re = re
+	case OpPrefix:
+		prefix, ok := c.Value.(string)
+		if !ok {
+			return nil, errors.New("value must be a string")
+		}
+		m.values = []operand{{kind: gjson.String, str: prefix}}
+	case OpGreaterThan, OpGreaterOrEqual, OpLessThan, OpLessOrEqual:
+		value, err := newOperand(c.Value)
+		if err != nil {
+			return nil, err
+		}
+		if value.kind == gjson.String {
+			num, err := strconv.ParseFloat(value.str, 64)
+			if err != nil {
+				return nil, errors.New("value must be a number")
+			}
+			value = operand{kind: gjson.Number, num: num}
+		}
+		if value.kind != gjson.Number {
+			return nil, errors.New("value must be a number")
+		}
+		m.values = []operand{value}
+	case OpExists, OpIsNull:
+		switch v := c.Value.(type) {
+		case nil:
+			m.exists = true
+		case bool:
+			m.exists = v
+		default:
+			return nil, errors.New("value must be a bool")
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", c.Op)
+	}
+
+	return m, nil
+}
+
+// operand is a scalar value of a Condition.
+type operand struct {
+	kind gjson.Type
+	str  string
+	num  float64
+}
+
+func newOperand(v any) (operand, error) {
+	switch v := v.(type) {
+	case nil:
+		return operand{kind: gjson.Null}, nil
+	case bool:
+		if v {
+			return operand{kind: gjson.True}, nil
+		}
+		return operand{kind: gjson.False}, nil
+	case string:
+		return operand{kind: gjson.String, str: v}, nil
+	case json.Number:
+		num, err := v.Float64()
+		if err != nil {
+			return operand{}, fmt.Errorf("invalid number %q: %w", v, err)
+		}
+		return operand{kind: gjson.Number, num: num}, nil
+	case float64:
+		return operand{kind: gjson.Number, num: v}, nil
+	case float32:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	case int:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	case int32:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	case int64:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	case uint:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	case uint32:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	case uint64:
+		return operand{kind: gjson.Number, num: float64(v)}, nil
+	default:
+		return operand{}, fmt.Errorf("unsupported value of type %T", v)
+	}
+}
+
+// equal reports whether the value equals the operand.
+// Numbers are compared numerically, also when the value is a numeric string.
+func (o operand) equal(value gjson.Result) bool {
+	switch o.kind {
+	case gjson.Number:
+		num, ok := number(value)
+		return ok && num == o.num
+	case gjson.String:
+		return value.Exists() && value.Type != gjson.Null && value.String() == o.str
+	default:
+		return value.Type == o.kind && value.Exists()
+	}
+}
+
+// number returns the numeric value of a number or a numeric string.
+func number(value gjson.Result) (float64, bool) {
+	switch value.Type {
+	case gjson.Number:
+		return value.Num, true
+	case gjson.String:
+		num, err := strconv.ParseFloat(strings.TrimSpace(value.Str), 64)
+		return num, err == nil
+	default:
+		return 0, false
+	}
+}
+
+type fieldMatcher struct {
+	path   string
+	op     Operator
+	values []operand
+	re     *regexp.Regexp
+	// exists is the bool operand of OpExists and OpIsNull.
+	exists bool
+}
+
+func (m *fieldMatcher) Match(data string) bool {
+	value := gjson.Get(data, m.path)
+
+	switch m.op {
+	case OpEquals:
+		return m.values[0].equal(value)
+	case OpNotEquals:
+		return !m.values[0].equal(value)
+	case OpIn:
+		for _, v := range m.values {
+			if v.equal(value) {
+				return true
+			}
+		}
+		return false
+	case OpRegex:
+		return value.Type == gjson.String && m.re.MatchString(value.Str)
+	case OpPrefix:
+		return value.Type == gjson.String && strings.HasPrefix(value.Str, m.values[0].str)
+	case OpGreaterThan, OpGreaterOrEqual, OpLessThan, OpLessOrEqual:
+		num, ok := number(value)
+		if !ok {
+			return false
+		}
+		return compare(m.op, num, m.values[0].num)
+	case OpExists:
+		return value.Exists() == m.exists
+	case OpIsNull:
+		return value.Exists() && (value.Type == gjson.Null) == m.exists
+	default:
+		return false
+	}
+}
+
+func compare(op Operator, a, b float64) bool {
+	switch op {
+	case OpGreaterThan:
+		return a > b
+	case OpGreaterOrEqual:
+		return a >= b
+	case OpLessThan:
+		return a < b
+	default:
+		return a <= b
+	}
+}
+
+type allMatcher []Matcher
+
+func (m allMatcher) Match(data string) bool {
+	for _, matcher := range m {
+		if !matcher.Match(data) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type anyMatcher []Matcher
+
+func (m anyMatcher) Match(data string) bool {
+	for _, matcher := range m {
+		if matcher.Match(data) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type notMatcher struct {
+	matcher Matcher
+}
+
+func (m notMatcher) Match(data string) bool {
+	return !m.matcher.Match(data)
+}
+
+// FieldFilter configures a FieldFilterRule.
+type FieldFilter struct {
+	// Name identifies the rule in metrics and logs.
+	Name string `json:"name,omitempty"`
+	// Condition selects the events to drop.
+	Condition Condition `json:"condition"`
+	// Keep inverts the filter to keep only the events matching Condition and drop the others.
+	Keep bool `json:"keep,omitempty"`
+	// Reason is the reason of the dropped events.
+	// If empty, the name of the rule is used.
+	Reason string `json:"reason,omitempty"`
+}
+
+// FieldFilterRule is a filter rule that drops events by a Condition on their JSON encoded content.
+type FieldFilterRule[T any] struct {
+	name    string
+	reason  string
+	keep    bool
+	matcher Matcher
+}
+
+// NewFieldFilterRule creates a FieldFilterRule.
+// It returns an error if the condition is invalid, such as an unknown operator or an invalid regular expression.
+func NewFieldFilterRule[T any](filter FieldFilter) (*FieldFilterRule[T], error) {
+	matcher, err := CompileCondition(filter.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := filter.Reason
+	if reason == "" {
+		reason = filter.Name
+	}
+
+	return &FieldFilterRule[T]{
+		name:    filter.Name,
+		reason:  reason,
+		keep:    filter.Keep,
+		matcher: matcher,
+	}, nil
+}
+
+func (r *FieldFilterRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *FieldFilterRule[T]) RuleType() RuleType {
+	return TypeFilter
+}
+
+func (r *FieldFilterRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	data, err := evt.MarshalJSON()
+	if err != nil {
+		return ErrorResult[T]{Err: fmt.Errorf("failed to marshal event: %w", err)}
+	}
+
+	if matched := r.matcher.Match(string(data)); matched != r.keep {
+		return FilterResult[T]{Drop: true, Reason: r.reason}
+	}
+
+	return FilterResult[T]{Drop: false}
+}
@@ -0,0 +1,320 @@
+package rule_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileCondition(t *testing.T) {
+	t.Parallel()
+
+	const doc = `{
+		"user": {"name": "alice", "role": "admin", "ip": "10.0.0.1"},
+		"status": 503,
+		"latency": "1.5",
+		"verified": true,
+		"deleted": null,
+		"tags": ["a", "b"]
+	}`
+
+	testCases := map[string]struct {
+		condition rule.Condition
+		want      bool
+	}{
+		"equals string": {
+			condition: rule.Condition{Field: "user.name", Op: rule.OpEquals, Value: "alice"},
+			want:      true,
+		},
+		"equals number": {
+			condition: rule.Condition{Field: "status", Op: rule.OpEquals, Value: 503},
+			want:      true,
+		},
+		"equals numeric string": {
+			condition: rule.Condition{Field: "latency", Op: rule.OpEquals, Value: 1.5},
+			want:      true,
+		},
+		"equals bool": {
+			condition: rule.Condition{Field: "verified", Op: rule.OpEquals, Value: true},
+			want:      true,
+		},
+		"is null": {
+			condition: rule.Condition{Field: "deleted", Op: rule.OpIsNull},
+			want:      true,
+		},
+		"is null missing": {
+			condition: rule.Condition{Field: "missing", Op: rule.OpIsNull},
+			want:      false,
+		},
+		"is not null": {
+			condition: rule.Condition{Field: "verified", Op: rule.OpIsNull, Value: false},
+			want:      true,
+		},
+		"is not null missing": {
+			condition: rule.Condition{Field: "missing", Op: rule.OpIsNull, Value: false},
+			want:      false,
+		},
+		"in null": {
+			condition: rule.Condition{Field: "deleted", Op: rule.OpIn, Values: []any{"", nil}},
+			want:      true,
+		},
+		"not equals": {
+			condition: rule.Condition{Field: "user.role", Op: rule.OpNotEquals, Value: "admin"},
+			want:      false,
+		},
+		"not equals missing": {
+			condition: rule.Condition{Field: "missing", Op: rule.OpNotEquals, Value: "admin"},
+			want:      true,
+		},
+		"in": {
+			condition: rule.Condition{Field: "status", Op: rule.OpIn, Values: []any{500, 502, 503}},
+			want:      true,
+		},
+		"not in": {
+			condition: rule.Condition{Field: "user.role", Op: rule.OpIn, Values: []any{"guest", "viewer"}},
+			want:      false,
+		},
+		"regex": {
+			condition: rule.Condition{Field: "user.ip", Op: rule.OpRegex, Value: `^10\.`},
+			want:      true,
+		},
+		"regex on number": {
+			condition: rule.Condition{Field: "status", Op: rule.OpRegex, Value: `^5`},
+			want:      false,
+		},
+		"prefix": {
+			condition: rule.Condition{Field: "user.name", Op: rule.OpPrefix, Value: "al"},
+			want:      true,
+		},
+		"greater than": {
+			condition: rule.Condition{Field: "status", Op: rule.OpGreaterThan, Value: 499},
+			want:      true,
+		},
+		"greater or equal numeric string": {
+			condition: rule.Condition{Field: "latency", Op: rule.OpGreaterOrEqual, Value: "1.5"},
+			want:      true,
+		},
+		"less than": {
+			condition: rule.Condition{Field: "status", Op: rule.OpLessThan, Value: 500},
+			want:      false,
+		},
+		"less or equal on string": {
+			condition: rule.Condition{Field: "user.name", Op: rule.OpLessOrEqual, Value: 1},
+			want:      false,
+		},
+		"exists": {
+			condition: rule.Condition{Field: "tags.1", Op: rule.OpExists},
+			want:      true,
+		},
+		"not exists": {
+			condition: rule.Condition{Field: "tags.2", Op: rule.OpExists, Value: false},
+			want:      true,
+		},
+		"all": {
+			condition: rule.Condition{All: []rule.Condition{
+				{Field: "user.role", Op: rule.OpEquals, Value: "admin"},
+				{Field: "status", Op: rule.OpGreaterOrEqual, Value: 500},
+			}},
+			want: true,
+		},
+		"any": {
+			condition: rule.Condition{Any: []rule.Condition{
+				{Field: "user.role", Op: rule.OpEquals, Value: "guest"},
+				{Field: "verified", Op: rule.OpEquals, Value: false},
+			}},
+			want: false,
+		},
+		"not": {
+			condition: rule.Condition{Not: &rule.Condition{
+				Any: []rule.Condition{
+					{Field: "user.role", Op: rule.OpEquals, Value: "guest"},
+				},
+			}},
+			want: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			matcher, err := rule.CompileCondition(tc.condition)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, matcher.Match(doc))
+		})
+	}
+}
+
+func TestCompileCondition_Invalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		condition rule.Condition
+		wantErr   string
+	}{
+		"empty": {
+			condition: rule.Condition{},
+			wantErr:   "exactly one of field, all, any or not",
+		},
+		"field and all": {
+			condition: rule.Condition{
+				Field: "a", Op: rule.OpExists,
+				All: []rule.Condition{{Field: "b", Op: rule.OpExists}},
+			},
+			wantErr: "exactly one of field, all, any or not",
+		},
+		"missing field": {
+			condition: rule.Condition{Op: rule.OpExists},
+			wantErr:   "field is required",
+		},
+		"unknown operator": {
+			condition: rule.Condition{Field: "a", Op: "contains"},
+			wantErr:   `unknown operator "contains"`,
+		},
+		"invalid regex": {
+			condition: rule.Condition{Field: "a", Op: rule.OpRegex, Value: "("},
+			wantErr:   "invalid regular expression",
+		},
+		"non numeric comparison": {
+			condition: rule.Condition{Field: "a", Op: rule.OpGreaterThan, Value: "many"},
+			wantErr:   "value must be a number",
+		},
+		"equals without value": {
+			condition: rule.Condition{Field: "a", Op: rule.OpEquals},
+			wantErr:   "value is required, use is_null to match null values",
+		},
+		"not equals without value": {
+			condition: rule.Condition{Field: "a", Op: rule.OpNotEquals},
+			wantErr:   "value is required, use is_null to match null values",
+		},
+		"is null with a string": {
+			condition: rule.Condition{Field: "a", Op: rule.OpIsNull, Value: "yes"},
+			wantErr:   "value must be a bool",
+		},
+		"empty in": {
+			condition: rule.Condition{Field: "a", Op: rule.OpIn},
+			wantErr:   "values are required",
+		},
+		"nested": {
+			condition: rule.Condition{All: []rule.Condition{
+				{Field: "a", Op: rule.OpExists},
+				{Field: "b", Op: rule.OpEquals, Value: []string{"x"}},
+			}},
+			wantErr: `invalid all condition: condition #1: invalid condition on field "b": unsupported value of type []string`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := rule.CompileCondition(tc.condition)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestFieldFilterRule(t *testing.T) {
+	t.Parallel()
+
+	type Request struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Status int    `json:"status"`
+	}
+
+	healthCheck := rule.Condition{All: []rule.Condition{
+		{Field: "method", Op: rule.OpEquals, Value: "GET"},
+		{Field: "path", Op: rule.OpPrefix, Value: "/health"},
+	}}
+
+	testCases := map[string]struct {
+		filter   rule.FieldFilter
+		input    Request
+		wantDrop bool
+	}{
+		"drop matching": {
+			filter:   rule.FieldFilter{Name: "drop-health-checks", Condition: healthCheck},
+			input:    Request{Method: "GET", Path: "/healthz", Status: 200},
+			wantDrop: true,
+		},
+		"pass not matching": {
+			filter:   rule.FieldFilter{Name: "drop-health-checks", Condition: healthCheck},
+			input:    Request{Method: "POST", Path: "/login", Status: 200},
+			wantDrop: false,
+		},
+		"keep matching": {
+			filter: rule.FieldFilter{
+				Name:      "errors-only",
+				Condition: rule.Condition{Field: "status", Op: rule.OpGreaterOrEqual, Value: 500},
+				Keep:      true,
+			},
+			input:    Request{Method: "GET", Path: "/", Status: 503},
+			wantDrop: false,
+		},
+		"keep drops not matching": {
+			filter: rule.FieldFilter{
+				Name:      "errors-only",
+				Condition: rule.Condition{Field: "status", Op: rule.OpGreaterOrEqual, Value: 500},
+				Keep:      true,
+			},
+			input:    Request{Method: "GET", Path: "/", Status: 200},
+			wantDrop: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := rule.NewFieldFilterRule[Request](tc.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tc.filter.Name, rule.Name[Request](r))
+			assert.Equal(t, rule.TypeFilter, r.RuleType())
+
+			result := r.Apply(event.NewEvent(&event.RawEvent[Request]{Content: tc.input}))
+			filterResult, ok := result.(rule.FilterResult[Request])
+			require.True(t, ok)
+			assert.Equal(t, tc.wantDrop, filterResult.Drop)
+			if tc.wantDrop {
+				assert.Equal(t, tc.filter.Name, filterResult.Reason)
+			}
+		})
+	}
+}
+
+func TestFieldFilter_JSON(t *testing.T) {
+	t.Parallel()
+
+	var filter rule.FieldFilter
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"name": "drop-noisy",
+		"reason": "noisy",
+		"condition": {"any": [
+			{"field": "level", "op": "in", "values": ["debug", "trace"]},
+			{"not": {"field": "score", "op": "gte", "value": 0.5}}
+		]}
+	}`), &filter))
+
+	r, err := rule.NewFieldFilterRule[map[string]any](filter)
+	require.NoError(t, err)
+
+	dropped := rule.FilterResult[map[string]any]{Drop: true, Reason: "noisy"}
+	passed := rule.FilterResult[map[string]any]{Drop: false}
+
+	for input, want := range map[string]rule.FilterResult[map[string]any]{
+		`{"level":"debug","score":0.9}`: dropped,
+		`{"level":"info","score":0.1}`:  dropped,
+		`{"level":"info","score":0.9}`:  passed,
+	} {
+		var content map[string]any
+		require.NoError(t, json.Unmarshal([]byte(input), &content))
+
+		result := r.Apply(event.NewEvent(&event.RawEvent[map[string]any]{Content: content}))
+		assert.Equal(t, want, result, input)
+	}
+}
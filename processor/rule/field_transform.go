@@ -0,0 +1,287 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var (
+	_ Rule[any] = (*FieldTransformRule[any])(nil)
+)
+
+// FieldOp is the kind of a FieldOperation.
+type FieldOp string
+
+const (
+	// FieldRename moves the value at From to To.
+	FieldRename FieldOp = "rename"
+	// FieldRemove deletes the values at Paths.
+	FieldRemove FieldOp = "remove"
+	// FieldKeep deletes everything except the values at Paths.
+	FieldKeep FieldOp = "keep"
+	// FieldCopy copies the value at From to To.
+	FieldCopy FieldOp = "copy"
+	// FieldSet sets Value, or the string rendered from Template, at To.
+	FieldSet FieldOp = "set"
+)
+
+// FieldOperation is a change to the fields of the JSON encoded content of an event.
+// The paths are sjson paths, such as "user.name" or "tags.0".
+type FieldOperation struct {
+	Op FieldOp `json:"op"`
+	// From is the path of the value moved by FieldRename or copied by FieldCopy.
+	From string `json:"from,omitempty"`
+	// To is the path where FieldRename, FieldCopy and FieldSet write the value.
+	To string `json:"to,omitempty"`
+	// Paths are the paths removed by FieldRemove or kept by FieldKeep.
+	Paths []string `json:"paths,omitempty"`
+	// Value is the value written by FieldSet.
+	Value any `json:"value,omitempty"`
+	// Template is the string written by FieldSet instead of Value.
+	// Each ${path} in the template is replaced with the value at the gjson path, or an empty string if it is missing.
+	Template string `json:"template,omitempty"`
+}
+
+// RenameField returns a FieldOperation moving the value at from to to.
+func RenameField(from, to string) FieldOperation {
+	return FieldOperation{Op: FieldRename, From: from, To: to}
+}
+
+// RemoveFields returns a FieldOperation deleting the values at paths.
+func RemoveFields(paths ...string) FieldOperation {
+	return FieldOperation{Op: FieldRemove, Paths: paths}
+}
+
+// KeepFields returns a FieldOperation deleting everything except the values at paths.
+func KeepFields(paths ...string) FieldOperation {
+	return FieldOperation{Op: FieldKeep, Paths: paths}
+}
+
+// CopyField returns a FieldOperation copying the value at from to to.
+func CopyField(from, to string) FieldOperation {
+	return FieldOperation{Op: FieldCopy, From: from, To: to}
+}
+
+// SetField returns a FieldOperation setting value at path.
+func SetField(path string, value any) FieldOperation {
+	return FieldOperation{Op: FieldSet, To: path, Value: value}
+}
+
+// SetFieldTemplate returns a FieldOperation setting the string rendered from template at path.
+func SetFieldTemplate(path, template string) FieldOperation {
+	return FieldOperation{Op: FieldSet, To: path, Template: template}
+}
+
+// fieldOperation is a validated FieldOperation.
+type fieldOperation struct {
+	FieldOperation
+
+	// template is the parsed Template, alternating literal strings and paths.
+	template []templatePart
+}
+
+type templatePart struct {
+	literal string
+	path    string
+}
+
+func newFieldOperation(op FieldOperation) (*fieldOperation, error) {
+	o := &fieldOperation{FieldOperation: op}
+
+	switch op.Op {
+	case FieldRename, FieldCopy:
+		if op.From == "" || op.To == "" {
+			return nil, errors.New("from and to are required")
+		}
+	case FieldRemove, FieldKeep:
+		if len(op.Paths) == 0 {
+			return nil, errors.New("paths are required")
+		}
+		for _, path := range op.Paths {
+			if path == "" {
+				return nil, errors.New("paths must not be empty")
+			}
+		}
+	case FieldSet:
+		if op.To == "" {
+			return nil, errors.New("to is required")
+		}
+		if op.Template != "" {
+			if op.Value != nil {
+				return nil, errors.New("value and template are exclusive")
+			}
+			template, err := parseTemplate(op.Template)
+			if err != nil {
+				return nil, err
+			}
+			o.template = template
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+
+	return o, nil
+}
+
+func parseTemplate(template string) ([]templatePart, error) {
+	var parts []templatePart
+
+	for template != "" {
+		start := strings.Index(template, "${")
+		if start < 0 {
+			parts = append(parts, templatePart{literal: template})
+			break
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in template %q", template)
+		}
+		end += start
+
+		path := template[start+2 : end]
+		if path == "" {
+			return nil, errors.New("empty placeholder in template")
+		}
+
+		parts = append(parts, templatePart{literal: template[:start], path: path})
+		template = template[end+1:]
+	}
+
+	return parts, nil
+}
+
+func (o *fieldOperation) apply(doc string) (string, error) {
+	switch o.Op {
+	case FieldRename:
+		value := gjson.Get(doc, o.From)
+		if !value.Exists() {
+			return doc, nil
+		}
+		// From is deleted first, so that To may be nested under From, such as "host" renamed to "host.name"
+		doc, err := sjson.Delete(doc, o.From)
+		if err != nil {
+			return "", err
+		}
+		return sjson.SetRaw(doc, o.To, value.Raw)
+	case FieldCopy:
+		value := gjson.Get(doc, o.From)
+		if !value.Exists() {
+			return doc, nil
+		}
+		return sjson.SetRaw(doc, o.To, value.Raw)
+	case FieldRemove:
+		var err error
+		for _, path := range o.Paths {
+			if doc, err = sjson.Delete(doc, path); err != nil {
+				return "", err
+			}
+		}
+		return doc, nil
+	case FieldKeep:
+		kept := "{}"
+		for _, path := range o.Paths {
+			value := gjson.Get(doc, path)
+			if !value.Exists() {
+				continue
+			}
+
+			var err error
+			if kept, err = sjson.SetRaw(kept, path, value.Raw); err != nil {
+				return "", err
+			}
+		}
+		return kept, nil
+	default: // FieldSet
+		if o.template == nil {
+			return sjson.Set(doc, o.To, o.Value)
+		}
+		return sjson.Set(doc, o.To, o.render(doc))
+	}
+}
+
+func (o *fieldOperation) render(doc string) string {
+	b := &strings.Builder{}
+	for _, part := range o.template {
+		b.WriteString(part.literal)
+		if part.path != "" {
+			b.WriteString(gjson.Get(doc, part.path).String())
+		}
+	}
+
+	return b.String()
+}
+
+// FieldTransformRule is a transform rule that changes the fields of the JSON encoded content of events,
+// applying its operations in order.
+// It works for any T that round-trips through JSON.
+type FieldTransformRule[T any] struct {
+	name       string
+	operations []*fieldOperation
+}
+
+// NewFieldTransformRule creates a FieldTransformRule applying the operations in order.
+// It returns an error if an operation is invalid.
+func NewFieldTransformRule[T any](name string, operations ...FieldOperation) (*FieldTransformRule[T], error) {
+	if len(operations) == 0 {
+		return nil, errors.New("no field operations")
+	}
+
+	r := &FieldTransformRule[T]{name: name}
+	for i, op := range operations {
+		o, err := newFieldOperation(op)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field operation #%d: %w", i, err)
+		}
+		r.operations = append(r.operations, o)
+	}
+
+	return r, nil
+}
+
+func (r *FieldTransformRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *FieldTransformRule[T]) RuleType() RuleType {
+	return TypeTransform
+}
+
+func (r *FieldTransformRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	data, err := evt.MarshalJSON()
+	if err != nil {
+		return ErrorResult[T]{Err: fmt.Errorf("failed to marshal event: %w", err)}
+	}
+
+	doc := string(data)
+	for _, o := range r.operations {
+		if doc, err = o.apply(doc); err != nil {
+			return ErrorResult[T]{Err: fmt.Errorf("failed to %s field: %w", o.Op, err)}
+		}
+	}
+
+	if err := setContent(evt, doc); err != nil {
+		return ErrorResult[T]{Err: err}
+	}
+
+	return TransformResult[T]{Event: evt}
+}
+
+// setContent replaces the content of the event with the JSON document.
+// It decodes into a new value, since decoding into the current content would keep the removed fields.
+func setContent[T any](evt *event.Event[T], doc string) error {
+	var content T
+	if err := json.Unmarshal([]byte(doc), &content); err != nil {
+		return fmt.Errorf("failed to unmarshal transformed event: %w", err)
+	}
+	evt.SetContent(content)
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package rule_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldTransformRule(t *testing.T) {
+	t.Parallel()
+
+	const input = `{
+		"user": {"name": "alice", "email": "alice@example.com", "password": "secret"},
+		"host": "web-1",
+		"headers": {"authorization": "Bearer x", "user-agent": "curl"},
+		"debug": {"trace": [1, 2, 3]}
+	}`
+
+	testCases := map[string]struct {
+		operations []rule.FieldOperation
+		want       string
+	}{
+		"rename": {
+			operations: []rule.FieldOperation{rule.RenameField("host", "source.host")},
+			want: `{
+				"user": {"name": "alice", "email": "alice@example.com", "password": "secret"},
+				"source": {"host": "web-1"},
+				"headers": {"authorization": "Bearer x", "user-agent": "curl"},
+				"debug": {"trace": [1, 2, 3]}
+			}`,
+		},
+		"rename under itself": {
+			operations: []rule.FieldOperation{rule.RenameField("host", "host.name")},
+			want: `{
+				"user": {"name": "alice", "email": "alice@example.com", "password": "secret"},
+				"host": {"name": "web-1"},
+				"headers": {"authorization": "Bearer x", "user-agent": "curl"},
+				"debug": {"trace": [1, 2, 3]}
+			}`,
+		},
+		"rename to parent": {
+			operations: []rule.FieldOperation{rule.RenameField("debug.trace", "debug")},
+			want: `{
+				"user": {"name": "alice", "email": "alice@example.com", "password": "secret"},
+				"host": "web-1",
+				"headers": {"authorization": "Bearer x", "user-agent": "curl"},
+				"debug": [1, 2, 3]
+			}`,
+		},
+		"rename missing": {
+			operations: []rule.FieldOperation{rule.RenameField("missing", "other")},
+			want:       input,
+		},
+		"remove": {
+			operations: []rule.FieldOperation{rule.RemoveFields("user.password", "headers.authorization", "debug")},
+			want: `{
+				"user": {"name": "alice", "email": "alice@example.com"},
+				"host": "web-1",
+				"headers": {"user-agent": "curl"}
+			}`,
+		},
+		"keep": {
+			operations: []rule.FieldOperation{rule.KeepFields("user.name", "host", "missing")},
+			want:       `{"user": {"name": "alice"}, "host": "web-1"}`,
+		},
+		"copy": {
+			operations: []rule.FieldOperation{
+				rule.CopyField("debug.trace", "trace"),
+				rule.KeepFields("trace", "debug"),
+			},
+			want: `{"trace": [1, 2, 3], "debug": {"trace": [1, 2, 3]}}`,
+		},
+		"set": {
+			operations: []rule.FieldOperation{
+				rule.SetField("env", "production"),
+				rule.SetField("user.verified", true),
+				rule.KeepFields("env", "user.verified"),
+			},
+			want: `{"env": "production", "user": {"verified": true}}`,
+		},
+		"set template": {
+			operations: []rule.FieldOperation{
+				rule.SetFieldTemplate("id", "${host}/${user.name}${missing}"),
+				rule.KeepFields("id"),
+			},
+			want: `{"id": "web-1/alice"}`,
+		},
+		"operations in order": {
+			operations: []rule.FieldOperation{
+				rule.RenameField("user.email", "email"),
+				rule.KeepFields("email", "user.name"),
+				rule.SetFieldTemplate("user.display", "${user.name} <${email}>"),
+			},
+			want: `{"email": "alice@example.com", "user": {"name": "alice", "display": "alice <alice@example.com>"}}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := rule.NewFieldTransformRule[map[string]any]("fields", tc.operations...)
+			require.NoError(t, err)
+
+			var content map[string]any
+			require.NoError(t, json.Unmarshal([]byte(input), &content))
+			evt := event.NewEvent(&event.RawEvent[map[string]any]{Content: content})
+
+			result := r.Apply(evt)
+			assert.Equal(t, rule.TransformResult[map[string]any]{Event: evt}, result)
+
+			got, err := json.Marshal(evt.Content())
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(got))
+		})
+	}
+}
+
+func TestFieldTransformRule_Struct(t *testing.T) {
+	t.Parallel()
+
+	type User struct {
+		Name     string `json:"name"`
+		Password string `json:"password,omitempty"`
+		Team     string `json:"team,omitempty"`
+	}
+
+	r, err := rule.NewFieldTransformRule[*User]("strip-password",
+		rule.RemoveFields("password"),
+		rule.SetField("team", "security"),
+	)
+	require.NoError(t, err)
+
+	evt := event.NewEvent(&event.RawEvent[*User]{Content: &User{Name: "alice", Password: "secret"}})
+	r.Apply(evt)
+
+	assert.Equal(t, &User{Name: "alice", Team: "security"}, evt.Content())
+}
+
+func TestNewFieldTransformRule_Invalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		operations []rule.FieldOperation
+		wantErr    string
+	}{
+		"no operations": {
+			wantErr: "no field operations",
+		},
+		"unknown operation": {
+			operations: []rule.FieldOperation{{Op: "move"}},
+			wantErr:    `invalid field operation #0: unknown operation "move"`,
+		},
+		"rename without target": {
+			operations: []rule.FieldOperation{rule.RenameField("a", "")},
+			wantErr:    "from and to are required",
+		},
+		"remove without paths": {
+			operations: []rule.FieldOperation{rule.SetField("a", 1), rule.RemoveFields()},
+			wantErr:    "invalid field operation #1: paths are required",
+		},
+		"value and template": {
+			operations: []rule.FieldOperation{{Op: rule.FieldSet, To: "a", Value: 1, Template: "${b}"}},
+			wantErr:    "value and template are exclusive",
+		},
+		"unterminated placeholder": {
+			operations: []rule.FieldOperation{rule.SetFieldTemplate("a", "${b")},
+			wantErr:    "unterminated placeholder",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := rule.NewFieldTransformRule[map[string]any]("fields", tc.operations...)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
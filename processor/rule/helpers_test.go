@@ -0,0 +1,19 @@
+package rule_test
+
+import (
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+)
+
+type webhook struct {
+	ID      string `json:"id"`
+	Attempt int    `json:"attempt"`
+}
+
+// applyFilter applies the filter rule to an event with the content, and reports whether it is dropped.
+func applyFilter(r rule.Rule[webhook], content webhook) (*event.Event[webhook], bool) {
+	evt := event.NewEvent(&event.RawEvent[webhook]{Content: content})
+	result := r.Apply(evt).(rule.FilterResult[webhook])
+
+	return evt, result.Drop
+}
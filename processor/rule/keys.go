@@ -0,0 +1,85 @@
+package rule
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+type eventKey = [sha256.Size]byte
+
+// keyOf returns the hash of the values at the gjson paths in the JSON encoded event,
+// or of the whole content if no paths are given.
+func keyOf[T any](evt *event.Event[T], paths []string) (eventKey, error) {
+	data, err := evt.MarshalJSON()
+	if err != nil {
+		return eventKey{}, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if len(paths) == 0 {
+		return sha256.Sum256(data), nil
+	}
+
+	h := sha256.New()
+	for _, result := range gjson.GetManyBytes(data, paths...) {
+		// The raw JSON distinguishes a missing value from an empty string.
+		h.Write([]byte(result.Raw))
+		h.Write([]byte{0})
+	}
+
+	var key eventKey
+	h.Sum(key[:0])
+
+	return key, nil
+}
+
+// keyLRU holds a bounded number of values by key, forgetting the least recently used first.
+// It is not safe for concurrent use.
+type keyLRU[V any] struct {
+	max     int
+	order   *list.List
+	entries map[eventKey]*list.Element
+}
+
+type keyLRUEntry[V any] struct {
+	key   eventKey
+	value V
+}
+
+func newKeyLRU[V any](max int) *keyLRU[V] {
+	return &keyLRU[V]{
+		max:     max,
+		order:   list.New(),
+		entries: map[eventKey]*list.Element{},
+	}
+}
+
+// get returns the value of the key and marks it as the most recently used.
+func (c *keyLRU[V]) get(key eventKey) (V, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+
+	return elem.Value.(*keyLRUEntry[V]).value, true
+}
+
+// add stores the value of a new key, evicting the least recently used key beyond the bound.
+func (c *keyLRU[V]) add(key eventKey, value V) {
+	c.entries[key] = c.order.PushFront(&keyLRUEntry[V]{key: key, value: value})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*keyLRUEntry[V]).key)
+	}
+}
+
+func (c *keyLRU[V]) len() int {
+	return c.order.Len()
+}
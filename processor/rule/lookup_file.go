@@ -0,0 +1,466 @@
+package rule
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/strategy"
+)
+
+var (
+	_ LookupTableProvider = (*LookupFile)(nil)
+	_ Starter             = (*LookupFile)(nil)
+)
+
+// DefaultLookupPollInterval is the default interval at which a LookupFile checks its file for changes.
+const DefaultLookupPollInterval = 30 * time.Second
+
+// LookupTableProvider provides the table of a LookupRule, such as a LookupFile reloading it from a file.
+type LookupTableProvider interface {
+	// LookupTable returns the current table with its version, which changes each time the table is replaced,
+	// so that the rules using the provider compile each table once.
+	LookupTable() (LookupTable, uint64)
+}
+
+// LookupFileFormat is the format of the file of a LookupFile.
+type LookupFileFormat string
+
+const (
+	LookupFormatCSV  LookupFileFormat = "csv"
+	LookupFormatJSON LookupFileFormat = "json"
+)
+
+// LookupFileConfig configures a LookupFile.
+type LookupFileConfig struct {
+	// Name identifies the table in metrics and logs. If empty, the path is used.
+	Name string `json:"name,omitempty"`
+	// Path is the path of the file.
+	Path string `json:"path"`
+	// Format is the format of the file. If empty, it is detected from the extension of the path, .csv or .json.
+	Format LookupFileFormat `json:"format,omitempty"`
+	// KeyColumn is the column of a CSV file, or the field of the objects in a JSON array, holding the keys of the entries.
+	// If empty, the first column of a CSV file is used. It is required for a JSON array.
+	KeyColumn string `json:"key_column,omitempty"`
+	// PollInterval is the interval at which the file is checked for changes of its modification time or size.
+	// If zero, DefaultLookupPollInterval is used.
+	PollInterval time.Duration `json:"poll_interval,omitempty"`
+	// ReloadInterval is the interval at which the file is reloaded even if it has not changed.
+	// If zero, the file is reloaded only when it changes.
+	ReloadInterval time.Duration `json:"reload_interval,omitempty"`
+}
+
+// LookupFile is a LookupTableProvider whose table is loaded from a CSV or JSON file and reloaded when it changes.
+//
+// While it is started, the file is checked every PollInterval and reloaded in the background,
+// so that events are not delayed by a reload. The new table replaces the previous one atomically.
+// If a reload fails, the previous table is kept until the file changes again.
+//
+// The first row of a CSV file is the header naming the columns.
+// Each following row is an entry keyed by its KeyColumn, with the other non-empty columns as its fields.
+// A JSON file is either an object of entries by their keys, whose values are objects of their fields,
+// or an array of objects keyed by their KeyColumn field.
+// Fields that are not strings are kept as their JSON text, and null fields are skipped.
+// Entries with an empty key are skipped, and an entry replaces the previous one with the same key.
+type LookupFile struct {
+	name           string
+	path           string
+	format         LookupFileFormat
+	keyColumn      string
+	pollInterval   time.Duration
+	reloadInterval time.Duration
+
+	clock        strategy.Clock
+	metrics      *metrics.Metrics
+	errorHandler func(err error)
+
+	table atomic.Pointer[versionedLookupTable]
+	// loadedAt is the time in Unix nanoseconds when the table was last loaded successfully.
+	loadedAt atomic.Int64
+
+	// runMu guards starts, stop and done.
+	runMu sync.Mutex
+	// starts is the number of Start calls not followed by Stop yet.
+	starts int
+	stop   chan struct{}
+	done   chan struct{}
+
+	mu sync.Mutex
+	// modTime and size are the modification time and size of the file last loaded, even if it failed,
+	// so that an invalid file is reloaded only when it changes again.
+	modTime time.Time
+	size    int64
+	// version is the version of the last table loaded.
+	version uint64
+}
+
+type versionedLookupTable struct {
+	table   LookupTable
+	version uint64
+}
+
+type LookupFileOptionsFunc func(*LookupFile)
+
+// WithLookupFileClock sets the clock scheduling the checks of the file. If not specified, strategy.DefaultClock is used.
+func WithLookupFileClock(clock strategy.Clock) LookupFileOptionsFunc {
+	return func(f *LookupFile) {
+		f.clock = clock
+	}
+}
+
+// WithLookupFileMetrics records the reloads and the size of the table in m.
+func WithLookupFileMetrics(m *metrics.Metrics) LookupFileOptionsFunc {
+	return func(f *LookupFile) {
+		f.metrics = m
+	}
+}
+
+// WithLookupFileErrorHandler calls fn with the errors of the reloads in the background.
+// If not specified, the errors are logged.
+func WithLookupFileErrorHandler(fn func(err error)) LookupFileOptionsFunc {
+	return func(f *LookupFile) {
+		f.errorHandler = fn
+	}
+}
+
+// NewLookupFile creates a LookupFile and loads its table.
+// It returns an error if the file cannot be loaded.
+func NewLookupFile(config LookupFileConfig, opts ...LookupFileOptionsFunc) (*LookupFile, error) {
+	if config.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	if config.PollInterval < 0 {
+		return nil, errors.New("poll interval must not be negative")
+	}
+	if config.ReloadInterval < 0 {
+		return nil, errors.New("reload interval must not be negative")
+	}
+
+	format := config.Format
+	if format == "" {
+		format = LookupFileFormat(strings.TrimPrefix(strings.ToLower(filepath.Ext(config.Path)), "."))
+	}
+	if format != LookupFormatCSV && format != LookupFormatJSON {
+		return nil, fmt.Errorf("unknown lookup file format %q", format)
+	}
+
+	f := &LookupFile{
+		name:           config.Name,
+		path:           config.Path,
+		format:         format,
+		keyColumn:      config.KeyColumn,
+		pollInterval:   config.PollInterval,
+		reloadInterval: config.ReloadInterval,
+		clock:          strategy.DefaultClock,
+		errorHandler: func(err error) {
+			log.Error(err.Error())
+		},
+	}
+	if f.name == "" {
+		f.name = f.path
+	}
+	if f.pollInterval == 0 {
+		f.pollInterval = DefaultLookupPollInterval
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	f.mu.Lock()
+	err := f.load()
+	f.mu.Unlock()
+	f.metrics.LookupTableReloaded(f.name, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lookup table %s: %w", f.name, err)
+	}
+
+	f.metrics.SetLookupTableFunc(f.name,
+		func() int { return len(f.table.Load().table) },
+		func() time.Time { return time.Unix(0, f.loadedAt.Load()) },
+	)
+
+	return f, nil
+}
+
+// LookupTable returns the current table with its version, which is incremented each time the file is reloaded.
+func (f *LookupFile) LookupTable() (LookupTable, uint64) {
+	current := f.table.Load()
+	return current.table, current.version
+}
+
+// Start starts checking the file for changes every PollInterval, until Stop is called as many times as Start.
+// The rules using the LookupFile start and stop it with the processor applying them.
+func (f *LookupFile) Start() {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	f.starts++
+	if f.starts > 1 {
+		return
+	}
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+
+	// the ticker is created before returning, so that a tick of a mock clock is not missed
+	ticker := f.clock.NewTicker(f.pollInterval)
+	go f.run(f.stop, f.done, ticker)
+}
+
+// Stop stops checking the file once it is called as many times as Start,
+// and waits for a reload in progress to finish.
+func (f *LookupFile) Stop() {
+	f.runMu.Lock()
+	defer f.runMu.Unlock()
+
+	if f.starts == 0 {
+		return
+	}
+	f.starts--
+	if f.starts > 0 {
+		return
+	}
+
+	close(f.stop)
+	<-f.done
+}
+
+// Reload loads the table from the file and replaces the current table with it, even if the file has not changed.
+// If the file cannot be loaded, the current table is kept and an error is returned.
+func (f *LookupFile) Reload() error {
+	f.mu.Lock()
+	err := f.load()
+	f.mu.Unlock()
+
+	f.metrics.LookupTableReloaded(f.name, err)
+	if err != nil {
+		return fmt.Errorf("failed to reload lookup table %s, keeping the current table: %w", f.name, err)
+	}
+
+	return nil
+}
+
+func (f *LookupFile) run(stop <-chan struct{}, done chan<- struct{}, ticker *time.Ticker) {
+	defer close(done)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if err := f.reloadIfChanged(f.clock.Now()); err != nil {
+			f.errorHandler(err)
+		}
+	}
+}
+
+// reloadIfChanged reloads the table if the file has changed or the ReloadInterval has elapsed.
+func (f *LookupFile) reloadIfChanged(now time.Time) error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		f.metrics.LookupTableReloaded(f.name, err)
+		return fmt.Errorf("failed to reload lookup table %s, keeping the current table: %w", f.name, err)
+	}
+
+	f.mu.Lock()
+	changed := !info.ModTime().Equal(f.modTime) || info.Size() != f.size
+	f.mu.Unlock()
+	due := f.reloadInterval > 0 && now.Sub(time.Unix(0, f.loadedAt.Load())) >= f.reloadInterval
+
+	if !changed && !due {
+		return nil
+	}
+
+	return f.Reload()
+}
+
+// load loads the table from the file. f.mu must be held.
+func (f *LookupFile) load() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+
+	var table LookupTable
+	switch f.format {
+	case LookupFormatCSV:
+		table, err = readCSVLookupTable(file, f.keyColumn)
+	case LookupFormatJSON:
+		table, err = readJSONLookupTable(file, f.keyColumn)
+	}
+	if err != nil {
+		return err
+	}
+
+	f.version++
+	f.table.Store(&versionedLookupTable{table: table, version: f.version})
+	f.loadedAt.Store(f.clock.Now().UnixNano())
+	log.Info(fmt.Sprintf("loaded %d entries of lookup table %s", len(table), f.name))
+
+	return nil
+}
+
+func readCSVLookupTable(r io.Reader, keyColumn string) (LookupTable, error) {
+	reader := csv.NewReader(bufio.NewReader(r))
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("no header in CSV file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+	// spreadsheet applications may write a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	keyIndex := 0
+	if keyColumn != "" {
+		keyIndex = -1
+		for i, column := range header {
+			if column == keyColumn {
+				keyIndex = i
+				break
+			}
+		}
+		if keyIndex < 0 {
+			return nil, fmt.Errorf("key column %q is not in the header", keyColumn)
+		}
+	}
+
+	table := LookupTable{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV file: %w", err)
+		}
+
+		key := record[keyIndex]
+		if key == "" {
+			continue
+		}
+
+		entry := LookupTableEntry{}
+		for i, value := range record {
+			if i != keyIndex && value != "" {
+				entry[header[i]] = value
+			}
+		}
+		table[key] = entry
+	}
+
+	return table, nil
+}
+
+func readJSONLookupTable(r io.Reader, keyColumn string) (LookupTable, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	table := LookupTable{}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		if keyColumn == "" {
+			return nil, errors.New("key column is required for a JSON array")
+		}
+
+		var objects []map[string]json.RawMessage
+		if err := json.Unmarshal(data, &objects); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON file: %w", err)
+		}
+		for _, object := range objects {
+			key, err := lookupFieldValue(object[keyColumn])
+			if err != nil {
+				return nil, err
+			}
+			if key == "" {
+				continue
+			}
+			delete(object, keyColumn)
+
+			if table[key], err = lookupEntry(object); err != nil {
+				return nil, fmt.Errorf("invalid entry %q: %w", key, err)
+			}
+		}
+
+		return table, nil
+	}
+
+	var objects map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON file: %w", err)
+	}
+	for key, object := range objects {
+		if key == "" {
+			continue
+		}
+		if table[key], err = lookupEntry(object); err != nil {
+			return nil, fmt.Errorf("invalid entry %q: %w", key, err)
+		}
+	}
+
+	return table, nil
+}
+
+func lookupEntry(object map[string]json.RawMessage) (LookupTableEntry, error) {
+	entry := LookupTableEntry{}
+	for field, raw := range object {
+		if bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+		value, err := lookupFieldValue(raw)
+		if err != nil {
+			return nil, err
+		}
+		entry[field] = value
+	}
+
+	return entry, nil
+}
+
+// lookupFieldValue returns a JSON string as is, and other JSON values as their compact JSON text.
+func lookupFieldValue(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+
+	compact := &bytes.Buffer{}
+	if err := json.Compact(compact, raw); err != nil {
+		return "", err
+	}
+
+	return compact.String(), nil
+}
@@ -0,0 +1,225 @@
+package rule_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLookupFile(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		name    string
+		content string
+		config  rule.LookupFileConfig
+		expect  rule.LookupTable
+		wantErr string
+	}{
+		"csv keyed by the first column": {
+			name:    "customers.csv",
+			content: "\ufeffid,name,plan\n123,Big Company,Premium\n456,Small Business,\n,Nobody,Free\n123,Big Company,Enterprise\n",
+			expect: rule.LookupTable{
+				"123": {"name": "Big Company", "plan": "Enterprise"},
+				"456": {"name": "Small Business"},
+			},
+		},
+		"csv keyed by a column": {
+			name:    "customers.csv",
+			content: "name,id\n\"Big, Company\",123\n",
+			config:  rule.LookupFileConfig{KeyColumn: "id"},
+			expect:  rule.LookupTable{"123": {"name": "Big, Company"}},
+		},
+		"json object": {
+			name:    "customers.json",
+			content: `{"123": {"name": "Big Company", "seats": 50, "tags": ["a", "b"], "plan": null}, "": {"name": "Nobody"}}`,
+			expect:  rule.LookupTable{"123": {"name": "Big Company", "seats": "50", "tags": `["a","b"]`}},
+		},
+		"json array": {
+			name:    "customers.data",
+			content: `[{"id": 123, "name": "Big Company"}, {"name": "Nobody"}]`,
+			config:  rule.LookupFileConfig{Format: rule.LookupFormatJSON, KeyColumn: "id"},
+			expect:  rule.LookupTable{"123": {"name": "Big Company"}},
+		},
+		"unknown key column": {
+			name:    "customers.csv",
+			content: "id,name\n",
+			config:  rule.LookupFileConfig{KeyColumn: "customer"},
+			wantErr: `key column "customer" is not in the header`,
+		},
+		"empty csv": {
+			name:    "customers.csv",
+			wantErr: "no header in CSV file",
+		},
+		"json array without key column": {
+			name:    "customers.json",
+			content: `[{"id": "123"}]`,
+			wantErr: "key column is required for a JSON array",
+		},
+		"invalid json": {
+			name:    "customers.json",
+			content: `{"123": "Big Company"}`,
+			wantErr: "failed to parse JSON file: ",
+		},
+		"unknown format": {
+			name:    "customers.txt",
+			wantErr: `unknown lookup file format "txt"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tc.config.Path = filepath.Join(t.TempDir(), tc.name)
+			require.NoError(t, os.WriteFile(tc.config.Path, []byte(tc.content), 0600))
+
+			f, err := rule.NewLookupFile(tc.config)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			table, version := f.LookupTable()
+			assert.Equal(t, tc.expect, table)
+			assert.Equal(t, uint64(1), version)
+		})
+	}
+}
+
+func TestLookupFile_Reload(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "customers.csv")
+	write := func(content string) {
+		tmp := path + ".tmp"
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+		require.NoError(t, os.Rename(tmp, path))
+	}
+	write("id,name\n123,Big Company\n")
+
+	clock := testutils.NewMockClock()
+	m := metrics.New()
+	errs := make(chan error, 10)
+	f, err := rule.NewLookupFile(
+		rule.LookupFileConfig{Name: "customers", Path: path, PollInterval: time.Minute},
+		rule.WithLookupFileClock(clock),
+		rule.WithLookupFileMetrics(m),
+		rule.WithLookupFileErrorHandler(func(err error) { errs <- err }),
+	)
+	require.NoError(t, err)
+	entries := func() int {
+		table, _ := f.LookupTable()
+		return len(table)
+	}
+
+	r, err := rule.NewLookupRuleWithProvider[map[string]any](f, "id", "customer")
+	require.NoError(t, err)
+	// the table of a rule matching with an index is compiled again on each reload
+	globRule, err := rule.NewLookupRuleWithProvider(f, "id", "customer", rule.WithLookupMatch[map[string]any](rule.LookupMatchGlob))
+	require.NoError(t, err)
+	// the rules start the file they share
+	r.Start()
+	defer r.Stop()
+	globRule.Start()
+	defer globRule.Stop()
+	apply := func(r rule.Rule[map[string]any]) any {
+		evt := event.NewEvent(&event.RawEvent[map[string]any]{Content: map[string]any{"id": "123"}})
+		result := r.Apply(evt)
+		require.IsType(t, rule.TransformResult[map[string]any]{}, result)
+		return result.(rule.TransformResult[map[string]any]).Event.Content()["customer"]
+	}
+	lookup := func() any {
+		return apply(r)
+	}
+	assert.Equal(t, map[string]any{"name": "Big Company"}, lookup())
+	assert.Equal(t, map[string]any{"name": "Big Company"}, apply(globRule))
+
+	// the file is not checked until the poll interval elapses
+	write("id,name\n123,Big Company Inc.\n456,Small Business\n")
+	assert.Equal(t, map[string]any{"name": "Big Company"}, lookup())
+
+	clock.Add(time.Minute)
+	assert.Eventually(t, func() bool {
+		return entries() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, map[string]any{"name": "Big Company Inc."}, lookup())
+	assert.Equal(t, map[string]any{"name": "Big Company Inc."}, apply(globRule))
+
+	// an invalid file is reported and keeps the current table
+	write("id,name\n123,\"Big\n")
+	clock.Add(time.Minute)
+	select {
+	case err := <-errs:
+		assert.ErrorContains(t, err, "failed to reload lookup table customers, keeping the current table: ")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error is reported")
+	}
+	assert.Equal(t, 2, entries())
+
+	buf := &strings.Builder{}
+	_, err = m.Registry().WriteTo(buf)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), `conduit_lookup_table_reloads_total{table="customers",result="success"} 2`)
+	assert.Contains(t, buf.String(), `conduit_lookup_table_reloads_total{table="customers",result="failure"} 1`)
+	assert.Contains(t, buf.String(), `conduit_lookup_table_entries{table="customers"} 2`)
+
+	write("id,name\n789,Individual\n")
+	require.NoError(t, f.Reload())
+	assert.Nil(t, lookup())
+}
+
+func TestLookupFile_StartStop(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "customers.json")
+	write := func(content string) {
+		tmp := path + ".tmp"
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0600))
+		require.NoError(t, os.Rename(tmp, path))
+	}
+	write(`{"123": {"name": "Big Company"}}`)
+
+	f, err := rule.NewLookupFile(rule.LookupFileConfig{Path: path, PollInterval: 10 * time.Millisecond})
+	require.NoError(t, err)
+	entries := func() int {
+		table, _ := f.LookupTable()
+		return len(table)
+	}
+
+	// the file is reloaded without the table being used
+	f.Start()
+	f.Start()
+	write(`{"123": {"name": "Big Company"}, "456": {"name": "Small Business"}}`)
+	assert.Eventually(t, func() bool {
+		return entries() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the file is polled until it is stopped as many times as it is started
+	f.Stop()
+	write(`{}`)
+	assert.Eventually(t, func() bool {
+		return entries() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	f.Stop()
+	write(`{"123": {"name": "Big Company"}}`)
+	assert.Never(t, func() bool {
+		return entries() == 1
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	// a stopped file is reloaded only by Reload
+	f.Stop()
+	require.NoError(t, f.Reload())
+	assert.Equal(t, 1, entries())
+}
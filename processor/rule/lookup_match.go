@@ -0,0 +1,245 @@
+package rule
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mrtc0/conduit/log"
+)
+
+// LookupMatch is how the keys of the table of a LookupRule are matched against the key of an event.
+type LookupMatch string
+
+const (
+	// LookupMatchExact matches the table key equal to the key of the event.
+	LookupMatchExact LookupMatch = "exact"
+	// LookupMatchCIDR matches the table keys that are IP prefixes, such as "10.0.0.0/8", or IP addresses,
+	// containing the key of the event, which is an IP address. The longest prefix wins.
+	// Table keys that are neither are skipped with a warning.
+	LookupMatchCIDR LookupMatch = "cidr"
+	// LookupMatchGlob matches the table keys that are patterns, where "*" matches any sequence of characters
+	// and "?" matches a single character. A table key without wildcards wins,
+	// then the pattern with the most characters other than wildcards, then the first pattern in lexical order.
+	LookupMatchGlob LookupMatch = "glob"
+)
+
+// lookupIndex is a table compiled for a LookupMatch.
+type lookupIndex struct {
+	match           LookupMatch
+	caseInsensitive bool
+	// version is the version of the table of a LookupTableProvider.
+	version uint64
+
+	exact  map[string]LookupTableEntry
+	globs  []lookupGlob
+	v4, v6 *cidrTrie
+}
+
+type lookupGlob struct {
+	pattern string
+	entry   LookupTableEntry
+}
+
+func newLookupIndex(table LookupTable, match LookupMatch, caseInsensitive bool) *lookupIndex {
+	if (match == "" || match == LookupMatchExact) && !caseInsensitive {
+		// the keys are matched as they are, so the table is not copied
+		return &lookupIndex{match: match, exact: table}
+	}
+
+	idx := &lookupIndex{
+		match:           match,
+		caseInsensitive: caseInsensitive,
+		exact:           map[string]LookupTableEntry{},
+	}
+
+	// the keys are added in order, so that the keys equal but for their case, or CIDR prefixes equal once masked,
+	// are resolved the same way for every table
+	for _, key := range slices.Sorted(maps.Keys(table)) {
+		entry := table[key]
+
+		if match == LookupMatchCIDR {
+			prefix, err := parseLookupPrefix(key)
+			if err != nil {
+				log.Warn(fmt.Sprintf("LookupRule skipping invalid CIDR key %q: %v", key, err))
+				continue
+			}
+			idx.trie(prefix.Addr()).insert(prefix, entry)
+			continue
+		}
+
+		if caseInsensitive {
+			key = strings.ToLower(key)
+		}
+		if match == LookupMatchGlob && strings.ContainsAny(key, "*?") {
+			idx.globs = append(idx.globs, lookupGlob{pattern: key, entry: entry})
+			continue
+		}
+		idx.exact[key] = entry
+	}
+
+	slices.SortStableFunc(idx.globs, func(a, b lookupGlob) int {
+		return cmp.Compare(literalLength(b.pattern), literalLength(a.pattern))
+	})
+
+	return idx
+}
+
+func (idx *lookupIndex) lookup(key string) (LookupTableEntry, bool) {
+	if idx.match == LookupMatchCIDR {
+		addr, err := netip.ParseAddr(key)
+		if err != nil {
+			return nil, false
+		}
+		addr = addr.Unmap().WithZone("")
+
+		return idx.trie(addr).lookup(addr)
+	}
+
+	if idx.caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	if entry, ok := idx.exact[key]; ok {
+		return entry, true
+	}
+	for _, glob := range idx.globs {
+		if globMatch(glob.pattern, key) {
+			return glob.entry, true
+		}
+	}
+
+	return nil, false
+}
+
+func (idx *lookupIndex) trie(addr netip.Addr) *cidrTrie {
+	if addr.Is4() {
+		if idx.v4 == nil {
+			idx.v4 = &cidrTrie{}
+		}
+		return idx.v4
+	}
+
+	if idx.v6 == nil {
+		idx.v6 = &cidrTrie{}
+	}
+	return idx.v6
+}
+
+// parseLookupPrefix parses a CIDR prefix, or an IP address as the prefix of its full length.
+func parseLookupPrefix(key string) (netip.Prefix, error) {
+	if !strings.Contains(key, "/") {
+		addr, err := netip.ParseAddr(key)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap().WithZone("")
+
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(key)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+
+	return prefix.Masked(), nil
+}
+
+// cidrTrie is a binary radix trie of IP prefixes of one address family, finding the longest prefix containing an address.
+type cidrTrie struct {
+	root cidrNode
+}
+
+type cidrNode struct {
+	children [2]*cidrNode
+	entry    LookupTableEntry
+	ok       bool
+}
+
+func (t *cidrTrie) insert(prefix netip.Prefix, entry LookupTableEntry) {
+	addr := prefix.Addr().AsSlice()
+
+	n := &t.root
+	for i := range prefix.Bits() {
+		bit := addr[i/8] >> (7 - i%8) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &cidrNode{}
+		}
+		n = n.children[bit]
+	}
+	n.entry, n.ok = entry, true
+}
+
+func (t *cidrTrie) lookup(addr netip.Addr) (LookupTableEntry, bool) {
+	bytes := addr.AsSlice()
+
+	var entry LookupTableEntry
+	found := false
+	n := &t.root
+	for i := 0; n != nil; i++ {
+		if n.ok {
+			entry, found = n.entry, true
+		}
+		if i == len(bytes)*8 {
+			break
+		}
+		n = n.children[bytes[i/8]>>(7-i%8)&1]
+	}
+
+	return entry, found
+}
+
+// globMatch reports whether name matches the pattern, where "*" matches any sequence of characters
+// and "?" matches a single character.
+func globMatch(pattern, name string) bool {
+	px, nx := 0, 0
+	// nextPx and nextNx are where to restart when the pattern after the last "*" does not match,
+	// letting the "*" match one more character.
+	nextPx, nextNx := 0, 0
+	for px < len(pattern) || nx < len(name) {
+		if px < len(pattern) {
+			switch c := pattern[px]; c {
+			case '?':
+				if nx < len(name) {
+					_, size := utf8.DecodeRuneInString(name[nx:])
+					px++
+					nx += size
+					continue
+				}
+			case '*':
+				size := 1
+				if nx < len(name) {
+					_, size = utf8.DecodeRuneInString(name[nx:])
+				}
+				nextPx, nextNx = px, nx+size
+				px++
+				continue
+			default:
+				if nx < len(name) && name[nx] == c {
+					px++
+					nx++
+					continue
+				}
+			}
+		}
+		if 0 < nextNx && nextNx <= len(name) {
+			px, nx = nextPx, nextNx
+			continue
+		}
+		return false
+	}
+
+	return true
+}
+
+// literalLength returns the number of characters of the pattern other than wildcards.
+func literalLength(pattern string) int {
+	return utf8.RuneCountInString(pattern) - strings.Count(pattern, "*") - strings.Count(pattern, "?")
+}
@@ -1,7 +1,10 @@
 package rule
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
 
 	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/log"
@@ -11,26 +14,208 @@ import (
 
 var (
 	_ Rule[any] = (*LookupRule[any])(nil)
+	_ Starter   = (*LookupRule[any])(nil)
 )
 
 type LookupTableEntry map[string]string
 
 type LookupTable map[string]LookupTableEntry
 
+// DefaultLookupKeySeparator is the default separator of the values of a composite key of a LookupRule.
+const DefaultLookupKeySeparator = "|"
+
+// LookupRule enriches events with the entry of a table matching the value at Source, setting its fields under Target.
+// NewLookupRule validates the rule and compiles its Table, so that the table is not compiled for each event.
+// Changing the Table, Match or CaseInsensitive of the rule it creates has no effect; use a Provider to replace the table.
+// A LookupRule that is not created by NewLookupRule or NewLookupRuleWithProvider is validated and compiled for each event.
 type LookupRule[T any] struct {
-	Table  LookupTable
-	Source string
-	Target string
+	Table LookupTable
+	// Provider provides the table instead of Table if it is set, such as a LookupFile reloading it from a file.
+	// Each table it provides is compiled once, when it is first looked up. If the Provider is a Starter,
+	// it is started and stopped with the rule.
+	Provider LookupTableProvider
+	Source   string
+	// CompositeSources are further gjson paths whose values are appended to the value of Source, separated by KeySeparator,
+	// to make composite keys such as "web|prod". Events missing any of the values are not enriched.
+	CompositeSources []string
+	// KeySeparator separates the values of a composite key. If empty, DefaultLookupKeySeparator is used.
+	KeySeparator string
+	Target       string
+	// Match is how the table keys are matched against the key of an event. If empty, LookupMatchExact is used.
+	Match LookupMatch
+	// CaseInsensitive matches the table keys regardless of their case. It does not apply to LookupMatchCIDR.
+	CaseInsensitive bool
+	// Default is the entry enriching the events whose key matches no table key. If nil, such events are not enriched.
+	Default LookupTableEntry
+
+	// index is the table compiled for Match and CaseInsensitive by the constructors,
+	// and replaced by the last table of the Provider compiled.
+	index *atomic.Pointer[lookupIndex]
+}
+
+type LookupRuleOptionsFunc[T any] func(*LookupRule[T])
+
+// WithLookupMatch sets how the table keys are matched. If not specified, LookupMatchExact is used.
+func WithLookupMatch[T any](match LookupMatch) LookupRuleOptionsFunc[T] {
+	return func(r *LookupRule[T]) {
+		r.Match = match
+	}
+}
+
+// WithLookupCaseInsensitive matches the table keys regardless of their case.
+func WithLookupCaseInsensitive[T any]() LookupRuleOptionsFunc[T] {
+	return func(r *LookupRule[T]) {
+		r.CaseInsensitive = true
+	}
+}
+
+// WithLookupCompositeKey appends the values of the sources to the value of the source of the rule, separated by separator,
+// to make composite keys. If separator is empty, DefaultLookupKeySeparator is used.
+func WithLookupCompositeKey[T any](separator string, sources ...string) LookupRuleOptionsFunc[T] {
+	return func(r *LookupRule[T]) {
+		r.KeySeparator = separator
+		r.CompositeSources = sources
+	}
+}
+
+// WithLookupDefault enriches the events whose key matches no table key with entry.
+func WithLookupDefault[T any](entry LookupTableEntry) LookupRuleOptionsFunc[T] {
+	return func(r *LookupRule[T]) {
+		r.Default = entry
+	}
 }
 
 // NewLookupRule creates a new LookupRule with the specified lookup table, source field, and target field.
 // The lookup rule maps values from the source field to the target field using the provided lookup table.
-func NewLookupRule[T any](table LookupTable, source, target string) *LookupRule[T] {
-	return &LookupRule[T]{
+// It returns an error if the matching of the rule is misconfigured.
+func NewLookupRule[T any](table LookupTable, source, target string, opts ...LookupRuleOptionsFunc[T]) (*LookupRule[T], error) {
+	r := &LookupRule[T]{
 		Table:  table,
 		Source: source,
 		Target: target,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	r.index = &atomic.Pointer[lookupIndex]{}
+	r.index.Store(newLookupIndex(r.Table, r.Match, r.CaseInsensitive))
+
+	return r, nil
+}
+
+// NewLookupRuleWithProvider creates a new LookupRule using the latest table of the provider,
+// so that the events are enriched with the latest table of a LookupFile.
+// It returns an error if the matching of the rule is misconfigured.
+func NewLookupRuleWithProvider[T any](provider LookupTableProvider, source, target string, opts ...LookupRuleOptionsFunc[T]) (*LookupRule[T], error) {
+	r := &LookupRule[T]{
+		Provider: provider,
+		Source:   source,
+		Target:   target,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the table of the provider is compiled when it is first looked up
+	r.index = &atomic.Pointer[lookupIndex]{}
+
+	return r, nil
+}
+
+// Validate returns an error if the matching of the rule is misconfigured.
+// The rules created as a struct literal return the error from Apply as an ErrorResult, without looking up the events.
+func (r *LookupRule[T]) Validate() error {
+	switch r.Match {
+	case "", LookupMatchExact, LookupMatchGlob:
+	case LookupMatchCIDR:
+		if len(r.CompositeSources) > 0 {
+			return errors.New("composite keys cannot be matched as CIDR")
+		}
+	default:
+		return fmt.Errorf("unknown lookup match %q", r.Match)
+	}
+
+	return nil
+}
+
+// Start starts the Provider if it is a Starter, such as a LookupFile polling its file.
+func (r *LookupRule[T]) Start() {
+	if starter, ok := r.Provider.(Starter); ok {
+		starter.Start()
+	}
+}
+
+// Stop stops the Provider if it is a Starter.
+func (r *LookupRule[T]) Stop() {
+	if starter, ok := r.Provider.(Starter); ok {
+		starter.Stop()
+	}
+}
+
+// key returns the key of the event, or false if the event is missing any of the sources.
+func (r *LookupRule[T]) key(data string) (string, bool) {
+	result := gjson.Get(data, r.Source)
+	if !result.Exists() {
+		return "", false
+	}
+	if len(r.CompositeSources) == 0 {
+		return result.String(), true
+	}
+
+	separator := r.KeySeparator
+	if separator == "" {
+		separator = DefaultLookupKeySeparator
+	}
+
+	key := &strings.Builder{}
+	key.WriteString(result.String())
+	for _, result := range gjson.GetMany(data, r.CompositeSources...) {
+		if !result.Exists() {
+			return "", false
+		}
+		key.WriteString(separator)
+		key.WriteString(result.String())
+	}
+
+	return key.String(), true
+}
+
+// lookup returns the entry of the table matching the key.
+func (r *LookupRule[T]) lookup(key string) (LookupTableEntry, bool) {
+	if r.index == nil {
+		// the rule is not created by the constructors, so its fields may have changed since the last event
+		table := r.Table
+		if r.Provider != nil {
+			table, _ = r.Provider.LookupTable()
+		}
+		return newLookupIndex(table, r.Match, r.CaseInsensitive).lookup(key)
+	}
+
+	idx := r.index.Load()
+	if r.Provider == nil {
+		return idx.lookup(key)
+	}
+
+	table, version := r.Provider.LookupTable()
+	if idx == nil || idx.version != version {
+		// events applied concurrently may compile the same table, and the last index is kept
+		idx = newLookupIndex(table, r.Match, r.CaseInsensitive)
+		idx.version = version
+		r.index.Store(idx)
+	}
+
+	return idx.lookup(key)
+}
+
+func (r *LookupRule[T]) RuleName() string {
+	return "lookup:" + r.Source
 }
 
 func (r *LookupRule[T]) RuleType() RuleType {
@@ -38,19 +223,29 @@ func (r *LookupRule[T]) RuleType() RuleType {
 }
 
 func (r *LookupRule[T]) Apply(evt *event.Event[T]) Result[T] {
-	var err error
+	if r.index == nil {
+		if err := r.Validate(); err != nil {
+			return ErrorResult[T]{Err: err}
+		}
+	}
 
 	data, err := evt.MarshalJSON()
 	if err != nil {
+		return ErrorResult[T]{Err: fmt.Errorf("failed to marshal event: %w", err)}
+	}
+
+	key, ok := r.key(string(data))
+	if !ok {
 		return TransformResult[T]{
 			Event: evt,
 		}
 	}
 
-	result := gjson.Get(string(data), r.Source)
-
-	entry, exists := r.Table[result.String()]
+	entry, exists := r.lookup(key)
 	if !exists {
+		entry = r.Default
+	}
+	if entry == nil {
 		return TransformResult[T]{
 			Event: evt,
 		}
@@ -70,7 +265,7 @@ func (r *LookupRule[T]) Apply(evt *event.Event[T]) Result[T] {
 	}
 
 	if err := evt.UnmarshalJSON([]byte(enrichedMessage)); err != nil {
-		log.Warn(fmt.Sprintf("LookupRule failed unmarshalling enriched message: %v", err))
+		return ErrorResult[T]{Err: fmt.Errorf("failed to unmarshal enriched event: %w", err)}
 	}
 
 	return TransformResult[T]{
@@ -7,6 +7,7 @@ import (
 	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/processor/rule"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLookupRule(t *testing.T) {
@@ -43,7 +44,8 @@ func TestLookupRule(t *testing.T) {
 		},
 	}
 
-	r := rule.NewLookupRule[RequestEvent](table, "customer.id", "customer.details")
+	r, err := rule.NewLookupRule[RequestEvent](table, "customer.id", "customer.details")
+	require.NoError(t, err)
 
 	testCases := []struct {
 		input  *event.Event[RequestEvent]
@@ -127,3 +129,251 @@ func TestLookupRule(t *testing.T) {
 		})
 	}
 }
+
+func TestLookupRule_MarshalError(t *testing.T) {
+	t.Parallel()
+
+	r, err := rule.NewLookupRule[map[string]any](rule.LookupTable{}, "id", "details")
+	require.NoError(t, err)
+	result := r.Apply(event.NewEvent(&event.RawEvent[map[string]any]{
+		Content: map[string]any{"id": make(chan int)},
+	}))
+
+	errorResult, ok := result.(rule.ErrorResult[map[string]any])
+	if assert.True(t, ok) {
+		assert.ErrorContains(t, errorResult.Err, "failed to marshal event")
+	}
+}
+
+type lookupTables struct {
+	table   rule.LookupTable
+	version uint64
+}
+
+func (p *lookupTables) LookupTable() (rule.LookupTable, uint64) {
+	return p.table, p.version
+}
+
+func (p *lookupTables) replace(table rule.LookupTable) {
+	p.table = table
+	p.version++
+}
+
+func TestLookupRule_Match(t *testing.T) {
+	t.Parallel()
+
+	subnets := rule.LookupTable{
+		"10.0.0.0/8":     {"owner": "corp"},
+		"10.1.0.0/16":    {"owner": "network"},
+		"10.1.2.3":       {"owner": "gateway"},
+		"2001:db8::/32":  {"owner": "corp-v6"},
+		"not a network":  {"owner": "invalid"},
+		"192.168.0.0/16": {"owner": "home"},
+	}
+	hosts := rule.LookupTable{
+		"web-*":        {"role": "web"},
+		"web-prod-*":   {"role": "web-prod"},
+		"db-??":        {"role": "db"},
+		"web-prod-001": {"role": "canary"},
+	}
+
+	testCases := map[string]struct {
+		table   rule.LookupTable
+		source  string
+		opts    []rule.LookupRuleOptionsFunc[map[string]any]
+		content map[string]any
+		expect  any
+		wantErr string
+	}{
+		"cidr longest prefix": {
+			table:   subnets,
+			source:  "ip",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR)},
+			content: map[string]any{"ip": "10.1.200.1"},
+			expect:  map[string]any{"owner": "network"},
+		},
+		"cidr address": {
+			table:   subnets,
+			source:  "ip",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR)},
+			content: map[string]any{"ip": "10.1.2.3"},
+			expect:  map[string]any{"owner": "gateway"},
+		},
+		"cidr ipv4-mapped address": {
+			table:   subnets,
+			source:  "ip",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR)},
+			content: map[string]any{"ip": "::ffff:10.200.0.1"},
+			expect:  map[string]any{"owner": "corp"},
+		},
+		"cidr ipv6": {
+			table:   subnets,
+			source:  "ip",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR)},
+			content: map[string]any{"ip": "2001:DB8::1"},
+			expect:  map[string]any{"owner": "corp-v6"},
+		},
+		"cidr no match with default": {
+			table:  subnets,
+			source: "ip",
+			opts: []rule.LookupRuleOptionsFunc[map[string]any]{
+				rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR),
+				rule.WithLookupDefault[map[string]any](rule.LookupTableEntry{"owner": "unknown"}),
+			},
+			content: map[string]any{"ip": "172.16.0.1"},
+			expect:  map[string]any{"owner": "unknown"},
+		},
+		"cidr not an address": {
+			table:   subnets,
+			source:  "ip",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR)},
+			content: map[string]any{"ip": "not a network"},
+		},
+		"glob exact key wins": {
+			table:   hosts,
+			source:  "host",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchGlob)},
+			content: map[string]any{"host": "web-prod-001"},
+			expect:  map[string]any{"role": "canary"},
+		},
+		"glob most specific pattern": {
+			table:   hosts,
+			source:  "host",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchGlob)},
+			content: map[string]any{"host": "web-prod-002"},
+			expect:  map[string]any{"role": "web-prod"},
+		},
+		"glob single character": {
+			table:   hosts,
+			source:  "host",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchGlob)},
+			content: map[string]any{"host": "db-01"},
+			expect:  map[string]any{"role": "db"},
+		},
+		"glob no match": {
+			table:   hosts,
+			source:  "host",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any](rule.LookupMatchGlob)},
+			content: map[string]any{"host": "db-001"},
+		},
+		"glob case insensitive": {
+			table:  hosts,
+			source: "host",
+			opts: []rule.LookupRuleOptionsFunc[map[string]any]{
+				rule.WithLookupMatch[map[string]any](rule.LookupMatchGlob),
+				rule.WithLookupCaseInsensitive[map[string]any](),
+			},
+			content: map[string]any{"host": "WEB-Staging"},
+			expect:  map[string]any{"role": "web"},
+		},
+		"exact case insensitive": {
+			table:   rule.LookupTable{"Alice": {"team": "platform"}},
+			source:  "user",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupCaseInsensitive[map[string]any]()},
+			content: map[string]any{"user": "ALICE"},
+			expect:  map[string]any{"team": "platform"},
+		},
+		"composite key": {
+			table:   rule.LookupTable{"web/443": {"service": "https"}},
+			source:  "role",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupCompositeKey[map[string]any]("/", "port")},
+			content: map[string]any{"role": "web", "port": 443},
+			expect:  map[string]any{"service": "https"},
+		},
+		"composite key missing a source": {
+			table:  rule.LookupTable{"web|": {"service": "unknown"}},
+			source: "role",
+			opts: []rule.LookupRuleOptionsFunc[map[string]any]{
+				rule.WithLookupCompositeKey[map[string]any]("", "port"),
+				rule.WithLookupDefault[map[string]any](rule.LookupTableEntry{"service": "default"}),
+			},
+			content: map[string]any{"role": "web"},
+		},
+		"composite key with cidr": {
+			table:  subnets,
+			source: "ip",
+			opts: []rule.LookupRuleOptionsFunc[map[string]any]{
+				rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR),
+				rule.WithLookupCompositeKey[map[string]any]("", "port"),
+			},
+			content: map[string]any{"ip": "10.0.0.1", "port": 443},
+			wantErr: "composite keys cannot be matched as CIDR",
+		},
+		"unknown match": {
+			table:   subnets,
+			source:  "ip",
+			opts:    []rule.LookupRuleOptionsFunc[map[string]any]{rule.WithLookupMatch[map[string]any]("regex")},
+			content: map[string]any{"ip": "10.0.0.1"},
+			wantErr: `unknown lookup match "regex"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := rule.NewLookupRule(tc.table, tc.source, "details", tc.opts...)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			result := r.Apply(event.NewEvent(&event.RawEvent[map[string]any]{Content: tc.content}))
+			transformResult, ok := result.(rule.TransformResult[map[string]any])
+			if assert.True(t, ok) {
+				assert.Equal(t, tc.expect, transformResult.Event.Content()["details"])
+			}
+		})
+	}
+}
+
+func TestLookupRule_ReplacedTable(t *testing.T) {
+	t.Parallel()
+
+	tables := &lookupTables{table: rule.LookupTable{"10.0.0.0/8": {"owner": "corp"}}}
+	r, err := rule.NewLookupRuleWithProvider(tables, "ip", "details",
+		rule.WithLookupMatch[map[string]any](rule.LookupMatchCIDR),
+	)
+	require.NoError(t, err)
+	lookup := func() any {
+		result := r.Apply(event.NewEvent(&event.RawEvent[map[string]any]{Content: map[string]any{"ip": "10.1.2.3"}}))
+		return result.(rule.TransformResult[map[string]any]).Event.Content()["details"]
+	}
+	assert.Equal(t, map[string]any{"owner": "corp"}, lookup())
+
+	// the table replaced by the provider is compiled again
+	tables.replace(rule.LookupTable{"10.1.0.0/16": {"owner": "network"}})
+	assert.Equal(t, map[string]any{"owner": "network"}, lookup())
+}
+
+func TestLookupRule_WithoutConstructor(t *testing.T) {
+	t.Parallel()
+
+	r := &rule.LookupRule[map[string]any]{
+		Table:  rule.LookupTable{"web-*": {"role": "web"}},
+		Source: "host",
+		Target: "details",
+		Match:  rule.LookupMatchGlob,
+	}
+	apply := func() rule.Result[map[string]any] {
+		return r.Apply(event.NewEvent(&event.RawEvent[map[string]any]{Content: map[string]any{"host": "web-1"}}))
+	}
+	transformResult, ok := apply().(rule.TransformResult[map[string]any])
+	if assert.True(t, ok) {
+		assert.Equal(t, map[string]any{"role": "web"}, transformResult.Event.Content()["details"])
+	}
+
+	// the fields are used as they are when the rule is applied
+	r.Table = rule.LookupTable{"web-?": {"role": "frontend"}}
+	transformResult, ok = apply().(rule.TransformResult[map[string]any])
+	if assert.True(t, ok) {
+		assert.Equal(t, map[string]any{"role": "frontend"}, transformResult.Event.Content()["details"])
+	}
+
+	r.Match = "regex"
+	errorResult, ok := apply().(rule.ErrorResult[map[string]any])
+	if assert.True(t, ok) {
+		assert.EqualError(t, errorResult.Err, `unknown lookup match "regex"`)
+	}
+}
@@ -0,0 +1,145 @@
+package rule
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/strategy"
+)
+
+var (
+	_ Rule[any] = (*RateLimitRule[any])(nil)
+)
+
+const (
+	// DefaultRateLimitMaxKeys is the default number of keys tracked by a RateLimitRule.
+	DefaultRateLimitMaxKeys = 10000
+	// ReasonRateLimited is the reason of the events dropped by a RateLimitRule.
+	ReasonRateLimited = "rate_limited"
+)
+
+// RateLimit configures a RateLimitRule.
+type RateLimit struct {
+	// Name identifies the rule in metrics and logs.
+	Name string `json:"name,omitempty"`
+	// Keys are the gjson paths of the values the events are throttled by.
+	// If empty, all events share a single limit.
+	Keys []string `json:"keys,omitempty"`
+	// Rate is the number of events per second allowed for each key.
+	Rate float64 `json:"rate"`
+	// Burst is the number of events allowed for a key at once, after it was idle.
+	// If zero, Rate rounded up, or 1 if Rate is less than 1, is used.
+	Burst int `json:"burst,omitempty"`
+	// MaxKeys bounds the number of tracked keys. When it is reached, the least recently seen key is forgotten,
+	// so its next event starts with a full burst.
+	// If zero, DefaultRateLimitMaxKeys is used.
+	MaxKeys int `json:"max_keys,omitempty"`
+}
+
+// RateLimitRule is a filter rule that throttles events per key with a token bucket.
+type RateLimitRule[T any] struct {
+	name  string
+	keys  []string
+	rate  float64
+	burst float64
+	clock strategy.Clock
+
+	mu      sync.Mutex
+	buckets *keyLRU[*tokenBucket]
+}
+
+type tokenBucket struct {
+	tokens float64
+	// updatedAt is when tokens was last refilled.
+	updatedAt time.Time
+}
+
+type RateLimitRuleOptionsFunc[T any] func(*RateLimitRule[T])
+
+// WithRateLimitClock sets the clock refilling the buckets. If not specified, strategy.DefaultClock is used.
+func WithRateLimitClock[T any](clock strategy.Clock) RateLimitRuleOptionsFunc[T] {
+	return func(r *RateLimitRule[T]) {
+		r.clock = clock
+	}
+}
+
+// NewRateLimitRule creates a RateLimitRule.
+func NewRateLimitRule[T any](limit RateLimit, opts ...RateLimitRuleOptionsFunc[T]) (*RateLimitRule[T], error) {
+	if limit.Rate <= 0 || math.IsInf(limit.Rate, 0) || math.IsNaN(limit.Rate) {
+		return nil, errors.New("rate must be a positive number")
+	}
+	if limit.Burst < 0 {
+		return nil, errors.New("burst must not be negative")
+	}
+	if limit.MaxKeys < 0 {
+		return nil, errors.New("max keys must not be negative")
+	}
+
+	burst := limit.Burst
+	if burst == 0 {
+		burst = max(1, int(math.Ceil(limit.Rate)))
+	}
+	maxKeys := limit.MaxKeys
+	if maxKeys == 0 {
+		maxKeys = DefaultRateLimitMaxKeys
+	}
+
+	r := &RateLimitRule[T]{
+		name:    limit.Name,
+		keys:    limit.Keys,
+		rate:    limit.Rate,
+		burst:   float64(burst),
+		clock:   strategy.DefaultClock,
+		buckets: newKeyLRU[*tokenBucket](maxKeys),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r, nil
+}
+
+func (r *RateLimitRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *RateLimitRule[T]) RuleType() RuleType {
+	return TypeFilter
+}
+
+func (r *RateLimitRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	var key eventKey
+	if len(r.keys) > 0 {
+		var err error
+		if key, err = keyOf(evt, r.keys); err != nil {
+			return ErrorResult[T]{Err: err}
+		}
+	}
+
+	now := r.clock.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bucket, ok := r.buckets.get(key)
+	if !ok {
+		bucket = &tokenBucket{tokens: r.burst, updatedAt: now}
+		r.buckets.add(key, bucket)
+	}
+
+	if elapsed := now.Sub(bucket.updatedAt); elapsed > 0 {
+		bucket.tokens = min(r.burst, bucket.tokens+elapsed.Seconds()*r.rate)
+		bucket.updatedAt = now
+	}
+
+	if bucket.tokens < 1 {
+		return FilterResult[T]{Drop: true, Reason: ReasonRateLimited}
+	}
+	bucket.tokens--
+
+	return FilterResult[T]{Drop: false}
+}
@@ -0,0 +1,94 @@
+package rule_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitRule(t *testing.T) {
+	t.Parallel()
+
+	clock := testutils.NewMockClock()
+	r, err := rule.NewRateLimitRule(rule.RateLimit{
+		Keys:  []string{"id"},
+		Rate:  2,
+		Burst: 3,
+	}, rule.WithRateLimitClock[webhook](clock))
+	require.NoError(t, err)
+
+	passed := func(id string, n int) int {
+		count := 0
+		for range n {
+			if _, dropped := applyFilter(r, webhook{ID: id}); !dropped {
+				count++
+			}
+		}
+		return count
+	}
+
+	assert.Equal(t, 3, passed("a", 5), "burst")
+	assert.Equal(t, 3, passed("b", 5), "keys are limited independently")
+
+	clock.Add(500 * time.Millisecond)
+	assert.Equal(t, 1, passed("a", 5), "one token refilled")
+
+	clock.Add(time.Hour)
+	assert.Equal(t, 3, passed("a", 5), "refill is capped at the burst")
+
+	evt := event.NewEvent(&event.RawEvent[webhook]{Content: webhook{ID: "a"}})
+	assert.Equal(t, rule.FilterResult[webhook]{Drop: true, Reason: rule.ReasonRateLimited}, r.Apply(evt))
+}
+
+func TestRateLimitRule_Global(t *testing.T) {
+	t.Parallel()
+
+	clock := testutils.NewMockClock()
+	r, err := rule.NewRateLimitRule(rule.RateLimit{Rate: 0.5}, rule.WithRateLimitClock[webhook](clock))
+	require.NoError(t, err)
+
+	_, dropped := applyFilter(r, webhook{ID: "a"})
+	assert.False(t, dropped)
+	_, dropped = applyFilter(r, webhook{ID: "b"})
+	assert.True(t, dropped, "all events share the limit")
+
+	clock.Add(2 * time.Second)
+	_, dropped = applyFilter(r, webhook{ID: "b"})
+	assert.False(t, dropped)
+}
+
+func TestNewRateLimitRule_Invalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		limit   rule.RateLimit
+		wantErr string
+	}{
+		"zero rate": {
+			limit:   rule.RateLimit{},
+			wantErr: "rate must be a positive number",
+		},
+		"negative burst": {
+			limit:   rule.RateLimit{Rate: 1, Burst: -1},
+			wantErr: "burst must not be negative",
+		},
+		"negative max keys": {
+			limit:   rule.RateLimit{Rate: 1, MaxKeys: -1},
+			wantErr: "max keys must not be negative",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := rule.NewRateLimitRule[webhook](tc.limit)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package rule
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var (
+	_ Rule[any]             = (*RedactRule[any])(nil)
+	_ FailurePolicyProvider = (*RedactRule[any])(nil)
+)
+
+// Detector is a built-in detector of sensitive values.
+type Detector string
+
+const (
+	// DetectEmail detects email addresses.
+	DetectEmail Detector = "email"
+	// DetectIPv4 detects IPv4 addresses.
+	DetectIPv4 Detector = "ipv4"
+	// DetectIPv6 detects IPv6 addresses.
+	DetectIPv6 Detector = "ipv6"
+	// DetectCreditCard detects credit card numbers passing the Luhn check, optionally separated by spaces or dashes.
+	DetectCreditCard Detector = "credit_card"
+	// DetectJWT detects JSON Web Tokens.
+	DetectJWT Detector = "jwt"
+	// DetectAWSAccessKey detects AWS access key IDs.
+	DetectAWSAccessKey Detector = "aws_access_key"
+)
+
+// RedactMode is how a sensitive value is replaced.
+type RedactMode string
+
+const (
+	// RedactMask replaces the value with Mask.
+	RedactMask RedactMode = "mask"
+	// RedactPartial replaces all but the last KeepLast characters of the value with '*'.
+	RedactPartial RedactMode = "partial"
+	// RedactHMAC replaces the value with the hex encoded HMAC-SHA256 of the value with HMACKey,
+	// so that the same value is always replaced with the same pseudonym.
+	RedactHMAC RedactMode = "hmac"
+)
+
+const (
+	// DefaultRedactMask is the default replacement of RedactMask.
+	DefaultRedactMask = "[REDACTED]"
+	// DefaultRedactKeepLast is the default number of characters kept by RedactPartial.
+	DefaultRedactKeepLast = 4
+)
+
+// detector finds the sensitive values matching a regular expression and, if set, the validation.
+type detector struct {
+	re       *regexp.Regexp
+	validate func(match string) bool
+}
+
+var detectors = map[Detector]*detector{
+	DetectEmail: {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	DetectIPv4: {
+		re: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`),
+	},
+	DetectIPv6: {
+		re:       regexp.MustCompile(`(?i)(?:[0-9a-f]{0,4}:){2,7}(?:(?:\d{1,3}\.){3}\d{1,3}|[0-9a-f]{1,4})?`),
+		validate: isIPv6,
+	},
+	DetectCreditCard: {
+		re:       regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		validate: isCreditCardNumber,
+	},
+	DetectJWT: {
+		re: regexp.MustCompile(`\beyJ[A-Za-z0-9_\-]+\.eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*`),
+	},
+	DetectAWSAccessKey: {
+		re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA|APKA)[A-Z0-9]{16}\b`),
+	},
+}
+
+func isIPv6(s string) bool {
+	addr, err := netip.ParseAddr(s)
+	return err == nil && addr.Is6()
+}
+
+// isCreditCardNumber reports whether s has 13 to 19 digits passing the Luhn check.
+func isCreditCardNumber(s string) bool {
+	digits := make([]int, 0, len(s))
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			digits = append(digits, int(c-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+
+	return sum%10 == 0
+}
+
+// Redaction configures a RedactRule.
+type Redaction struct {
+	// Name identifies the rule in metrics and logs.
+	Name string `json:"name,omitempty"`
+	// Paths are the gjson paths of the values to redact. Objects and arrays at the paths are redacted recursively.
+	// If empty, all string values of the event are scanned with the Detectors and Patterns.
+	Paths []string `json:"paths,omitempty"`
+	// Detectors are the built-in detectors of the sensitive parts of the values.
+	Detectors []Detector `json:"detectors,omitempty"`
+	// Patterns are regular expressions matching the sensitive parts of the values, in addition to the Detectors.
+	// If neither Detectors nor Patterns are given, the values at Paths are redacted entirely.
+	Patterns []string `json:"patterns,omitempty"`
+	// Mode is how the sensitive values are replaced. If empty, RedactMask is used.
+	Mode RedactMode `json:"mode,omitempty"`
+	// Mask is the replacement of RedactMask. If empty, DefaultRedactMask is used.
+	Mask string `json:"mask,omitempty"`
+	// KeepLast is the number of characters kept by RedactPartial. If zero, DefaultRedactKeepLast is used.
+	KeepLast int `json:"keep_last,omitempty"`
+	// HMACKey is the secret key of RedactHMAC.
+	HMACKey []byte `json:"-"`
+	// FailurePolicy is the policy of the events that could not be redacted, such as when a redacted number
+	// no longer fits its field of T. It is never FailureSkip, so that the events are not passed on unredacted.
+	// If zero, FailureDrop is used.
+	FailurePolicy FailurePolicy `json:"-"`
+}
+
+// RedactRule is a transform rule that masks or pseudonymises sensitive values in the JSON encoded content of events.
+type RedactRule[T any] struct {
+	name      string
+	paths     []string
+	detectors []*detector
+	mode      RedactMode
+	mask      string
+	keepLast  int
+	hmacKey   []byte
+	policy    FailurePolicy
+}
+
+// NewRedactRule creates a RedactRule.
+// It returns an error if the redaction is invalid, such as an unknown detector or a missing HMAC key.
+func NewRedactRule[T any](redaction Redaction) (*RedactRule[T], error) {
+	r := &RedactRule[T]{
+		name:     redaction.Name,
+		paths:    redaction.Paths,
+		mode:     redaction.Mode,
+		mask:     redaction.Mask,
+		keepLast: redaction.KeepLast,
+		hmacKey:  redaction.HMACKey,
+		policy:   redaction.FailurePolicy,
+	}
+
+	for _, name := range redaction.Detectors {
+		d, ok := detectors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown detector %q", name)
+		}
+		r.detectors = append(r.detectors, d)
+	}
+	for _, pattern := range redaction.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		r.detectors = append(r.detectors, &detector{re: re})
+	}
+
+	if len(r.paths) == 0 && len(r.detectors) == 0 {
+		return nil, errors.New("paths, detectors or patterns are required")
+	}
+
+	if r.mode == "" {
+		r.mode = RedactMask
+	}
+	switch r.mode {
+	case RedactMask:
+		if r.mask == "" {
+			r.mask = DefaultRedactMask
+		}
+	case RedactPartial:
+		if r.keepLast < 0 {
+			return nil, errors.New("keep_last must not be negative")
+		}
+		if r.keepLast == 0 {
+			r.keepLast = DefaultRedactKeepLast
+		}
+	case RedactHMAC:
+		if len(r.hmacKey) == 0 {
+			return nil, errors.New("HMAC key is required")
+		}
+	default:
+		return nil, fmt.Errorf("unknown redact mode %q", r.mode)
+	}
+
+	switch r.policy {
+	case FailureSkip:
+		r.policy = FailureDrop
+	case FailureDrop, FailureDeadLetter, FailureHalt:
+	default:
+		return nil, fmt.Errorf("unknown failure policy %s", r.policy)
+	}
+
+	return r, nil
+}
+
+func (r *RedactRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *RedactRule[T]) RuleType() RuleType {
+	return TypeTransform
+}
+
+// FailurePolicy returns the policy of the events that could not be redacted, FailureDrop by default.
+func (r *RedactRule[T]) FailurePolicy() FailurePolicy {
+	return r.policy
+}
+
+func (r *RedactRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	data, err := evt.MarshalJSON()
+	if err != nil {
+		return ErrorResult[T]{Err: fmt.Errorf("failed to marshal event: %w", err)}
+	}
+
+	doc := string(data)
+	if len(r.paths) == 0 {
+		doc, err = r.redactRaw(doc)
+		if err != nil {
+			return ErrorResult[T]{Err: err}
+		}
+	}
+	for _, path := range r.paths {
+		value := gjson.Get(doc, path)
+		if !value.Exists() {
+			continue
+		}
+
+		redacted, err := r.redactRaw(value.Raw)
+		if err != nil {
+			return ErrorResult[T]{Err: err}
+		}
+		if doc, err = sjson.SetRaw(doc, path, redacted); err != nil {
+			return ErrorResult[T]{Err: fmt.Errorf("failed to set redacted value at %q: %w", path, err)}
+		}
+	}
+
+	if err := setContent(evt, doc); err != nil {
+		return ErrorResult[T]{Err: err}
+	}
+
+	return TransformResult[T]{Event: evt}
+}
+
+// redactRaw redacts the JSON value and returns it JSON encoded.
+func (r *RedactRule[T]) redactRaw(raw string) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return "", fmt.Errorf("failed to decode value: %w", err)
+	}
+
+	b := &bytes.Buffer{}
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.redactValue(value)); err != nil {
+		return "", fmt.Errorf("failed to encode redacted value: %w", err)
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+func (r *RedactRule[T]) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			v[key] = r.redactValue(child)
+		}
+		return v
+	case []any:
+		for i, child := range v {
+			v[i] = r.redactValue(child)
+		}
+		return v
+	case string:
+		return r.redactString(v)
+	case json.Number:
+		// Numbers such as card numbers are redacted when the whole value is redacted or a detector matches it.
+		if redacted := r.redactString(v.String()); redacted != v.String() {
+			return redacted
+		}
+		return v
+	default:
+		if len(r.detectors) == 0 && v != nil {
+			return r.replace(fmt.Sprint(v))
+		}
+		return v
+	}
+}
+
+// redactString replaces the sensitive parts of s, or all of s if the rule has no detectors.
+func (r *RedactRule[T]) redactString(s string) string {
+	if len(r.detectors) == 0 {
+		return r.replace(s)
+	}
+
+	for _, d := range r.detectors {
+		s = d.re.ReplaceAllStringFunc(s, func(match string) string {
+			if d.validate != nil && !d.validate(match) {
+				return match
+			}
+			return r.replace(match)
+		})
+	}
+
+	return s
+}
+
+func (r *RedactRule[T]) replace(s string) string {
+	switch r.mode {
+	case RedactPartial:
+		runes := []rune(s)
+		keep := min(r.keepLast, len(runes))
+		if keep == len(runes) {
+			// Keeping the whole value would not redact anything.
+			keep = 0
+		}
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	case RedactHMAC:
+		mac := hmac.New(sha256.New, r.hmacKey)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil))
+	default:
+		return r.mask
+	}
+}
@@ -9,6 +9,10 @@ type RuleType int
 const (
 	TypeFilter RuleType = iota
 	TypeTransform
+	// TypeError is the type of ErrorResult, returned by rules that failed to process an event.
+	TypeError
+	// TypeSplit is the type of SplitResult, returned by rules that split an event into several events.
+	TypeSplit
 )
 
 type Result[T any] interface {
@@ -34,6 +38,37 @@ func (r TransformResult[T]) TypeOf() RuleType {
 	return TypeTransform
 }
 
+// ErrorResult is returned by a rule that failed to process an event.
+// The event is handled according to the FailurePolicy of the rule.
+type ErrorResult[T any] struct {
+	Err error
+}
+
+func (r ErrorResult[T]) TypeOf() RuleType {
+	return TypeError
+}
+
+// SplitResult is returned by a rule that split an event into several events.
+// The events are processed by the remaining rules in order, instead of the split event.
+// If there are no events, the split event is dropped.
+type SplitResult[T any] struct {
+	Events []*event.Event[T]
+}
+
+func (r SplitResult[T]) TypeOf() RuleType {
+	return TypeSplit
+}
+
+// Split returns a SplitResult with an event for each of the contents, derived from evt.
+func Split[T any](evt *event.Event[T], contents ...T) SplitResult[T] {
+	events := make([]*event.Event[T], len(contents))
+	for i, content := range contents {
+		events[i] = evt.Derive(content)
+	}
+
+	return SplitResult[T]{Events: events}
+}
+
 // Rule defines the interface for processing rules that can be applied to events.
 // Implementations of this interface must provide a method to apply the rule to a event
 // and a method to identify the type of rule.
@@ -46,6 +81,31 @@ type Rule[T any] interface {
 	RuleType() RuleType
 }
 
+// Named is implemented by rules that have a name, which identifies the rule in metrics and logs.
+type Named interface {
+	RuleName() string
+}
+
+// Name returns the name of the rule if it implements Named, or an empty string.
+func Name[T any](r Rule[T]) string {
+	if named, ok := r.(Named); ok {
+		return named.RuleName()
+	}
+
+	return ""
+}
+
+// Starter is implemented by rules that work in the background while they are used,
+// such as a LookupRule whose LookupFile reloads its table.
+// A processor starts its rules when it starts and when they replace its rules,
+// and stops them when it stops and when they are replaced.
+// A rule may be started several times, such as when it is used by several processors,
+// and keeps working until it is stopped as many times as it is started.
+type Starter interface {
+	Start()
+	Stop()
+}
+
 type rule[T any] struct {
 	Name        string
 	Description string
@@ -82,3 +142,7 @@ func (r *rule[T]) Apply(evt *event.Event[T]) Result[T] {
 func (r *rule[T]) RuleType() RuleType {
 	return r.Type
 }
+
+func (r *rule[T]) RuleName() string {
+	return r.Name
+}
@@ -0,0 +1,133 @@
+package rule
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var (
+	_ Rule[any] = (*SampleRule[any])(nil)
+)
+
+const (
+	// DefaultSampleRateTag is the default tag set to the sample rate of the kept events.
+	DefaultSampleRateTag = "sample_rate"
+	// ReasonSampledOut is the reason of the events dropped by a SampleRule.
+	ReasonSampledOut = "sampled_out"
+)
+
+// Sample configures a SampleRule.
+type Sample struct {
+	// Name identifies the rule in metrics and logs.
+	Name string `json:"name,omitempty"`
+	// Rate is the fraction of the events kept, greater than 0 and at most 1. For example, 0.1 keeps 10% of the events.
+	Rate float64 `json:"rate"`
+	// Keys are the gjson paths of the values the events are sampled by.
+	// If set, the decision is made by the hash of the values, so the events with the same values are all kept or all dropped.
+	// If empty, each event is kept at random.
+	Keys []string `json:"keys,omitempty"`
+	// Tag is the tag set to Rate on the kept events, so consumers can weight them.
+	// If empty, DefaultSampleRateTag is used.
+	Tag string `json:"tag,omitempty"`
+}
+
+// SampleRule is a filter rule that keeps a fraction of the events.
+type SampleRule[T any] struct {
+	name string
+	keys []string
+	rate float64
+	tag  string
+	// rateValue is the value of the tag.
+	rateValue string
+	// threshold is the largest hash of the kept keys.
+	threshold uint64
+	random    func() float64
+}
+
+type SampleRuleOptionsFunc[T any] func(*SampleRule[T])
+
+// WithSampleRandom sets the source of random numbers in [0, 1) used when no keys are configured.
+// If not specified, math/rand/v2.Float64 is used.
+func WithSampleRandom[T any](random func() float64) SampleRuleOptionsFunc[T] {
+	return func(r *SampleRule[T]) {
+		r.random = random
+	}
+}
+
+// NewSampleRule creates a SampleRule.
+func NewSampleRule[T any](sample Sample, opts ...SampleRuleOptionsFunc[T]) (*SampleRule[T], error) {
+	if !(sample.Rate > 0 && sample.Rate <= 1) {
+		return nil, errors.New("rate must be greater than 0 and at most 1")
+	}
+
+	tag := sample.Tag
+	if tag == "" {
+		tag = DefaultSampleRateTag
+	}
+
+	r := &SampleRule[T]{
+		name:      sample.Name,
+		keys:      sample.Keys,
+		rate:      sample.Rate,
+		tag:       tag,
+		rateValue: strconv.FormatFloat(sample.Rate, 'g', -1, 64),
+		threshold: math.MaxUint64,
+		random:    rand.Float64,
+	}
+	if sample.Rate < 1 {
+		r.threshold = uint64(sample.Rate * math.MaxUint64)
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	return r, nil
+}
+
+func (r *SampleRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *SampleRule[T]) RuleType() RuleType {
+	return TypeFilter
+}
+
+func (r *SampleRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	keep, err := r.keep(evt)
+	if err != nil {
+		return ErrorResult[T]{Err: err}
+	}
+	if !keep {
+		return FilterResult[T]{Drop: true, Reason: ReasonSampledOut}
+	}
+
+	if evt.Tags == nil {
+		evt.Tags = event.Tags{}
+	}
+	evt.Tags[r.tag] = r.rateValue
+
+	return FilterResult[T]{Drop: false}
+}
+
+func (r *SampleRule[T]) keep(evt *event.Event[T]) (bool, error) {
+	if r.rate == 1 {
+		return true, nil
+	}
+
+	if len(r.keys) == 0 {
+		return r.random() < r.rate, nil
+	}
+
+	key, err := keyOf(evt, r.keys)
+	if err != nil {
+		return false, err
+	}
+
+	return binary.BigEndian.Uint64(key[:8]) <= r.threshold, nil
+}
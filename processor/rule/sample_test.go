@@ -0,0 +1,73 @@
+package rule_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampleRule_ByKey(t *testing.T) {
+	t.Parallel()
+
+	r, err := rule.NewSampleRule[webhook](rule.Sample{Rate: 0.25, Keys: []string{"id"}})
+	require.NoError(t, err)
+
+	kept := map[string]bool{}
+	for i := range 1000 {
+		id := fmt.Sprintf("trace-%d", i)
+		evt, dropped := applyFilter(r, webhook{ID: id})
+		kept[id] = !dropped
+		if !dropped {
+			assert.Equal(t, "0.25", evt.Tags[rule.DefaultSampleRateTag])
+		}
+	}
+
+	count := 0
+	for _, k := range kept {
+		if k {
+			count++
+		}
+	}
+	assert.InDelta(t, 250, count, 50)
+
+	// The decision only depends on the key.
+	for i := range 100 {
+		id := fmt.Sprintf("trace-%d", i)
+		_, dropped := applyFilter(r, webhook{ID: id, Attempt: 2})
+		assert.Equal(t, kept[id], !dropped, id)
+	}
+}
+
+func TestSampleRule_Random(t *testing.T) {
+	t.Parallel()
+
+	values := []float64{0.05, 0.5, 0.09, 0.1}
+	r, err := rule.NewSampleRule(rule.Sample{Rate: 0.1, Tag: "sampled"}, rule.WithSampleRandom[webhook](func() float64 {
+		v := values[0]
+		values = values[1:]
+		return v
+	}))
+	require.NoError(t, err)
+
+	var got []bool
+	for range 4 {
+		evt, dropped := applyFilter(r, webhook{ID: "a"})
+		got = append(got, !dropped)
+		if !dropped {
+			assert.Equal(t, "0.1", evt.Tags["sampled"])
+		}
+	}
+	assert.Equal(t, []bool{true, false, true, false}, got)
+}
+
+func TestNewSampleRule_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, rate := range []float64{0, -0.5, 1.5} {
+		_, err := rule.NewSampleRule[webhook](rule.Sample{Rate: rate})
+		assert.ErrorContains(t, err, "rate must be greater than 0 and at most 1")
+	}
+}
@@ -0,0 +1,63 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tidwall/gjson"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var (
+	_ Rule[any] = (*SplitRule[any])(nil)
+)
+
+// SplitRule is a rule that splits an event into an event for each element of a JSON array in it,
+// such as the records of a batched envelope.
+// The elements are decoded into T, and the events inherit the metadata of the split event.
+type SplitRule[T any] struct {
+	name string
+	path string
+}
+
+// NewSplitRule creates a SplitRule splitting the array at the gjson path.
+// An event without an array at the path is a failure of the rule, and an empty array drops the event.
+func NewSplitRule[T any](name, path string) (*SplitRule[T], error) {
+	if path == "" {
+		return nil, errors.New("path is required")
+	}
+
+	return &SplitRule[T]{name: name, path: path}, nil
+}
+
+func (r *SplitRule[T]) RuleName() string {
+	return r.name
+}
+
+func (r *SplitRule[T]) RuleType() RuleType {
+	return TypeSplit
+}
+
+func (r *SplitRule[T]) Apply(evt *event.Event[T]) Result[T] {
+	data, err := evt.MarshalJSON()
+	if err != nil {
+		return ErrorResult[T]{Err: fmt.Errorf("failed to marshal event: %w", err)}
+	}
+
+	value := gjson.GetBytes(data, r.path)
+	if !value.IsArray() {
+		return ErrorResult[T]{Err: fmt.Errorf("no array at %q", r.path)}
+	}
+
+	elements := value.Array()
+	contents := make([]T, len(elements))
+	for i, element := range elements {
+		if err := json.Unmarshal([]byte(element.Raw), &contents[i]); err != nil {
+			return ErrorResult[T]{Err: fmt.Errorf("failed to unmarshal element #%d: %w", i, err)}
+		}
+	}
+
+	return Split(evt, contents...)
+}
@@ -0,0 +1,45 @@
+package rule_test
+
+import (
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/processor/rule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitRule(t *testing.T) {
+	t.Parallel()
+
+	type record struct {
+		EventName string `json:"eventName"`
+	}
+
+	r, err := rule.NewSplitRule[map[string]any]("split-records", "Records")
+	require.NoError(t, err)
+
+	evt := event.NewEvent(&event.RawEvent[map[string]any]{
+		Content: map[string]any{"Records": []any{
+			map[string]any{"eventName": "ConsoleLogin"},
+			map[string]any{"eventName": "AssumeRole"},
+		}},
+		Metadata: &event.Metadata{Tags: event.Tags{"bucket": "trail"}},
+	})
+
+	result, ok := r.Apply(evt).(rule.SplitResult[map[string]any])
+	require.True(t, ok)
+	require.Len(t, result.Events, 2)
+	assert.Equal(t, map[string]any{"eventName": "ConsoleLogin"}, result.Events[0].Content())
+	assert.Equal(t, map[string]any{"eventName": "AssumeRole"}, result.Events[1].Content())
+	assert.Equal(t, event.Tags{"bucket": "trail"}, result.Events[1].Tags)
+
+	typed, err := rule.NewSplitRule[record]("split-records", "Records")
+	require.NoError(t, err)
+	failed, ok := typed.Apply(event.NewEvent(&event.RawEvent[record]{Content: record{EventName: "x"}})).(rule.ErrorResult[record])
+	require.True(t, ok)
+	assert.EqualError(t, failed.Err, `no array at "Records"`)
+
+	_, err = rule.NewSplitRule[record]("", "")
+	assert.EqualError(t, err, "path is required")
+}
@@ -0,0 +1,22 @@
+package queue
+
+import "github.com/mrtc0/conduit/event"
+
+var _ Queue[any] = (*WAL[any])(nil)
+
+// Queue is a FIFO queue of payloads waiting to be written to a sink.
+// A payload is removed from the queue only after it is acknowledged,
+// which allows payloads to be delivered at least once.
+type Queue[T any] interface {
+	// Push appends the payload to the queue.
+	Push(payload *event.Payload[T]) error
+	// Pop returns the oldest payload that has not been acknowledged yet.
+	// It blocks until a payload is available and returns ErrClosed once the queue is closed.
+	Pop() (*event.Payload[T], error)
+	// Ack acknowledges the payload returned by the last Pop.
+	Ack() error
+	// Len returns the number of payloads that have not been acknowledged yet.
+	Len() int
+	// Close stops accepting and delivering payloads. The payloads not acknowledged yet are kept.
+	Close() error
+}
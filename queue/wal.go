@@ -0,0 +1,604 @@
+package queue
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+)
+
+var (
+	// ErrClosed is returned when pushing to, popping from or acknowledging in a closed queue.
+	ErrClosed = errors.New("queue is closed")
+	// ErrRecordTooLarge is returned when a single payload exceeds the maximum disk size of the queue.
+	ErrRecordTooLarge = errors.New("record exceeds the maximum disk size of the queue")
+
+	// DefaultSegmentSize is the default maximum size of a segment file.
+	DefaultSegmentSize int64 = 64 * 1024 * 1024
+	// DefaultMaxDiskSize is the default maximum size of unacknowledged records on disk.
+	DefaultMaxDiskSize int64 = 1024 * 1024 * 1024
+)
+
+const (
+	segmentFileExt     = ".seg"
+	checkpointFileName = "checkpoint"
+	recordHeaderSize   = 8
+	checkpointSize     = 16
+)
+
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs the segment file after every write. This is the safest and slowest policy.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs the segment file at most once per WALConfig.SyncInterval.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system.
+	SyncNever
+)
+
+type WALConfig struct {
+	// Dir is the directory where segment files and the checkpoint are stored.
+	Dir string
+
+	// SegmentSize is the size in bytes after which a new segment file is started.
+	// If zero, DefaultSegmentSize is used.
+	SegmentSize int64
+
+	// MaxDiskSize is the maximum size in bytes of unacknowledged records.
+	// When it is reached, Push blocks until records are acknowledged.
+	// Disk usage may exceed it by up to one segment, since segments are removed as a whole.
+	// If zero, DefaultMaxDiskSize is used.
+	MaxDiskSize int64
+
+	// SyncPolicy defines when written records are fsynced to disk.
+	SyncPolicy SyncPolicy
+
+	// SyncInterval is the interval between fsyncs when SyncPolicy is SyncInterval.
+	SyncInterval time.Duration
+}
+
+// position is the location of a record in the log.
+type position struct {
+	segment uint64
+	offset  int64
+}
+
+// WAL is a persistent FIFO queue of payloads backed by append-only segment files.
+// Payloads stay on disk until they are acknowledged, so payloads that were not delivered
+// before the process stopped are delivered again when the WAL is reopened.
+type WAL[T any] struct {
+	config WALConfig
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	writer     *os.File
+	writePos   position
+	lastSync   time.Time
+	checkpoint *os.File
+
+	reader    *os.File
+	readerSeg uint64
+	readPos   position
+	nextPos   position
+	popped    bool
+
+	// remaining is the number of unacknowledged records per segment.
+	remaining    map[uint64]int
+	pending      int
+	pendingBytes int64
+	closed       bool
+
+	timeNowFunc func() time.Time
+}
+
+// OpenWAL opens the WAL stored in config.Dir, creating it if it does not exist.
+// Unacknowledged records from a previous run are recovered, and a torn record
+// at the end of a segment, left by a crash during a write, is truncated.
+func OpenWAL[T any](config WALConfig) (*WAL[T], error) {
+	if config.Dir == "" {
+		return nil, errors.New("WAL directory is not specified")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+	if config.MaxDiskSize <= 0 {
+		config.MaxDiskSize = DefaultMaxDiskSize
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
+	w := &WAL[T]{
+		config:      config,
+		remaining:   map[uint64]int{},
+		timeNowFunc: time.Now,
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Push appends the payload to the log. It blocks while the maximum disk size is reached.
+func (w *WAL[T]) Push(payload *event.Payload[T]) error {
+	record, err := encodeRecord(payload)
+	if err != nil {
+		return err
+	}
+
+	size := int64(len(record))
+	if size > w.config.MaxDiskSize {
+		return ErrRecordTooLarge
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for !w.closed && w.pendingBytes+size > w.config.MaxDiskSize {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return ErrClosed
+	}
+
+	if w.writePos.offset > 0 && w.writePos.offset+size > w.config.SegmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.writer.Write(record); err != nil {
+		return fmt.Errorf("failed to write record to WAL: %w", err)
+	}
+
+	if err := w.maybeSync(w.writer); err != nil {
+		return err
+	}
+
+	w.writePos.offset += size
+	w.remaining[w.writePos.segment]++
+	w.pending++
+	w.pendingBytes += size
+	w.cond.Broadcast()
+
+	return nil
+}
+
+// Pop returns the oldest unacknowledged payload. It blocks until a payload is available,
+// and returns ErrClosed once the WAL is closed.
+// Calling Pop again without Ack returns the same payload.
+func (w *WAL[T]) Pop() (*event.Payload[T], error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for {
+		for w.pending == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			return nil, ErrClosed
+		}
+
+		payload, next, err := w.read(w.readPos)
+		if err == nil {
+			w.nextPos = next
+			w.popped = true
+			return payload, nil
+		}
+
+		log.Error(fmt.Sprintf(
+			"WAL segment %d is corrupted at offset %d, skipping the rest of the segment: %v",
+			w.readPos.segment, w.readPos.offset, err,
+		))
+
+		if err := w.skipSegment(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Ack acknowledges the payload returned by the last Pop and removes it from the log.
+func (w *WAL[T]) Ack() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	if !w.popped {
+		return errors.New("no payload to acknowledge")
+	}
+	w.popped = false
+
+	size := w.nextPos.offset
+	if w.nextPos.segment == w.readPos.segment {
+		size -= w.readPos.offset
+	}
+
+	w.remaining[w.nextPos.segment]--
+	w.pending--
+	w.pendingBytes -= size
+
+	return w.advance(w.nextPos)
+}
+
+// Len returns the number of unacknowledged payloads.
+func (w *WAL[T]) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.pending
+}
+
+// Close stops accepting and delivering payloads, and closes the files of the WAL.
+// Payloads that are not acknowledged yet are kept on disk to be delivered when the WAL is opened again.
+// It returns the first error closing the files, after trying to close all of them.
+func (w *WAL[T]) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	w.cond.Broadcast()
+
+	var err error
+	if syncErr := w.writer.Sync(); syncErr != nil {
+		err = fmt.Errorf("failed to sync WAL segment: %w", syncErr)
+	}
+	if closeErr := w.writer.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close WAL segment: %w", closeErr)
+	}
+	if w.reader != nil {
+		if closeErr := w.reader.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("failed to close WAL segment: %w", closeErr)
+		}
+		w.reader = nil
+	}
+	if closeErr := w.checkpoint.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close WAL checkpoint: %w", closeErr)
+	}
+
+	return err
+}
+
+func (w *WAL[T]) recover() error {
+	segments, err := w.listSegments()
+	if err != nil {
+		return err
+	}
+
+	checkpoint, err := os.OpenFile( //#nosec G304
+		filepath.Join(w.config.Dir, checkpointFileName),
+		os.O_RDWR|os.O_CREATE,
+		0o600,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL checkpoint: %w", err)
+	}
+	w.checkpoint = checkpoint
+
+	buf := make([]byte, checkpointSize)
+	if _, err := checkpoint.ReadAt(buf, 0); err == nil {
+		w.readPos = position{
+			segment: binary.BigEndian.Uint64(buf[0:8]),
+			offset:  int64(binary.BigEndian.Uint64(buf[8:16])), //#nosec G115
+		}
+	} else if len(segments) > 0 {
+		w.readPos = position{segment: segments[0]}
+	}
+
+	for _, segment := range segments {
+		if segment < w.readPos.segment {
+			if err := os.Remove(w.segmentPath(segment)); err != nil {
+				return fmt.Errorf("failed to remove acknowledged WAL segment: %w", err)
+			}
+			continue
+		}
+
+		start := int64(0)
+		if segment == w.readPos.segment {
+			start = w.readPos.offset
+		}
+
+		if err := w.scanSegment(segment, start); err != nil {
+			return err
+		}
+	}
+
+	// Always append to a new segment, so that records are never written after a truncated tail.
+	w.writePos = position{segment: 1}
+	if len(segments) > 0 {
+		w.writePos.segment = max(segments[len(segments)-1], w.readPos.segment) + 1
+	}
+	if len(segments) > 0 && w.readPos.segment < segments[0] {
+		w.readPos = position{segment: segments[0]}
+	}
+
+	if err := w.openWriter(); err != nil {
+		return err
+	}
+
+	if w.pending == 0 {
+		// Nothing to deliver, so every existing segment can be removed.
+		return w.advance(w.writePos)
+	}
+
+	return nil
+}
+
+// scanSegment counts the valid records of the segment after start and truncates
+// the segment at the first invalid record.
+func (w *WAL[T]) scanSegment(segment uint64, start int64) error {
+	file, err := os.OpenFile(w.segmentPath(segment), os.O_RDWR, 0o600) //#nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open WAL segment: %w", err)
+	}
+	defer file.Close()
+
+	offset := start
+	for {
+		_, size, err := readRecord(file, offset)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			log.Warn(fmt.Sprintf(
+				"truncating WAL segment %d at offset %d: %v", segment, offset, err,
+			))
+			if err := file.Truncate(offset); err != nil {
+				return fmt.Errorf("failed to truncate WAL segment: %w", err)
+			}
+			return nil
+		}
+
+		offset += size
+		w.remaining[segment]++
+		w.pending++
+		w.pendingBytes += size
+	}
+}
+
+func (w *WAL[T]) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(w.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAL directory: %w", err)
+	}
+
+	segments := []uint64{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), segmentFileExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		segment, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+
+	return segments, nil
+}
+
+func (w *WAL[T]) segmentPath(segment uint64) string {
+	return filepath.Join(w.config.Dir, fmt.Sprintf("%020d%s", segment, segmentFileExt))
+}
+
+func (w *WAL[T]) openWriter() error {
+	writer, err := os.OpenFile( //#nosec G304
+		w.segmentPath(w.writePos.segment),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND,
+		0o600,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to open WAL segment: %w", err)
+	}
+
+	w.writer = writer
+	w.lastSync = w.timeNowFunc()
+
+	return nil
+}
+
+func (w *WAL[T]) rotate() error {
+	if err := w.writer.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL segment: %w", err)
+	}
+	if err := w.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close WAL segment: %w", err)
+	}
+
+	w.writePos = position{segment: w.writePos.segment + 1}
+
+	return w.openWriter()
+}
+
+func (w *WAL[T]) maybeSync(file *os.File) error {
+	switch w.config.SyncPolicy {
+	case SyncNever:
+		return nil
+	case SyncInterval:
+		now := w.timeNowFunc()
+		if now.Sub(w.lastSync) < w.config.SyncInterval {
+			return nil
+		}
+		w.lastSync = now
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+
+	return nil
+}
+
+// read reads the record at pos, moving to the next segment when pos is at the end of a segment.
+func (w *WAL[T]) read(pos position) (*event.Payload[T], position, error) {
+	for {
+		if err := w.openReader(pos.segment); err != nil {
+			return nil, pos, err
+		}
+
+		data, size, err := readRecord(w.reader, pos.offset)
+		if errors.Is(err, io.EOF) && pos.segment < w.writePos.segment {
+			pos = position{segment: pos.segment + 1}
+			continue
+		}
+		if err != nil {
+			return nil, pos, err
+		}
+
+		payload, err := decodeRecord[T](data)
+		if err != nil {
+			return nil, pos, err
+		}
+
+		return payload, position{segment: pos.segment, offset: pos.offset + size}, nil
+	}
+}
+
+func (w *WAL[T]) openReader(segment uint64) error {
+	if w.reader != nil && w.readerSeg == segment {
+		return nil
+	}
+
+	if w.reader != nil {
+		_ = w.reader.Close()
+		w.reader = nil
+	}
+
+	reader, err := os.Open(w.segmentPath(segment)) //#nosec G304
+	if err != nil {
+		return fmt.Errorf("failed to open WAL segment: %w", err)
+	}
+
+	w.reader = reader
+	w.readerSeg = segment
+
+	return nil
+}
+
+// skipSegment discards the unacknowledged records of the segment at the read position.
+func (w *WAL[T]) skipSegment() error {
+	segment := w.readPos.segment
+
+	w.pending -= w.remaining[segment]
+	delete(w.remaining, segment)
+	w.pendingBytes = 0
+	for s := segment + 1; s <= w.writePos.segment; s++ {
+		if info, err := os.Stat(w.segmentPath(s)); err == nil {
+			w.pendingBytes += info.Size()
+		}
+	}
+
+	return w.advance(position{segment: segment + 1})
+}
+
+// advance moves the read position, removes segments that were fully acknowledged
+// and persists the new position to the checkpoint.
+func (w *WAL[T]) advance(pos position) error {
+	for segment := w.readPos.segment; segment < pos.segment; segment++ {
+		if w.reader != nil && w.readerSeg == segment {
+			_ = w.reader.Close()
+			w.reader = nil
+		}
+
+		delete(w.remaining, segment)
+		if err := os.Remove(w.segmentPath(segment)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn(fmt.Sprintf("failed to remove WAL segment %d: %v", segment, err))
+		}
+	}
+
+	w.readPos = pos
+	w.cond.Broadcast()
+
+	buf := make([]byte, checkpointSize)
+	binary.BigEndian.PutUint64(buf[0:8], pos.segment)
+	binary.BigEndian.PutUint64(buf[8:16], uint64(pos.offset)) //#nosec G115
+	if _, err := w.checkpoint.WriteAt(buf, 0); err != nil {
+		return fmt.Errorf("failed to write WAL checkpoint: %w", err)
+	}
+
+	return w.maybeSync(w.checkpoint)
+}
+
+type record struct {
+	Metadata *event.Metadata `json:"metadata,omitempty"`
+	Content  []byte          `json:"content"`
+}
+
+// encodeRecord encodes the payload as a record framed by its length and CRC32 checksum.
+func encodeRecord[T any](payload *event.Payload[T]) ([]byte, error) {
+	data, err := json.Marshal(record{
+		Metadata: payload.Metadata,
+		Content:  payload.JSONEncodedContent,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode WAL record: %w", err)
+	}
+
+	buf := make([]byte, recordHeaderSize, recordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data))) //#nosec G115
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+
+	return append(buf, data...), nil
+}
+
+func decodeRecord[T any](data []byte) (*event.Payload[T], error) {
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode WAL record: %w", err)
+	}
+
+	return event.NewPayload[T](r.Metadata, r.Content), nil
+}
+
+// readRecord reads the record at offset and returns its data and its size on disk.
+// It returns io.EOF if there is no record at offset.
+func readRecord(r io.ReaderAt, offset int64) ([]byte, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := r.ReadAt(header, offset)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return nil, 0, io.EOF
+	}
+	if n < recordHeaderSize {
+		return nil, 0, fmt.Errorf("incomplete record header: %w", io.ErrUnexpectedEOF)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset+recordHeaderSize); err != nil {
+		return nil, 0, fmt.Errorf("incomplete record: %w", io.ErrUnexpectedEOF)
+	}
+
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+
+	return data, recordHeaderSize + int64(length), nil
+}
@@ -0,0 +1,219 @@
+package queue_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPayload(content string) *event.Payload[string] {
+	return event.NewPayload[string](
+		&event.Metadata{Tags: event.Tags{"content": content}},
+		[]byte(content),
+	)
+}
+
+func popAndAck(t *testing.T, wal *queue.WAL[string]) string {
+	t.Helper()
+
+	payload, err := wal.Pop()
+	require.NoError(t, err)
+	require.NoError(t, wal.Ack())
+
+	return string(payload.JSONEncodedContent)
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+	require.NoError(t, err)
+
+	return files
+}
+
+func TestWAL_PushPop(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+	require.NoError(t, err)
+
+	for i := range 3 {
+		assert.NoError(t, wal.Push(newPayload(fmt.Sprintf("event %d", i))))
+	}
+	assert.Equal(t, 3, wal.Len())
+
+	payload, err := wal.Pop()
+	require.NoError(t, err)
+	assert.Equal(t, "event 0", string(payload.JSONEncodedContent))
+	assert.Equal(t, event.Tags{"content": "event 0"}, payload.Metadata.Tags)
+
+	// Pop without Ack returns the same payload again.
+	payload, err = wal.Pop()
+	require.NoError(t, err)
+	assert.Equal(t, "event 0", string(payload.JSONEncodedContent))
+
+	require.NoError(t, wal.Ack())
+	assert.Equal(t, 2, wal.Len())
+
+	assert.NoError(t, wal.Close())
+	assert.ErrorIs(t, wal.Push(newPayload("event 3")), queue.ErrClosed)
+	_, err = wal.Pop()
+	assert.ErrorIs(t, err, queue.ErrClosed)
+	assert.ErrorIs(t, wal.Ack(), queue.ErrClosed)
+
+	// the payloads that are not acknowledged are kept for the next open.
+	wal, err = queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+	require.NoError(t, err)
+	defer wal.Close()
+
+	assert.Equal(t, "event 1", popAndAck(t, wal))
+	assert.Equal(t, "event 2", popAndAck(t, wal))
+	assert.Equal(t, 0, wal.Len())
+}
+
+func TestWAL_Recovery(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unacknowledged payloads are delivered after reopen", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+		require.NoError(t, err)
+
+		for i := range 3 {
+			require.NoError(t, wal.Push(newPayload(fmt.Sprintf("event %d", i))))
+		}
+		assert.Equal(t, "event 0", popAndAck(t, wal))
+
+		// Popped but not acknowledged, e.g. the process crashed while writing it to the sink.
+		_, err = wal.Pop()
+		require.NoError(t, err)
+
+		reopened, err := queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+		require.NoError(t, err)
+
+		assert.Equal(t, 2, reopened.Len())
+		assert.Equal(t, "event 1", popAndAck(t, reopened))
+
+		require.NoError(t, reopened.Push(newPayload("event 3")))
+		assert.Equal(t, "event 2", popAndAck(t, reopened))
+		assert.Equal(t, "event 3", popAndAck(t, reopened))
+		assert.Equal(t, 0, reopened.Len())
+	})
+
+	t.Run("torn record at the end of a segment is truncated", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+
+		wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+		require.NoError(t, err)
+		require.NoError(t, wal.Push(newPayload("event 0")))
+		require.NoError(t, wal.Push(newPayload("event 1")))
+
+		files := segmentFiles(t, dir)
+		require.Len(t, files, 1)
+
+		info, err := os.Stat(files[0])
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(files[0], info.Size()-3))
+
+		reopened, err := queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, reopened.Len())
+		assert.Equal(t, "event 0", popAndAck(t, reopened))
+	})
+}
+
+func TestWAL_Segments(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	wal, err := queue.OpenWAL[string](queue.WALConfig{
+		Dir:         dir,
+		SegmentSize: 128,
+		SyncPolicy:  queue.SyncNever,
+	})
+	require.NoError(t, err)
+
+	for i := range 10 {
+		require.NoError(t, wal.Push(newPayload(fmt.Sprintf("event %d", i))))
+	}
+	assert.Greater(t, len(segmentFiles(t, dir)), 1)
+
+	for i := range 10 {
+		assert.Equal(t, fmt.Sprintf("event %d", i), popAndAck(t, wal))
+	}
+
+	// Fully acknowledged segments are removed.
+	assert.Len(t, segmentFiles(t, dir), 1)
+}
+
+func TestWAL_MaxDiskSize(t *testing.T) {
+	t.Parallel()
+
+	// Each record takes about 100 bytes, so only two records fit.
+	wal, err := queue.OpenWAL[string](queue.WALConfig{
+		Dir:         t.TempDir(),
+		MaxDiskSize: 256,
+	})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, wal.Push(newPayload(string(make([]byte, 512)))), queue.ErrRecordTooLarge)
+
+	require.NoError(t, wal.Push(newPayload("event 0")))
+	require.NoError(t, wal.Push(newPayload("event 1")))
+
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		assert.NoError(t, wal.Push(newPayload("event 2")))
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatal("Push should block while the queue is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.Equal(t, "event 0", popAndAck(t, wal))
+	<-pushed
+
+	assert.Equal(t, 2, wal.Len())
+}
+
+func TestWAL_Close(t *testing.T) {
+	t.Parallel()
+
+	wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	popped := make(chan error)
+	go func() {
+		_, err := wal.Pop()
+		popped <- err
+	}()
+
+	select {
+	case <-popped:
+		t.Fatal("Pop should block while the queue is empty")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, wal.Close())
+	assert.ErrorIs(t, <-popped, queue.ErrClosed)
+	assert.NoError(t, wal.Close())
+}
@@ -0,0 +1,87 @@
+package sender
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/mrtc0/conduit/sink"
+)
+
+// RetryPolicy defines how the Sender retries payloads that the sink failed to write.
+// The zero value disables retries, so every payload is written at most once.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of write attempts for a payload, including the first one.
+	// A value of 0 or 1 disables retries.
+	MaxAttempts int
+
+	// BaseBackoff is the wait time before the first retry.
+	// The wait time is doubled for every subsequent retry.
+	BaseBackoff time.Duration
+
+	// MaxBackoff is the upper limit of the wait time between retries.
+	// If zero, the wait time is only capped to stop it from overflowing.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of the wait time, between 0.0 and 1.0, that is randomized
+	// to prevent many senders from retrying at the same moment.
+	Jitter float64
+
+	// RetryableErrors limits retries to errors that match one of these errors with errors.Is.
+	// If empty, every error is retried unless it implements sink.RetryableError and reports otherwise.
+	RetryableErrors []error
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+
+	return p.MaxAttempts
+}
+
+// isRetryable reports whether a write that failed with err should be attempted again.
+func (p RetryPolicy) isRetryable(err error) bool {
+	var retryableErr sink.RetryableError
+	if errors.As(err, &retryableErr) {
+		return retryableErr.Retryable()
+	}
+
+	if len(p.RetryableErrors) == 0 {
+		return true
+	}
+
+	for _, target := range p.RetryableErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the wait time before the given retry. The first retry is 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseBackoff
+	for i := 1; i < retry; i++ {
+		if d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+	}
+
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	jitter := min(max(p.Jitter, 0), 1)
+	if jitter > 0 && d > 0 {
+		d -= time.Duration(jitter * rand.Float64() * float64(d)) //#nosec G404
+	}
+
+	return d
+}
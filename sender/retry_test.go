@@ -0,0 +1,87 @@
+package sender
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{
+		BaseBackoff: 100 * time.Millisecond,
+		MaxBackoff:  time.Second,
+	}
+
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, policy.backoff(4))
+	assert.Equal(t, time.Second, policy.backoff(5))
+	assert.Equal(t, time.Second, policy.backoff(100))
+
+	policy.Jitter = 0.5
+	for range 100 {
+		d := policy.backoff(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+
+	uncapped := RetryPolicy{BaseBackoff: time.Second}
+	prev := time.Duration(0)
+	for retry := 1; retry <= 100; retry++ {
+		d := uncapped.backoff(retry)
+		assert.GreaterOrEqual(t, d, prev, "retry %d", retry)
+		prev = d
+	}
+}
+
+func TestRetryPolicy_isRetryable(t *testing.T) {
+	t.Parallel()
+
+	errTimeout := errors.New("timeout")
+	errInvalid := errors.New("invalid")
+
+	testCases := map[string]struct {
+		policy RetryPolicy
+		err    error
+		want   bool
+	}{
+		"any error is retryable by default": {
+			policy: RetryPolicy{},
+			err:    errInvalid,
+			want:   true,
+		},
+		"permanent error": {
+			policy: RetryPolicy{},
+			err:    sink.NewPermanentError(errTimeout),
+			want:   false,
+		},
+		"matches retryable errors": {
+			policy: RetryPolicy{RetryableErrors: []error{errTimeout}},
+			err:    errors.Join(errors.New("write failed"), errTimeout),
+			want:   true,
+		},
+		"does not match retryable errors": {
+			policy: RetryPolicy{RetryableErrors: []error{errTimeout}},
+			err:    errInvalid,
+			want:   false,
+		},
+		"retryable error takes precedence over retryable errors": {
+			policy: RetryPolicy{RetryableErrors: []error{errTimeout}},
+			err:    sink.NewRetryableError(errInvalid),
+			want:   true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.want, tc.policy.isRetryable(tc.err))
+		})
+	}
+}
@@ -2,41 +2,141 @@ package sender
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/queue"
 	"github.com/mrtc0/conduit/sink"
+	"github.com/mrtc0/conduit/tracing"
 )
 
 var (
 	// defaultQueueSize is the default size of the queue for the sender.
 	defaultQueueSize = 100
+	// flushPollInterval is the interval at which Flush checks whether the persistent queue is drained.
+	flushPollInterval = 10 * time.Millisecond
+	// queueRetryPolicy is the backoff of pushing to the persistent queue, and of redelivering
+	// the payloads of the persistent queue that could be neither written nor dead-lettered.
+	queueRetryPolicy = RetryPolicy{BaseBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}
 )
 
+// ErrStopped is the error of a payload whose retries were abandoned because the Sender was stopped.
+var ErrStopped = errors.New("sender is stopped")
+
 type Sender[T any] struct {
-	sink     sink.Sink[T]
-	resultCh chan *sink.Result[T]
-	queue    chan *event.Payload[T]
+	sink        sink.Sink[T]
+	destination string
+	resultCh    chan *sink.Result[T]
+	queue       chan *event.Payload[T]
+
+	// persistentQueue, if set, stores payloads received from queue until they are delivered.
+	persistentQueue queue.Queue[T]
+
+	retryPolicy    RetryPolicy
+	deadLetterSink sink.Sink[T]
+	timeNowFunc    func() time.Time
+	metrics        *metrics.DestinationMetrics
+	tracer         *tracing.Tracer
+
+	// flushRequests asks the running sender to process the queued payloads and close the given channel.
+	flushRequests chan chan struct{}
+	// stopping is closed by Stop to cut the waits between retries short.
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+type SenderOptionsFunc[T any] func(*Sender[T])
+
+// WithRetryPolicy sets the policy used to retry payloads that the sink failed to write.
+func WithRetryPolicy[T any](policy RetryPolicy) SenderOptionsFunc[T] {
+	return func(s *Sender[T]) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithDeadLetterSink sets the sink where payloads that could not be delivered are written,
+// together with the error and the number of attempts.
+func WithDeadLetterSink[T any](deadLetterSink sink.Sink[T]) SenderOptionsFunc[T] {
+	return func(s *Sender[T]) {
+		s.deadLetterSink = deadLetterSink
+	}
+}
+
+// WithPersistentQueue stores payloads in the given queue, such as a queue.WAL,
+// until they are delivered or given up on, instead of only buffering them in memory.
+func WithPersistentQueue[T any](q queue.Queue[T]) SenderOptionsFunc[T] {
+	return func(s *Sender[T]) {
+		s.persistentQueue = q
+	}
+}
+
+// WithDestination sets the name of the destination that is reported in the results.
+func WithDestination[T any](name string) SenderOptionsFunc[T] {
+	return func(s *Sender[T]) {
+		s.destination = name
+	}
+}
 
-	done chan struct{}
+// WithMetrics records the sink writes, their latency and the queue length in m.
+func WithMetrics[T any](m *metrics.DestinationMetrics) SenderOptionsFunc[T] {
+	return func(s *Sender[T]) {
+		s.metrics = m
+	}
 }
 
-func NewSender[T any](sink sink.Sink[T], resultCh chan *sink.Result[T]) *Sender[T] {
+// WithTracer creates a span for each write to the sink, in the trace of the payload.
+func WithTracer[T any](t *tracing.Tracer) SenderOptionsFunc[T] {
+	return func(s *Sender[T]) {
+		s.tracer = t
+	}
+}
+
+func NewSender[T any](
+	sink sink.Sink[T],
+	resultCh chan *sink.Result[T],
+	opts ...SenderOptionsFunc[T],
+) *Sender[T] {
 	queue := make(chan *event.Payload[T], defaultQueueSize)
 
-	return &Sender[T]{
-		sink:     sink,
-		resultCh: resultCh,
-		queue:    queue,
+	s := &Sender[T]{
+		sink:        sink,
+		resultCh:    resultCh,
+		queue:       queue,
+		timeNowFunc: time.Now,
+
+		flushRequests: make(chan chan struct{}),
+		stopping:      make(chan struct{}),
+		done:          make(chan struct{}),
+	}
 
-		done: make(chan struct{}),
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	s.metrics.SetSenderQueueLengthFunc(func() int {
+		if s.persistentQueue != nil {
+			return len(s.queue) + s.persistentQueue.Len()
+		}
+		return len(s.queue)
+	})
+
+	return s
 }
 
 func (s *Sender[T]) Start() {
 	go s.run()
 }
 
+// Stop writes the queued payloads and closes the sinks.
+// Payloads failing after Stop is called are not retried, and fail with ErrStopped instead of waiting for their backoff.
 func (s *Sender[T]) Stop() error {
+	close(s.stopping)
 	close(s.queue)
 	<-s.done
 
@@ -44,23 +144,39 @@ func (s *Sender[T]) Stop() error {
 		return err
 	}
 
+	if s.deadLetterSink != nil {
+		if err := s.deadLetterSink.Close(); err != nil {
+			return fmt.Errorf("failed to close dead-letter sink: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// Flush waits until the payloads queued before the call are processed.
+// Payloads are always written by the running sender, so the sink is never written concurrently.
 func (s *Sender[T]) Flush(ctx context.Context) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			if len(s.queue) == 0 {
-				return nil
-			}
+	flushed := make(chan struct{})
 
-			payload := <-s.queue
-			s.process(payload)
-		}
+	select {
+	case s.flushRequests <- flushed:
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if s.persistentQueue != nil {
+		return s.waitDrained(ctx)
+	}
+
+	return nil
 }
 
 func (s *Sender[T]) In() chan<- *event.Payload[T] {
@@ -72,18 +188,266 @@ func (s *Sender[T]) run() {
 		close(s.done)
 	}()
 
-	for payload := range s.queue {
+	if s.persistentQueue != nil {
+		s.runPersistent()
+		return
+	}
+
+	for {
+		select {
+		case payload, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			s.process(payload)
+		case flushed := <-s.flushRequests:
+			s.drain()
+			close(flushed)
+		}
+	}
+}
+
+// drain processes the payloads in the queue without waiting for new ones.
+func (s *Sender[T]) drain() {
+	for len(s.queue) > 0 {
+		payload, ok := <-s.queue
+		if !ok {
+			return
+		}
 		s.process(payload)
 	}
 }
 
-func (s *Sender[T]) process(payload *event.Payload[T]) {
-	err := s.sink.Write(payload)
+// runPersistent moves payloads from the in-memory queue to the persistent queue,
+// and delivers them from the persistent queue in another goroutine.
+func (s *Sender[T]) runPersistent() {
+	dispatched := make(chan struct{})
+
+	go func() {
+		defer close(dispatched)
+		s.dispatch()
+	}()
+
+	// unqueued are the payloads that could not be pushed before the sender was stopped.
+	var unqueued []*event.Payload[T]
+	push := func(payload *event.Payload[T]) {
+		if !s.push(payload) {
+			unqueued = append(unqueued, payload)
+		}
+	}
+
+loop:
+	for {
+		select {
+		case payload, ok := <-s.queue:
+			if !ok {
+				break loop
+			}
+			push(payload)
+		case flushed := <-s.flushRequests:
+			// the payloads received before the flush are pushed, and Flush waits for the persistent queue to drain
+			for len(s.queue) > 0 {
+				payload, ok := <-s.queue
+				if !ok {
+					break
+				}
+				push(payload)
+			}
+			close(flushed)
+		}
+	}
+
+	// closing the persistent queue stops the dispatcher, so it is closed once the dispatcher
+	// has delivered every payload, or has given up because the sender is stopped.
+	s.waitDispatched(dispatched)
+	if err := s.persistentQueue.Close(); err != nil {
+		log.Error(fmt.Sprintf("failed to close persistent queue: %v", err))
+	}
+
+	<-dispatched
+
+	// the dispatcher has returned, so the sink is not written concurrently
+	for _, payload := range unqueued {
+		s.process(payload)
+	}
+}
+
+// push pushes the payload to the persistent queue, retrying until it succeeds.
+// It returns false if the sender is stopped before the payload is pushed.
+func (s *Sender[T]) push(payload *event.Payload[T]) bool {
+	for retry := 1; ; retry++ {
+		err := s.persistentQueue.Push(payload)
+		if err == nil {
+			return true
+		}
+
+		backoff := queueRetryPolicy.backoff(retry)
+		log.Error(fmt.Sprintf("failed to push payload to persistent queue, retrying in %s: %v", backoff, err))
+		if !s.wait(backoff) {
+			return false
+		}
+	}
+}
+
+// dispatch delivers the payloads of the persistent queue until it is closed.
+// A payload is acknowledged only once it is written to the sink or the dead-letter sink.
+// Otherwise, it is delivered again after a backoff, or left in the queue if the sender is stopped.
+func (s *Sender[T]) dispatch() {
+	failures := 0
+	for {
+		payload, err := s.persistentQueue.Pop()
+		if errors.Is(err, queue.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("failed to pop payload from persistent queue: %v", err))
+			if !s.wait(flushPollInterval) {
+				return
+			}
+			continue
+		}
+
+		if !s.process(payload) {
+			failures++
+			backoff := queueRetryPolicy.backoff(failures)
+			log.Error(fmt.Sprintf("failed to deliver payload from persistent queue, keeping it and retrying in %s", backoff))
+			if !s.wait(backoff) {
+				log.Warn("sender is stopped, keeping the undelivered payloads in the persistent queue")
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		if err := s.persistentQueue.Ack(); err != nil {
+			log.Error(fmt.Sprintf("failed to acknowledge payload in persistent queue: %v", err))
+		}
+	}
+}
+
+// waitDispatched waits until the persistent queue is drained or the dispatcher has returned.
+func (s *Sender[T]) waitDispatched(dispatched <-chan struct{}) {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+
+	for s.persistentQueue.Len() > 0 {
+		select {
+		case <-dispatched:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitDrained waits until every payload in the persistent queue is processed.
+func (s *Sender[T]) waitDrained(ctx context.Context) error {
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+
+	for s.persistentQueue.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.done:
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// process writes the payload to the sink, or to the dead-letter sink if it fails,
+// and reports whether either write succeeded.
+func (s *Sender[T]) process(payload *event.Payload[T]) bool {
+	attempts, err := s.write(payload)
+	delivered := err == nil
+	if err != nil && s.deadLetterSink != nil {
+		delivered = s.writeDeadLetter(payload, err, attempts)
+	}
 
 	if s.resultCh != nil {
 		s.resultCh <- &sink.Result[T]{
-			Payload: payload,
-			Err:     err,
+			Payload:     payload,
+			Err:         err,
+			Attempts:    attempts,
+			Destination: s.destination,
 		}
 	}
+
+	return delivered
+}
+
+// write writes the payload to the sink, retrying according to the retry policy.
+// It returns the number of attempts made and the error of the last attempt.
+func (s *Sender[T]) write(payload *event.Payload[T]) (int, error) {
+	maxAttempts := s.retryPolicy.maxAttempts()
+
+	for attempt := 1; ; attempt++ {
+		span := s.tracer.Start(payload.Metadata, "conduit.sink.write",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				tracing.AttributeDestination.String(s.destination),
+				tracing.AttributeAttempt.Int(attempt),
+			),
+		)
+		start := s.timeNowFunc()
+		err := s.sink.Write(payload)
+		s.metrics.SinkWrite(s.timeNowFunc().Sub(start), err)
+		tracing.End(span, err)
+		if err == nil {
+			return attempt, nil
+		}
+
+		if attempt >= maxAttempts || !s.retryPolicy.isRetryable(err) {
+			return attempt, err
+		}
+
+		backoff := s.retryPolicy.backoff(attempt)
+		log.Warn(fmt.Sprintf(
+			"failed to write payload to sink (attempt %d/%d), retrying in %s: %v",
+			attempt, maxAttempts, backoff, err,
+		))
+
+		if !s.wait(backoff) {
+			return attempt, fmt.Errorf("%w: %w", ErrStopped, err)
+		}
+	}
+}
+
+// wait waits for d, and returns false if the sender is stopped first.
+func (s *Sender[T]) wait(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stopping:
+		return false
+	}
+}
+
+func (s *Sender[T]) writeDeadLetter(payload *event.Payload[T], writeErr error, attempts int) bool {
+	deadLetter, err := sink.NewDeadLetterPayload(payload, writeErr, attempts, s.timeNowFunc())
+	if err != nil {
+		log.Error(err.Error())
+		return false
+	}
+
+	if err := s.deadLetterSink.Write(deadLetter); err != nil {
+		log.Error(fmt.Sprintf("failed to write payload to dead-letter sink: %v", err))
+		return false
+	}
+	s.metrics.DeadLettered()
+
+	return true
+}
+
+func (s *Sender[T]) SetTimeNowFunc(fn func() time.Time) {
+	s.timeNowFunc = fn
 }
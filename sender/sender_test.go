@@ -3,8 +3,10 @@ package sender_test
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/queue"
 	"github.com/mrtc0/conduit/sender"
 	"github.com/mrtc0/conduit/sink"
 	"github.com/stretchr/testify/assert"
@@ -67,6 +69,218 @@ func TestSender_Start(t *testing.T) {
 	})
 }
 
+func TestSender_Retry(t *testing.T) {
+	t.Parallel()
+
+	policy := sender.RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	}
+
+	testCases := map[string]struct {
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		"succeeds after transient failures": {
+			errs:         []error{assert.AnError, assert.AnError, nil},
+			wantErr:      nil,
+			wantAttempts: 3,
+		},
+		"gives up after max attempts": {
+			errs:         []error{assert.AnError, assert.AnError, assert.AnError},
+			wantErr:      assert.AnError,
+			wantAttempts: 3,
+		},
+		"does not retry permanent errors": {
+			errs:         []error{sink.NewPermanentError(assert.AnError)},
+			wantErr:      assert.AnError,
+			wantAttempts: 1,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			mockSink := &MockSink{}
+			mockSink.writeFunc = func(payload *event.Payload[string]) error {
+				return tc.errs[mockSink.CallCount-1]
+			}
+
+			resultCh := make(chan *sink.Result[string], 1)
+			s := sender.NewSender(mockSink, resultCh, sender.WithRetryPolicy[string](policy))
+			s.Start()
+
+			s.In() <- &event.Payload[string]{JSONEncodedContent: []byte("test event")}
+			result := <-resultCh
+
+			assert.ErrorIs(t, result.Err, tc.wantErr)
+			assert.Equal(t, tc.wantAttempts, result.Attempts)
+			assert.Equal(t, tc.wantAttempts, mockSink.CallCount)
+
+			assert.NoError(t, s.Stop())
+		})
+	}
+}
+
+func TestSender_DeadLetter(t *testing.T) {
+	t.Parallel()
+
+	mockSink := &MockSink{
+		writeFunc: func(payload *event.Payload[string]) error {
+			return assert.AnError
+		},
+	}
+
+	var deadLetters []*event.Payload[string]
+	deadLetterSink := &MockSink{
+		writeFunc: func(payload *event.Payload[string]) error {
+			deadLetters = append(deadLetters, payload)
+			return nil
+		},
+	}
+
+	s := sender.NewSender(
+		mockSink,
+		nil,
+		sender.WithRetryPolicy[string](sender.RetryPolicy{MaxAttempts: 2}),
+		sender.WithDeadLetterSink[string](deadLetterSink),
+	)
+	s.SetTimeNowFunc(func() time.Time {
+		return time.Date(2025, 7, 18, 13, 0, 0, 0, time.UTC)
+	})
+	s.Start()
+
+	s.In() <- &event.Payload[string]{
+		Metadata: &event.Metadata{
+			Tags:          event.Tags{"source": "audit"},
+			IngestionTime: time.Date(2025, 7, 18, 12, 0, 0, 0, time.UTC),
+		},
+		JSONEncodedContent: []byte("{\"id\":\"123\"}\n"),
+	}
+
+	assert.NoError(t, s.Stop())
+
+	assert.Equal(t, 2, mockSink.CallCount)
+	assert.Len(t, deadLetters, 1)
+	assert.JSONEq(t, `{
+		"error": "assert.AnError general error for testing",
+		"timestamp": "2025-07-18T13:00:00Z",
+		"attempts": 2,
+		"metadata": {"tags": {"source": "audit"}, "ingestion_time": "2025-07-18T12:00:00Z"},
+		"content": "{\"id\":\"123\"}\n"
+	}`, string(deadLetters[0].JSONEncodedContent))
+}
+
+func TestSender_PersistentQueue(t *testing.T) {
+	t.Parallel()
+
+	wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+
+	var written []string
+	mockSink := &MockSink{
+		writeFunc: func(payload *event.Payload[string]) error {
+			written = append(written, string(payload.JSONEncodedContent))
+			return nil
+		},
+	}
+
+	s := sender.NewSender(mockSink, nil, sender.WithPersistentQueue[string](wal))
+	s.Start()
+
+	s.In() <- &event.Payload[string]{JSONEncodedContent: []byte("event 1")}
+	s.In() <- &event.Payload[string]{JSONEncodedContent: []byte("event 2")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, s.Flush(ctx))
+	assert.NoError(t, s.Stop())
+
+	assert.Equal(t, []string{"event 1", "event 2"}, written)
+	assert.Equal(t, 0, wal.Len())
+}
+
+func TestSender_PersistentQueueRedelivery(t *testing.T) {
+	t.Parallel()
+
+	wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: t.TempDir()})
+	assert.NoError(t, err)
+
+	var written []string
+	mockSink := &MockSink{}
+	mockSink.writeFunc = func(payload *event.Payload[string]) error {
+		if mockSink.CallCount <= 2 {
+			return assert.AnError
+		}
+		written = append(written, string(payload.JSONEncodedContent))
+		return nil
+	}
+
+	// the push fails once, and the payload is pushed again rather than written beside the dispatcher
+	q := &flakyQueue{Queue: wal, pushErrs: 1}
+	s := sender.NewSender(mockSink, nil, sender.WithPersistentQueue[string](q))
+	s.Start()
+
+	s.In() <- &event.Payload[string]{JSONEncodedContent: []byte("event 1")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, s.Flush(ctx))
+	assert.NoError(t, s.Stop())
+
+	// the payload is kept in the queue until it is written
+	assert.Equal(t, []string{"event 1"}, written)
+	assert.Equal(t, 3, mockSink.CallCount)
+	assert.Equal(t, 0, wal.Len())
+}
+
+func TestSender_PersistentQueueUndelivered(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	wal, err := queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+	assert.NoError(t, err)
+
+	written := make(chan struct{}, 10)
+	mockSink := &MockSink{
+		writeFunc: func(payload *event.Payload[string]) error {
+			written <- struct{}{}
+			return assert.AnError
+		},
+	}
+
+	s := sender.NewSender(mockSink, nil, sender.WithPersistentQueue[string](wal))
+	s.Start()
+
+	s.In() <- &event.Payload[string]{JSONEncodedContent: []byte("event 1")}
+	<-written
+	assert.NoError(t, s.Stop())
+
+	wal, err = queue.OpenWAL[string](queue.WALConfig{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, wal.Len())
+	assert.NoError(t, wal.Close())
+}
+
+// flakyQueue fails the first pushErrs pushes.
+type flakyQueue struct {
+	queue.Queue[string]
+	pushErrs int
+}
+
+func (q *flakyQueue) Push(payload *event.Payload[string]) error {
+	if q.pushErrs > 0 {
+		q.pushErrs--
+		return assert.AnError
+	}
+	return q.Queue.Push(payload)
+}
+
 type MockSink struct {
 	CallCount int
 	writeFunc func(payload *event.Payload[string]) error
@@ -80,3 +294,40 @@ func (m *MockSink) Write(payload *event.Payload[string]) error {
 func (m *MockSink) Close() error {
 	return nil
 }
+
+func TestSender_StopDuringBackoff(t *testing.T) {
+	t.Parallel()
+
+	written := make(chan struct{}, 10)
+	mockSink := &MockSink{
+		writeFunc: func(payload *event.Payload[string]) error {
+			written <- struct{}{}
+			return assert.AnError
+		},
+	}
+
+	resultCh := make(chan *sink.Result[string], 1)
+	s := sender.NewSender(mockSink, resultCh, sender.WithRetryPolicy[string](sender.RetryPolicy{
+		MaxAttempts: 3,
+		BaseBackoff: time.Hour,
+	}))
+	s.Start()
+
+	s.In() <- &event.Payload[string]{JSONEncodedContent: []byte("test event")}
+	<-written
+
+	stopped := make(chan error)
+	go func() { stopped <- s.Stop() }()
+
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop waits for the backoff")
+	}
+
+	result := <-resultCh
+	assert.ErrorIs(t, result.Err, sender.ErrStopped)
+	assert.ErrorIs(t, result.Err, assert.AnError)
+	assert.Equal(t, 1, result.Attempts)
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+// DeadLetterRecord is the record written to the dead-letter sink
+// for a payload that could not be delivered to the sink.
+type DeadLetterRecord struct {
+	// Error is the error returned by the last write attempt.
+	Error string `json:"error"`
+	// Timestamp is the time when the payload was given up on.
+	Timestamp time.Time `json:"timestamp"`
+	// Attempts is the number of write attempts made before giving up.
+	Attempts int `json:"attempts"`
+	// Rule is the name of the processing rule that failed, when the event was dead-lettered by a rule.
+	Rule string `json:"rule,omitempty"`
+	// Metadata is the metadata of the original payload.
+	Metadata *event.Metadata `json:"metadata,omitempty"`
+	// Content is the JSON encoded content of the original payload.
+	// It may contain multiple newline-delimited events when the payload was batched.
+	Content string `json:"content"`
+}
+
+// NewDeadLetterPayload wraps a payload that failed to be delivered into a DeadLetterRecord
+// encoded as a newline-terminated JSON document.
+func NewDeadLetterPayload[T any](
+	payload *event.Payload[T],
+	err error,
+	attempts int,
+	timestamp time.Time,
+) (*event.Payload[T], error) {
+	record := DeadLetterRecord{
+		Timestamp: timestamp,
+		Attempts:  attempts,
+		Metadata:  payload.Metadata,
+		Content:   string(payload.JSONEncodedContent),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode dead-letter record: %w", err)
+	}
+
+	return event.NewPayload[T](payload.Metadata, append(data, '\n')), nil
+}
+
+// NewRuleDeadLetterPayload wraps an event that a processing rule failed to process into a DeadLetterRecord
+// encoded as a newline-terminated JSON document.
+// The content is omitted when the event cannot be encoded.
+func NewRuleDeadLetterPayload[T any](
+	evt *event.Event[T],
+	ruleName string,
+	ruleErr error,
+	timestamp time.Time,
+) (*event.Payload[T], error) {
+	record := DeadLetterRecord{
+		Timestamp: timestamp,
+		Rule:      ruleName,
+		Metadata:  &evt.Metadata,
+	}
+	if ruleErr != nil {
+		record.Error = ruleErr.Error()
+	}
+	if content, err := evt.MarshalJSON(); err == nil {
+		record.Content = string(content)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode dead-letter record: %w", err)
+	}
+
+	return event.NewPayload[T](&evt.Metadata, append(data, '\n')), nil
+}
@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/log"
+)
+
+// DropRecord is the record written to a drop sink for an event discarded by the pipeline.
+type DropRecord struct {
+	// Timestamp is the time when the event was dropped.
+	Timestamp time.Time `json:"timestamp"`
+	// Stage is the stage of the pipeline where the event was dropped.
+	Stage event.DropStage `json:"stage"`
+	// Rule is the name of the rule that dropped the event, if any.
+	Rule string `json:"rule,omitempty"`
+	// Reason explains why the event was dropped.
+	Reason string `json:"reason,omitempty"`
+	// Destination is the name of the destination the event was dropped for, if any.
+	Destination string `json:"destination,omitempty"`
+	// Error is the error that caused the drop, if any.
+	Error string `json:"error,omitempty"`
+	// Metadata is the metadata of the dropped event.
+	Metadata *event.Metadata `json:"metadata,omitempty"`
+	// Content is the JSON encoded content of the dropped event.
+	// It is omitted when the content cannot be encoded.
+	Content json.RawMessage `json:"content,omitempty"`
+}
+
+// NewDropPayload wraps a dropped event into a DropRecord encoded as a newline-terminated JSON document.
+func NewDropPayload[T any](dropped *event.DroppedEvent[T], timestamp time.Time) (*event.Payload[T], error) {
+	record := DropRecord{
+		Timestamp:   timestamp,
+		Stage:       dropped.Stage,
+		Rule:        dropped.Rule,
+		Reason:      dropped.Reason,
+		Destination: dropped.Destination,
+	}
+	if dropped.Err != nil {
+		record.Error = dropped.Err.Error()
+	}
+
+	var metadata *event.Metadata
+	if dropped.Event != nil {
+		metadata = &dropped.Event.Metadata
+		record.Metadata = metadata
+		if content, err := dropped.Event.MarshalJSON(); err == nil {
+			record.Content = content
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode drop record: %w", err)
+	}
+
+	return event.NewPayload[T](metadata, append(data, '\n')), nil
+}
+
+// NewDropHandler returns an event.DropHandler that writes a DropRecord for each dropped event to s.
+// Writes are serialized, so s does not need to be safe for concurrent use.
+// The caller is responsible for closing s after the Conduit is stopped.
+func NewDropHandler[T any](s Sink[T]) event.DropHandler[T] {
+	var mu sync.Mutex
+
+	return func(dropped *event.DroppedEvent[T]) {
+		payload, err := NewDropPayload(dropped, time.Now())
+		if err != nil {
+			log.Warn(fmt.Sprintf("failed to record dropped event: %v", err))
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if err := s.Write(payload); err != nil {
+			log.Warn(fmt.Sprintf("failed to write dropped event to sink: %v", err))
+		}
+	}
+}
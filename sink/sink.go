@@ -14,4 +14,42 @@ type Sink[T any] interface {
 type Result[T any] struct {
 	Payload *event.Payload[T]
 	Err     error
+	// Attempts is the number of times the sink was asked to write the payload.
+	Attempts int
+	// Destination is the name of the destination the payload was sent to, if it has one.
+	Destination string
+}
+
+// RetryableError can be implemented by errors returned from Sink.Write
+// to tell the Sender whether the failed write is worth retrying.
+type RetryableError interface {
+	error
+	Retryable() bool
+}
+
+type retryableError struct {
+	err       error
+	retryable bool
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+func (e *retryableError) Retryable() bool {
+	return e.retryable
+}
+
+// NewRetryableError wraps err to mark it as a transient failure that should be retried.
+func NewRetryableError(err error) error {
+	return &retryableError{err: err, retryable: true}
+}
+
+// NewPermanentError wraps err to mark it as a failure that will not succeed on retry.
+func NewPermanentError(err error) error {
+	return &retryableError{err: err, retryable: false}
 }
@@ -0,0 +1,541 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var _ Source[any] = (*FileSource[any])(nil)
+
+const (
+	// TagFilePath is the tag holding the path of the file the event was read from.
+	TagFilePath = "file.path"
+	// TagFileOffset is the tag holding the byte offset of the line the event was read from.
+	TagFileOffset = "file.offset"
+)
+
+var (
+	// DefaultFilePollInterval is the default interval at which files are checked for new lines.
+	DefaultFilePollInterval = 250 * time.Millisecond
+	// DefaultMaxLineSize is the default maximum size of a line in bytes.
+	DefaultMaxLineSize = 1024 * 1024
+)
+
+type FileSourceConfig[T any] struct {
+	// Paths is a list of glob patterns of the files to follow.
+	// Files matching the patterns after the source is started are picked up as well.
+	Paths []string
+
+	// CheckpointPath is the file where the read offsets are persisted,
+	// so that reading resumes where it left off after a restart.
+	// If empty, offsets are not persisted.
+	CheckpointPath string
+
+	// ReadFromBeginning reads files that exist when the source is started and have no checkpoint
+	// from the beginning. By default only lines appended after the start are read.
+	// Files that appear later are always read from the beginning.
+	ReadFromBeginning bool
+
+	// PollInterval is the interval at which files are checked for new lines and rotation.
+	// If zero, DefaultFilePollInterval is used.
+	PollInterval time.Duration
+
+	// MaxLineSize is the maximum size of a line in bytes. Longer lines are skipped.
+	// If zero, DefaultMaxLineSize is used.
+	MaxLineSize int
+
+	// Decoder decodes a line without its line terminator into the event content.
+	// If not specified, the line is decoded as JSON.
+	Decoder func(line []byte) (T, error)
+}
+
+// FileSource follows files like `tail -F`, emitting an event for each line.
+// Files rotated by rename or truncated are detected and read from the beginning.
+// Files removed without being replaced are closed, and their checkpoints are dropped.
+type FileSource[T any] struct {
+	config FileSourceConfig[T]
+
+	files       map[string]*tailedFile
+	checkpoints map[string]fileCheckpoint
+	dirty       bool
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
+}
+
+// fileID identifies a file by its device and inode numbers. The zero value is an unknown identity.
+type fileID struct {
+	Dev   uint64 `json:"dev,omitempty"`
+	Inode uint64 `json:"inode,omitempty"`
+}
+
+// fileCheckpoint is the read offset of a path, with the identity of the file it was read from,
+// so that a file rotated while the source is stopped is not read from the offset of the previous one.
+type fileCheckpoint struct {
+	Offset int64 `json:"offset"`
+	fileID
+}
+
+// UnmarshalJSON also accepts a bare offset, as written by the previous versions without the identity of the file.
+func (c *fileCheckpoint) UnmarshalJSON(data []byte) error {
+	var offset int64
+	if err := json.Unmarshal(data, &offset); err == nil {
+		*c = fileCheckpoint{Offset: offset}
+		return nil
+	}
+
+	type checkpoint fileCheckpoint
+	return json.Unmarshal(data, (*checkpoint)(c))
+}
+
+// tailedFile is an open file being followed.
+type tailedFile struct {
+	path string
+	file *os.File
+	id   fileID
+	// missing is set when the path was found removed, and the file is closed if it is still missing at the next poll.
+	missing bool
+	// offset is the offset of the first byte that has not been emitted yet.
+	offset int64
+	// partial is an incomplete last line waiting for its line terminator.
+	partial []byte
+	// skipping is set while the rest of a line that exceeded the maximum line size is discarded.
+	skipping bool
+}
+
+func NewFileSource[T any](config FileSourceConfig[T]) (*FileSource[T], error) {
+	if len(config.Paths) == 0 {
+		return nil, errors.New("no file paths are specified")
+	}
+
+	for _, pattern := range config.Paths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file path pattern %q: %w", pattern, err)
+		}
+	}
+
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultFilePollInterval
+	}
+	if config.MaxLineSize <= 0 {
+		config.MaxLineSize = DefaultMaxLineSize
+	}
+	if config.Decoder == nil {
+		config.Decoder = func(line []byte) (T, error) {
+			var content T
+			err := json.Unmarshal(line, &content)
+			return content, err
+		}
+	}
+
+	return &FileSource[T]{
+		config:      config,
+		files:       map[string]*tailedFile{},
+		checkpoints: map[string]fileCheckpoint{},
+	}, nil
+}
+
+func (s *FileSource[T]) Start(
+	ctx context.Context,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) error {
+	if err := s.loadCheckpoints(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	// Files that already exist are opened before Start returns,
+	// so lines appended right after the start are not missed.
+	s.discover(errorHandler, !s.config.ReadFromBeginning)
+	s.dropRemovedCheckpoints()
+
+	go s.run(ctx, out, errorHandler)
+
+	return nil
+}
+
+func (s *FileSource[T]) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for _, f := range s.files {
+		_ = f.file.Close()
+	}
+
+	return s.saveCheckpoints()
+}
+
+func (s *FileSource[T]) run(ctx context.Context, out chan<- *event.RawEvent[T], errorHandler ErrorHandler) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, f := range s.files {
+			if err := s.follow(ctx, f, out, errorHandler); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return
+				}
+				errorHandler(err)
+			}
+		}
+
+		if err := s.saveCheckpoints(); err != nil {
+			errorHandler(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.discover(errorHandler, false)
+	}
+}
+
+// discover opens files matching the patterns that are not followed yet.
+// If fromEnd is set, files without a checkpoint are read from the end.
+func (s *FileSource[T]) discover(errorHandler ErrorHandler, fromEnd bool) {
+	for _, pattern := range s.config.Paths {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			errorHandler(fmt.Errorf("failed to match file path pattern %q: %w", pattern, err))
+			continue
+		}
+
+		for _, path := range paths {
+			if _, ok := s.files[path]; ok {
+				continue
+			}
+
+			f, err := s.open(path, fromEnd)
+			if err != nil {
+				errorHandler(err)
+				continue
+			}
+
+			s.files[path] = f
+		}
+	}
+}
+
+func (s *FileSource[T]) open(path string, fromEnd bool) (*tailedFile, error) {
+	file, err := os.Open(path) //#nosec G304
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if info.IsDir() {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	f := &tailedFile{path: path, file: file, id: identify(info)}
+
+	s.mu.Lock()
+	checkpoint, ok := s.checkpoints[path]
+	s.mu.Unlock()
+
+	switch {
+	case ok && checkpoint.fileID != (fileID{}) && f.id != (fileID{}) && checkpoint.fileID != f.id:
+		// The path is another file than the checkpoint was read from, so it was rotated while stopped.
+		f.offset = 0
+	case ok && checkpoint.Offset <= info.Size():
+		f.offset = checkpoint.Offset
+	case ok:
+		// The file is smaller than the checkpoint, so it was truncated or replaced while stopped.
+		f.offset = 0
+	case fromEnd:
+		f.offset = info.Size()
+	}
+
+	return f, nil
+}
+
+// follow emits the lines appended to the file, then handles rotation and truncation.
+func (s *FileSource[T]) follow(
+	ctx context.Context,
+	f *tailedFile,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) error {
+	if err := s.readLines(ctx, f, out, errorHandler); err != nil {
+		return err
+	}
+
+	current, err := f.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", f.path, err)
+	}
+
+	latest, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if !f.missing {
+			// The file was removed or renamed and not replaced yet. Keep following the open file
+			// until the next poll, since the writer may still append to it before the path is reused.
+			f.missing = true
+			return nil
+		}
+
+		// The file is gone, so it is closed and its checkpoint is dropped.
+		// If the path is reused later, the new file is read from the beginning.
+		_ = f.file.Close()
+		delete(s.files, f.path)
+		s.deleteCheckpoint(f.path)
+
+		return nil
+	}
+	f.missing = false
+
+	switch {
+	case err != nil:
+		return fmt.Errorf("failed to stat %s: %w", f.path, err)
+	case !os.SameFile(current, latest):
+		// Rotated by rename: the rest of the old file was read above, so switch to the new one.
+		_ = f.file.Close()
+
+		file, err := os.Open(f.path) //#nosec G304
+		if err != nil {
+			delete(s.files, f.path)
+			return fmt.Errorf("failed to open rotated %s: %w", f.path, err)
+		}
+
+		f.file = file
+		f.id = identify(latest)
+		f.reset()
+
+		return s.readLines(ctx, f, out, errorHandler)
+	case current.Size() < f.offset+int64(len(f.partial)):
+		// Rotated by truncation.
+		f.reset()
+		return s.readLines(ctx, f, out, errorHandler)
+	}
+
+	return nil
+}
+
+func (s *FileSource[T]) readLines(
+	ctx context.Context,
+	f *tailedFile,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) error {
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, err := f.file.ReadAt(buf, f.offset+int64(len(f.partial)))
+		if n == 0 {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return fmt.Errorf("failed to read %s: %w", f.path, err)
+			}
+
+			return nil
+		}
+
+		data := buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				f.appendPartial(data, s.config.MaxLineSize, errorHandler)
+				break
+			}
+
+			f.appendPartial(data[:i], s.config.MaxLineSize, errorHandler)
+			data = data[i+1:]
+
+			lineOffset := f.offset
+			line := bytes.TrimSuffix(f.partial, []byte{'\r'})
+			skipped := f.skipping
+
+			f.offset += int64(len(f.partial)) + 1
+			f.partial = f.partial[:0]
+			f.skipping = false
+
+			if skipped || len(line) == 0 {
+				s.setCheckpoint(f)
+				continue
+			}
+
+			if err := s.emit(ctx, f.path, lineOffset, line, out); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				errorHandler(err)
+			}
+			s.setCheckpoint(f)
+		}
+	}
+}
+
+func (s *FileSource[T]) emit(
+	ctx context.Context,
+	path string,
+	offset int64,
+	line []byte,
+	out chan<- *event.RawEvent[T],
+) error {
+	content, err := s.config.Decoder(line)
+	if err != nil {
+		return fmt.Errorf("failed to decode line at offset %d of %s: %w", offset, path, err)
+	}
+
+	rawEvent := event.NewRawEvent(content, &event.Metadata{
+		Tags: event.Tags{
+			TagFilePath:   path,
+			TagFileOffset: strconv.FormatInt(offset, 10),
+		},
+	})
+
+	select {
+	case out <- rawEvent:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *FileSource[T]) setCheckpoint(f *tailedFile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[f.path] = fileCheckpoint{Offset: f.offset, fileID: f.id}
+	s.dirty = true
+}
+
+func (s *FileSource[T]) deleteCheckpoint(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.checkpoints[path]; ok {
+		delete(s.checkpoints, path)
+		s.dirty = true
+	}
+}
+
+// dropRemovedCheckpoints drops the checkpoints of the files removed while the source was stopped.
+func (s *FileSource[T]) dropRemovedCheckpoints() {
+	s.mu.Lock()
+	paths := make([]string, 0, len(s.checkpoints))
+	for path := range s.checkpoints {
+		paths = append(paths, path)
+	}
+	s.mu.Unlock()
+
+	for _, path := range paths {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			s.deleteCheckpoint(path)
+		}
+	}
+}
+
+func (s *FileSource[T]) loadCheckpoints() error {
+	if s.config.CheckpointPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.config.CheckpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := json.Unmarshal(data, &s.checkpoints); err != nil {
+		return fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// saveCheckpoints atomically replaces the checkpoint file with the current offsets.
+func (s *FileSource[T]) saveCheckpoints() error {
+	if s.config.CheckpointPath == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s.checkpoints)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp := s.config.CheckpointPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp, s.config.CheckpointPath); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (f *tailedFile) reset() {
+	f.offset = 0
+	f.partial = f.partial[:0]
+	f.skipping = false
+}
+
+func (f *tailedFile) appendPartial(data []byte, maxLineSize int, errorHandler ErrorHandler) {
+	if f.skipping {
+		f.offset += int64(len(data))
+		return
+	}
+
+	if len(f.partial)+len(data) > maxLineSize {
+		errorHandler(fmt.Errorf(
+			"line at offset %d of %s exceeds the maximum line size of %d bytes, skipping",
+			f.offset, f.path, maxLineSize,
+		))
+
+		f.offset += int64(len(f.partial) + len(data))
+		f.partial = f.partial[:0]
+		f.skipping = true
+
+		return
+	}
+
+	f.partial = append(f.partial, data...)
+}
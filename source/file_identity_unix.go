@@ -0,0 +1,19 @@
+//go:build unix
+
+package source
+
+import (
+	"os"
+	"syscall"
+)
+
+// identify returns the device and inode numbers of the file.
+func identify(info os.FileInfo) fileID {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}
+	}
+
+	// the types of the fields differ by platform
+	return fileID{Dev: uint64(stat.Dev), Inode: uint64(stat.Ino)}
+}
@@ -0,0 +1,261 @@
+package source_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/source"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendFile(t *testing.T, path string, data string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+}
+
+func receive[T any](t *testing.T, out <-chan *event.RawEvent[T]) *event.RawEvent[T] {
+	t.Helper()
+
+	select {
+	case evt := <-out:
+		return evt
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return nil
+	}
+}
+
+func startFileSource(
+	t *testing.T,
+	config source.FileSourceConfig[testutils.DummyEvent],
+) (*source.FileSource[testutils.DummyEvent], chan *event.RawEvent[testutils.DummyEvent]) {
+	t.Helper()
+
+	config.PollInterval = 10 * time.Millisecond
+
+	s, err := source.NewFileSource(config)
+	require.NoError(t, err)
+
+	out := make(chan *event.RawEvent[testutils.DummyEvent])
+	require.NoError(t, s.Start(context.Background(), out, func(err error) {
+		t.Errorf("unexpected source error: %v", err)
+	}))
+
+	return s, out
+}
+
+func TestFileSource(t *testing.T) {
+	t.Parallel()
+
+	t.Run("emits appended lines with file tags", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		appendFile(t, path, `{"id":"0","name":"before start"}`+"\n")
+
+		s, out := startFileSource(t, source.FileSourceConfig[testutils.DummyEvent]{
+			Paths: []string{filepath.Join(dir, "*.log")},
+		})
+
+		appendFile(t, path, `{"id":"1","name":"first"}`+"\n"+`{"id":"2",`)
+		evt := receive(t, out)
+		assert.Equal(t, testutils.DummyEvent{ID: "1", Name: "first"}, evt.Content)
+		assert.Equal(t, event.Tags{source.TagFilePath: path, source.TagFileOffset: "33"}, evt.Metadata.Tags)
+
+		// The incomplete line is emitted once it is terminated.
+		appendFile(t, path, `"name":"second"}`+"\n")
+		evt = receive(t, out)
+		assert.Equal(t, testutils.DummyEvent{ID: "2", Name: "second"}, evt.Content)
+		assert.Equal(t, "59", evt.Metadata.Tags[source.TagFileOffset])
+
+		// Files created after the start are read from the beginning.
+		other := filepath.Join(dir, "other.log")
+		appendFile(t, other, `{"id":"3","name":"new file"}`+"\n")
+		evt = receive(t, out)
+		assert.Equal(t, testutils.DummyEvent{ID: "3", Name: "new file"}, evt.Content)
+		assert.Equal(t, other, evt.Metadata.Tags[source.TagFilePath])
+
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	t.Run("follows rotated files", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		appendFile(t, path, "")
+
+		s, out := startFileSource(t, source.FileSourceConfig[testutils.DummyEvent]{
+			Paths: []string{path},
+		})
+
+		appendFile(t, path, `{"id":"1","name":"before rename"}`+"\n")
+		assert.Equal(t, "1", receive(t, out).Content.ID)
+
+		// Rotated by rename, with a last line written to the old file.
+		appendFile(t, path, `{"id":"2","name":"after rename"}`+"\n")
+		require.NoError(t, os.Rename(path, path+".1"))
+		appendFile(t, path, `{"id":"3","name":"new file"}`+"\n")
+
+		assert.Equal(t, "2", receive(t, out).Content.ID)
+		evt := receive(t, out)
+		assert.Equal(t, "3", evt.Content.ID)
+		assert.Equal(t, "0", evt.Metadata.Tags[source.TagFileOffset])
+
+		// Rotated by truncation, detected since the file became smaller than the read offset.
+		require.NoError(t, os.Truncate(path, 0))
+		appendFile(t, path, `{"id":"4"}`+"\n")
+		evt = receive(t, out)
+		assert.Equal(t, "4", evt.Content.ID)
+		assert.Equal(t, "0", evt.Metadata.Tags[source.TagFileOffset])
+
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	t.Run("resumes from the checkpoint", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		config := source.FileSourceConfig[testutils.DummyEvent]{
+			Paths:             []string{path},
+			CheckpointPath:    filepath.Join(dir, "checkpoint.json"),
+			ReadFromBeginning: true,
+		}
+
+		appendFile(t, path, `{"id":"1","name":"first"}`+"\n")
+
+		s, out := startFileSource(t, config)
+		assert.Equal(t, "1", receive(t, out).Content.ID)
+		assert.NoError(t, s.Stop(context.Background()))
+
+		appendFile(t, path, `{"id":"2","name":"while stopped"}`+"\n")
+
+		s, out = startFileSource(t, config)
+		assert.Equal(t, "2", receive(t, out).Content.ID)
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	t.Run("reads a file rotated while stopped from the beginning", func(t *testing.T) {
+		t.Parallel()
+
+		if runtime.GOOS == "windows" {
+			t.Skip("files are not identified by their inode on windows")
+		}
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		config := source.FileSourceConfig[testutils.DummyEvent]{
+			Paths:             []string{path},
+			CheckpointPath:    filepath.Join(dir, "checkpoint.json"),
+			ReadFromBeginning: true,
+		}
+
+		appendFile(t, path, `{"id":"1"}`+"\n")
+
+		s, out := startFileSource(t, config)
+		assert.Equal(t, "1", receive(t, out).Content.ID)
+		assert.NoError(t, s.Stop(context.Background()))
+
+		// The new file is larger than the checkpoint, so only its identity tells it apart.
+		require.NoError(t, os.Rename(path, path+".1"))
+		appendFile(t, path, `{"id":"2","name":"rotated"}`+"\n")
+
+		s, out = startFileSource(t, config)
+		evt := receive(t, out)
+		assert.Equal(t, "2", evt.Content.ID)
+		assert.Equal(t, "0", evt.Metadata.Tags[source.TagFileOffset])
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	t.Run("resumes from a checkpoint without file identities", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		checkpointPath := filepath.Join(dir, "checkpoint.json")
+		appendFile(t, path, `{"id":"1"}`+"\n"+`{"id":"2"}`+"\n")
+
+		checkpoint, err := json.Marshal(map[string]int64{path: 11})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(checkpointPath, checkpoint, 0o600))
+
+		s, out := startFileSource(t, source.FileSourceConfig[testutils.DummyEvent]{
+			Paths:          []string{path},
+			CheckpointPath: checkpointPath,
+		})
+		assert.Equal(t, "2", receive(t, out).Content.ID)
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	t.Run("closes removed files and drops their checkpoints", func(t *testing.T) {
+		t.Parallel()
+
+		dir := t.TempDir()
+		path := filepath.Join(dir, "app.log")
+		checkpointPath := filepath.Join(dir, "checkpoint.json")
+		appendFile(t, path, "")
+
+		s, out := startFileSource(t, source.FileSourceConfig[testutils.DummyEvent]{
+			Paths:          []string{filepath.Join(dir, "*.log")},
+			CheckpointPath: checkpointPath,
+		})
+
+		appendFile(t, path, `{"id":"1"}`+"\n")
+		assert.Equal(t, "1", receive(t, out).Content.ID)
+
+		require.NoError(t, os.Remove(path))
+		assert.Eventually(t, func() bool {
+			data, err := os.ReadFile(checkpointPath)
+			return err == nil && !strings.Contains(string(data), path)
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// A file created at the path later is read from the beginning.
+		appendFile(t, path, `{"id":"2"}`+"\n")
+		evt := receive(t, out)
+		assert.Equal(t, "2", evt.Content.ID)
+		assert.Equal(t, "0", evt.Metadata.Tags[source.TagFileOffset])
+
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+}
+
+func TestFileSource_DecodeError(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "not json\n"+`{"id":"1","name":"valid"}`+"\n")
+
+	s, err := source.NewFileSource(source.FileSourceConfig[testutils.DummyEvent]{
+		Paths:             []string{path},
+		ReadFromBeginning: true,
+		PollInterval:      10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	errs := make(chan error, 1)
+	out := make(chan *event.RawEvent[testutils.DummyEvent])
+	require.NoError(t, s.Start(context.Background(), out, func(err error) { errs <- err }))
+
+	assert.Equal(t, "1", receive(t, out).Content.ID)
+	assert.ErrorContains(t, <-errs, "failed to decode line at offset 0")
+
+	assert.NoError(t, s.Stop(context.Background()))
+}
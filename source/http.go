@@ -0,0 +1,483 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cloudevent "github.com/cloudevents/sdk-go/v2/event"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/tracing"
+)
+
+var _ Source[any] = (*HTTPSource[any])(nil)
+
+const (
+	// TagHTTPRemoteAddr is the tag holding the network address of the client that sent the event.
+	TagHTTPRemoteAddr = "http.remote_addr"
+	// TagCloudEventsID is the tag holding the id attribute of a CloudEvent.
+	TagCloudEventsID = "cloudevents.id"
+	// TagCloudEventsSource is the tag holding the source attribute of a CloudEvent.
+	TagCloudEventsSource = "cloudevents.source"
+	// TagCloudEventsType is the tag holding the type attribute of a CloudEvent.
+	TagCloudEventsType = "cloudevents.type"
+	// TagCloudEventsSubject is the tag holding the subject attribute of a CloudEvent.
+	TagCloudEventsSubject = "cloudevents.subject"
+)
+
+var (
+	// DefaultMaxBodySize is the default maximum size of a request body in bytes.
+	DefaultMaxBodySize int64 = 10 * 1024 * 1024
+	// DefaultBackpressureTimeout is the default time to wait for the pipeline to accept an event.
+	DefaultBackpressureTimeout = time.Second
+	// DefaultHMACHeader is the default header holding the HMAC signature of the request body.
+	DefaultHMACHeader = "X-Signature"
+)
+
+type HTTPSourceConfig[T any] struct {
+	// Addr is the TCP address to listen on, such as ":8080".
+	// If empty, no server is started and the HTTPSource must be mounted as an http.Handler.
+	Addr string
+
+	// TLSConfig enables HTTPS when Addr is set.
+	TLSConfig *tls.Config
+
+	// MaxBodySize is the maximum size in bytes of a request body, before and after decompression.
+	// If zero, DefaultMaxBodySize is used.
+	MaxBodySize int64
+
+	// BearerToken, if set, requires requests to have an `Authorization: Bearer <token>` header.
+	BearerToken string
+
+	// HMACSecret, if set, requires requests to be signed with HMAC-SHA256 of the request body.
+	// The hex encoded signature, optionally prefixed with "sha256=", is read from HMACHeader.
+	HMACSecret []byte
+
+	// HMACHeader is the header holding the HMAC signature.
+	// If empty, DefaultHMACHeader is used.
+	HMACHeader string
+
+	// BackpressureTimeout is the time to wait for the pipeline to accept an event
+	// before responding with 429 Too Many Requests.
+	// If zero, DefaultBackpressureTimeout is used.
+	BackpressureTimeout time.Duration
+
+	// Decoder decodes a JSON document into the event content.
+	// CloudEvents are passed in their JSON structured representation.
+	// If not specified, the document is decoded with json.Unmarshal.
+	Decoder func(data []byte) (T, error)
+}
+
+// HTTPSource receives events from HTTP POST requests.
+//
+// The request body is decoded according to its content type:
+//   - application/cloudevents+json, or a request with ce-* headers: a CloudEvent in structured or binary mode
+//   - application/cloudevents-batch+json: a batch of CloudEvents
+//   - application/x-ndjson: a JSON document per line
+//   - otherwise: a single JSON document
+//
+// Request bodies compressed with gzip (Content-Encoding: gzip) are decompressed.
+type HTTPSource[T any] struct {
+	config HTTPSourceConfig[T]
+
+	server *http.Server
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards out. Handlers hold the read lock while sending events,
+	// so that Stop can wait for them before releasing out.
+	mu  sync.RWMutex
+	out chan<- *event.RawEvent[T]
+}
+
+// httpError is an error that is returned to the client with the given status code.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func NewHTTPSource[T any](config HTTPSourceConfig[T]) (*HTTPSource[T], error) {
+	if config.TLSConfig != nil && config.Addr == "" {
+		return nil, errors.New("TLS requires a listen address")
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = DefaultMaxBodySize
+	}
+	if config.HMACHeader == "" {
+		config.HMACHeader = DefaultHMACHeader
+	}
+	if config.BackpressureTimeout <= 0 {
+		config.BackpressureTimeout = DefaultBackpressureTimeout
+	}
+	if config.Decoder == nil {
+		config.Decoder = func(data []byte) (T, error) {
+			var content T
+			err := json.Unmarshal(data, &content)
+			return content, err
+		}
+	}
+
+	return &HTTPSource[T]{config: config}, nil
+}
+
+func (s *HTTPSource[T]) Start(
+	ctx context.Context,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) error {
+	s.mu.Lock()
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.out = out
+	s.mu.Unlock()
+
+	if s.config.Addr == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.Addr, err)
+	}
+	if s.config.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.config.TLSConfig)
+	}
+
+	s.server = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errorHandler(fmt.Errorf("HTTP source server stopped: %w", err))
+		}
+	}()
+
+	return nil
+}
+
+func (s *HTTPSource[T]) Stop(ctx context.Context) error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	var err error
+	if s.server != nil {
+		err = s.server.Shutdown(ctx)
+	}
+
+	s.mu.Lock()
+	s.out = nil
+	s.mu.Unlock()
+
+	return err
+}
+
+// ServeHTTP handles a request containing one or more events.
+func (s *HTTPSource[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.authenticate(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	body, err := s.readBody(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	rawEvents, err := s.decode(r, body)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	setTraceContext(r.Header, rawEvents)
+
+	accepted, err := s.emit(rawEvents)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = fmt.Fprintf(w, "accepted %d events\n", accepted)
+}
+
+func (s *HTTPSource[T]) authenticate(r *http.Request) bool {
+	if s.config.BearerToken == "" {
+		return true
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.config.BearerToken)) == 1
+}
+
+// readBody reads the request body, verifies its signature and decompresses it.
+func (s *HTTPSource[T]) readBody(r *http.Request) ([]byte, error) {
+	body, err := readLimited(r.Body, s.config.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.config.HMACSecret) > 0 && !s.verifySignature(r, body) {
+		return nil, &httpError{status: http.StatusUnauthorized, msg: "invalid signature"}
+	}
+
+	switch strings.ToLower(r.Header.Get("Content-Encoding")) {
+	case "", "identity":
+		return body, nil
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, &httpError{status: http.StatusBadRequest, msg: "invalid gzip body"}
+		}
+		defer reader.Close()
+
+		return readLimited(reader, s.config.MaxBodySize)
+	default:
+		return nil, &httpError{
+			status: http.StatusUnsupportedMediaType,
+			msg:    "unsupported content encoding",
+		}
+	}
+}
+
+func (s *HTTPSource[T]) verifySignature(r *http.Request, body []byte) bool {
+	value := r.Header.Get(s.config.HMACHeader)
+	value = strings.TrimPrefix(value, "sha256=")
+
+	signature, err := hex.DecodeString(value)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, s.config.HMACSecret)
+	mac.Write(body)
+
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+func (s *HTTPSource[T]) decode(r *http.Request, body []byte) ([]*event.RawEvent[T], error) {
+	tags := event.Tags{TagHTTPRemoteAddr: r.RemoteAddr}
+
+	header := r.Header.Clone()
+	header.Del("Content-Encoding")
+	message := cehttp.NewMessage(header, io.NopCloser(bytes.NewReader(body)))
+
+	if cehttp.IsHTTPBatch(header) {
+		cloudEvents, err := binding.ToEvents(r.Context(), message, bytes.NewReader(body))
+		if err != nil {
+			return nil, badRequest("invalid CloudEvents batch", err)
+		}
+
+		return s.decodeCloudEvents(cloudEvents, tags)
+	}
+
+	if message.ReadEncoding() != binding.EncodingUnknown {
+		cloudEvent, err := binding.ToEvent(r.Context(), message)
+		if err != nil {
+			return nil, badRequest("invalid CloudEvent", err)
+		}
+
+		return s.decodeCloudEvents([]cloudevent.Event{*cloudEvent}, tags)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/jsonlines":
+		return s.decodeNDJSON(body, tags)
+	default:
+		content, err := s.config.Decoder(body)
+		if err != nil {
+			return nil, badRequest("invalid event", err)
+		}
+
+		return []*event.RawEvent[T]{s.newRawEvent(content, tags)}, nil
+	}
+}
+
+func (s *HTTPSource[T]) decodeNDJSON(body []byte, tags event.Tags) ([]*event.RawEvent[T], error) {
+	rawEvents := []*event.RawEvent[T]{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(body)+1)
+
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		content, err := s.config.Decoder(data)
+		if err != nil {
+			return nil, badRequest("invalid event at line "+strconv.Itoa(line), err)
+		}
+
+		rawEvents = append(rawEvents, s.newRawEvent(content, tags))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, badRequest("invalid NDJSON body", err)
+	}
+
+	return rawEvents, nil
+}
+
+func (s *HTTPSource[T]) decodeCloudEvents(
+	cloudEvents []cloudevent.Event,
+	tags event.Tags,
+) ([]*event.RawEvent[T], error) {
+	rawEvents := make([]*event.RawEvent[T], 0, len(cloudEvents))
+
+	for _, cloudEvent := range cloudEvents {
+		data, err := json.Marshal(cloudEvent)
+		if err != nil {
+			return nil, badRequest("invalid CloudEvent", err)
+		}
+
+		content, err := s.config.Decoder(data)
+		if err != nil {
+			return nil, badRequest("invalid CloudEvent", err)
+		}
+
+		rawEvent := s.newRawEvent(content, tags)
+		rawEvent.Metadata.Tags[TagCloudEventsID] = cloudEvent.ID()
+		rawEvent.Metadata.Tags[TagCloudEventsSource] = cloudEvent.Source()
+		rawEvent.Metadata.Tags[TagCloudEventsType] = cloudEvent.Type()
+		if subject := cloudEvent.Subject(); subject != "" {
+			rawEvent.Metadata.Tags[TagCloudEventsSubject] = subject
+		}
+		// The distributed tracing extension of the CloudEvent takes precedence over the request headers.
+		extensions := cloudEvent.Extensions()
+		if traceParent, ok := extensions[tracing.TraceParentHeader].(string); ok {
+			rawEvent.Metadata.TraceParent = traceParent
+			rawEvent.Metadata.TraceState, _ = extensions[tracing.TraceStateHeader].(string)
+		}
+
+		rawEvents = append(rawEvents, rawEvent)
+	}
+
+	return rawEvents, nil
+}
+
+func (s *HTTPSource[T]) newRawEvent(content T, tags event.Tags) *event.RawEvent[T] {
+	eventTags := make(event.Tags, len(tags))
+	for k, v := range tags {
+		eventTags[k] = v
+	}
+
+	return event.NewRawEvent(content, &event.Metadata{Tags: eventTags})
+}
+
+// setTraceContext sets the W3C Trace Context of the request to the events that do not carry their own.
+func setTraceContext[T any](header http.Header, rawEvents []*event.RawEvent[T]) {
+	traceParent := header.Get(tracing.TraceParentHeader)
+	if traceParent == "" {
+		return
+	}
+	traceState := header.Get(tracing.TraceStateHeader)
+
+	for _, rawEvent := range rawEvents {
+		if rawEvent.Metadata.TraceParent != "" {
+			continue
+		}
+		rawEvent.Metadata.TraceParent = traceParent
+		rawEvent.Metadata.TraceState = traceState
+	}
+}
+
+// emit sends the events to the pipeline and returns the number of accepted events.
+// If the pipeline does not accept an event within the backpressure timeout, the rest are rejected.
+func (s *HTTPSource[T]) emit(rawEvents []*event.RawEvent[T]) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.out == nil {
+		return 0, &httpError{status: http.StatusServiceUnavailable, msg: "source is not running"}
+	}
+
+	timer := time.NewTimer(s.config.BackpressureTimeout)
+	defer timer.Stop()
+
+	for i, rawEvent := range rawEvents {
+		select {
+		case s.out <- rawEvent:
+		case <-timer.C:
+			return i, &httpError{
+				status: http.StatusTooManyRequests,
+				msg:    fmt.Sprintf("pipeline is busy, accepted %d of %d events", i, len(rawEvents)),
+			}
+		case <-s.ctx.Done():
+			return i, &httpError{status: http.StatusServiceUnavailable, msg: "source is stopping"}
+		}
+	}
+
+	return len(rawEvents), nil
+}
+
+// readLimited reads r until EOF, failing with 413 if it is larger than limit bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, badRequest("failed to read body", err)
+	}
+
+	if int64(len(data)) > limit {
+		return nil, &httpError{status: http.StatusRequestEntityTooLarge, msg: "request body too large"}
+	}
+
+	return data, nil
+}
+
+func badRequest(msg string, err error) error {
+	return &httpError{status: http.StatusBadRequest, msg: fmt.Sprintf("%s: %v", msg, err)}
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	var httpErr *httpError
+	if !errors.As(err, &httpErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if httpErr.status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+
+	http.Error(w, httpErr.msg, httpErr.status)
+}
@@ -0,0 +1,340 @@
+package source_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cloudevent "github.com/cloudevents/sdk-go/v2/event"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/source"
+	"github.com/mrtc0/conduit/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startHTTPSource[T any](
+	t *testing.T,
+	config source.HTTPSourceConfig[T],
+	out chan *event.RawEvent[T],
+) *source.HTTPSource[T] {
+	t.Helper()
+
+	s, err := source.NewHTTPSource(config)
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background(), out, func(err error) {
+		t.Errorf("unexpected source error: %v", err)
+	}))
+
+	t.Cleanup(func() {
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	return s
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	_, err := w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+func TestHTTPSource_ServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body    []byte
+		headers map[string]string
+		want    []testutils.DummyEvent
+	}{
+		"single JSON": {
+			body:    []byte(`{"id":"1","name":"single"}`),
+			headers: map[string]string{"Content-Type": "application/json"},
+			want:    []testutils.DummyEvent{{ID: "1", Name: "single"}},
+		},
+		"NDJSON": {
+			body:    []byte("{\"id\":\"1\",\"name\":\"first\"}\n\n{\"id\":\"2\",\"name\":\"second\"}\n"),
+			headers: map[string]string{"Content-Type": "application/x-ndjson"},
+			want: []testutils.DummyEvent{
+				{ID: "1", Name: "first"},
+				{ID: "2", Name: "second"},
+			},
+		},
+		"gzip NDJSON": {
+			body: gzipped(t, "{\"id\":\"1\",\"name\":\"first\"}\n{\"id\":\"2\",\"name\":\"second\"}"),
+			headers: map[string]string{
+				"Content-Type":     "application/x-ndjson",
+				"Content-Encoding": "gzip",
+			},
+			want: []testutils.DummyEvent{
+				{ID: "1", Name: "first"},
+				{ID: "2", Name: "second"},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := make(chan *event.RawEvent[testutils.DummyEvent], len(tc.want))
+			s := startHTTPSource(t, source.HTTPSourceConfig[testutils.DummyEvent]{}, out)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tc.body))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+			require.Len(t, out, len(tc.want))
+			for _, want := range tc.want {
+				evt := <-out
+				assert.Equal(t, want, evt.Content)
+				assert.Equal(t, req.RemoteAddr, evt.Metadata.Tags[source.TagHTTPRemoteAddr])
+			}
+		})
+	}
+}
+
+func TestHTTPSource_CloudEvents(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body    string
+		headers map[string]string
+	}{
+		"structured mode": {
+			body: `{"specversion":"1.0","id":"abc","source":"example/uri","type":"example.event",` +
+				`"datacontenttype":"application/json","data":{"message":"hello"}}`,
+			headers: map[string]string{"Content-Type": "application/cloudevents+json"},
+		},
+		"binary mode": {
+			body: `{"message":"hello"}`,
+			headers: map[string]string{
+				"Content-Type":   "application/json",
+				"Ce-Specversion": "1.0",
+				"Ce-Id":          "abc",
+				"Ce-Source":      "example/uri",
+				"Ce-Type":        "example.event",
+			},
+		},
+		"batch": {
+			body: `[{"specversion":"1.0","id":"abc","source":"example/uri","type":"example.event",` +
+				`"datacontenttype":"application/json","data":{"message":"hello"}}]`,
+			headers: map[string]string{"Content-Type": "application/cloudevents-batch+json"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := make(chan *event.RawEvent[cloudevent.Event], 1)
+			s := startHTTPSource(t, source.HTTPSourceConfig[cloudevent.Event]{}, out)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+			require.Len(t, out, 1)
+			evt := <-out
+			assert.Equal(t, "abc", evt.Content.ID())
+			assert.Equal(t, "example.event", evt.Content.Type())
+			assert.JSONEq(t, `{"message":"hello"}`, string(evt.Content.Data()))
+			assert.Equal(t, "abc", evt.Metadata.Tags[source.TagCloudEventsID])
+			assert.Equal(t, "example/uri", evt.Metadata.Tags[source.TagCloudEventsSource])
+			assert.Equal(t, "example.event", evt.Metadata.Tags[source.TagCloudEventsType])
+		})
+	}
+}
+
+func TestHTTPSource_TraceContext(t *testing.T) {
+	t.Parallel()
+
+	const (
+		requestTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		eventTraceParent   = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	)
+
+	testCases := map[string]struct {
+		body    string
+		headers map[string]string
+		want    string
+	}{
+		"request headers": {
+			body: `{"id":"1","name":"traced"}`,
+			headers: map[string]string{
+				"Content-Type": "application/json",
+				"Traceparent":  requestTraceParent,
+				"Tracestate":   "vendor=value",
+			},
+			want: requestTraceParent,
+		},
+		"CloudEvents extension": {
+			body: `{"specversion":"1.0","id":"abc","source":"example/uri","type":"example.event",` +
+				`"traceparent":"` + eventTraceParent + `","tracestate":"vendor=value",` +
+				`"datacontenttype":"application/json","data":{"id":"1","name":"traced"}}`,
+			headers: map[string]string{
+				"Content-Type": "application/cloudevents+json",
+				"Traceparent":  requestTraceParent,
+			},
+			want: eventTraceParent,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := make(chan *event.RawEvent[map[string]any], 1)
+			s := startHTTPSource(t, source.HTTPSourceConfig[map[string]any]{}, out)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusAccepted, rec.Code, rec.Body.String())
+
+			require.Len(t, out, 1)
+			evt := <-out
+			assert.Equal(t, tc.want, evt.Metadata.TraceParent)
+			assert.Equal(t, "vendor=value", evt.Metadata.TraceState)
+		})
+	}
+}
+
+func TestHTTPSource_Rejects(t *testing.T) {
+	t.Parallel()
+
+	body := `{"id":"1","name":"event"}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	testCases := map[string]struct {
+		config  source.HTTPSourceConfig[testutils.DummyEvent]
+		method  string
+		body    string
+		headers map[string]string
+		want    int
+	}{
+		"method not allowed": {
+			method: http.MethodGet,
+			want:   http.StatusMethodNotAllowed,
+		},
+		"missing bearer token": {
+			config: source.HTTPSourceConfig[testutils.DummyEvent]{BearerToken: "token"},
+			body:   body,
+			want:   http.StatusUnauthorized,
+		},
+		"valid bearer token": {
+			config:  source.HTTPSourceConfig[testutils.DummyEvent]{BearerToken: "token"},
+			body:    body,
+			headers: map[string]string{"Authorization": "Bearer token"},
+			want:    http.StatusAccepted,
+		},
+		"invalid signature": {
+			config:  source.HTTPSourceConfig[testutils.DummyEvent]{HMACSecret: []byte("secret")},
+			body:    body,
+			headers: map[string]string{"X-Signature": "sha256=00"},
+			want:    http.StatusUnauthorized,
+		},
+		"valid signature": {
+			config:  source.HTTPSourceConfig[testutils.DummyEvent]{HMACSecret: []byte("secret")},
+			body:    body,
+			headers: map[string]string{"X-Signature": signature},
+			want:    http.StatusAccepted,
+		},
+		"body too large": {
+			config: source.HTTPSourceConfig[testutils.DummyEvent]{MaxBodySize: 10},
+			body:   body,
+			want:   http.StatusRequestEntityTooLarge,
+		},
+		"invalid JSON": {
+			body: `{"id":`,
+			want: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			out := make(chan *event.RawEvent[testutils.DummyEvent], 1)
+			s := startHTTPSource(t, tc.config, out)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+
+			req := httptest.NewRequest(method, "/", strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			s.ServeHTTP(rec, req)
+			assert.Equal(t, tc.want, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestHTTPSource_Backpressure(t *testing.T) {
+	t.Parallel()
+
+	// Nobody receives from out, so the pipeline is backpressured.
+	out := make(chan *event.RawEvent[testutils.DummyEvent])
+	s := startHTTPSource(t, source.HTTPSourceConfig[testutils.DummyEvent]{
+		BackpressureTimeout: 10 * time.Millisecond,
+	}, out)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"1","name":"event"}`))
+	rec := httptest.NewRecorder()
+
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+}
+
+func TestHTTPSource_Server(t *testing.T) {
+	t.Parallel()
+
+	out := make(chan *event.RawEvent[testutils.DummyEvent], 1)
+	s, err := source.NewHTTPSource(source.HTTPSourceConfig[testutils.DummyEvent]{Addr: "127.0.0.1:0"})
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background(), out, func(err error) {}))
+	assert.NoError(t, s.Stop(context.Background()))
+
+	// After Stop, events are no longer accepted.
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"1","name":"event"}`))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
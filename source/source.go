@@ -1,7 +1,27 @@
 package source
 
-import "github.com/mrtc0/conduit/event"
+import (
+	"context"
 
+	"github.com/mrtc0/conduit/event"
+)
+
+// EventSource is a source of raw events fed through a channel, such as Conduit.Write.
 type EventSource[T any] struct {
 	InputChannel chan *event.RawEvent[T]
 }
+
+// ErrorHandler is called with errors that a Source encounters while it is running,
+// such as an input that cannot be decoded.
+type ErrorHandler func(err error)
+
+// Source produces raw events from an external input such as files, HTTP requests or sockets.
+type Source[T any] interface {
+	// Start starts producing events to out and returns once the source is running.
+	// The source should stop when ctx is canceled.
+	// Errors that occur after Start returns are reported to errorHandler.
+	Start(ctx context.Context, out chan<- *event.RawEvent[T], errorHandler ErrorHandler) error
+	// Stop stops producing events and releases the resources of the source.
+	// The source must not send to out after Stop returns.
+	Stop(ctx context.Context) error
+}
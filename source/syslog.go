@@ -0,0 +1,438 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+var _ Source[any] = (*SyslogSource[any])(nil)
+
+const (
+	// TagSyslogRemoteAddr is the tag holding the network address of the peer that sent the message.
+	TagSyslogRemoteAddr = "syslog.remote_addr"
+	// TagSyslogFacility is the tag holding the facility keyword of the message, such as "auth".
+	TagSyslogFacility = "syslog.facility"
+	// TagSyslogSeverity is the tag holding the severity keyword of the message, such as "err".
+	TagSyslogSeverity = "syslog.severity"
+	// TagSyslogHostname is the tag holding the hostname of the message.
+	TagSyslogHostname = "syslog.hostname"
+	// TagSyslogAppName is the tag holding the app-name, or the TAG of an RFC 3164 message.
+	TagSyslogAppName = "syslog.app_name"
+	// TagSyslogProcID is the tag holding the procid of the message.
+	TagSyslogProcID = "syslog.proc_id"
+	// TagSyslogMsgID is the tag holding the msgid of an RFC 5424 message.
+	TagSyslogMsgID = "syslog.msg_id"
+	// TagSyslogStructuredDataPrefix is the prefix of the tags holding structured data parameters,
+	// in the form "syslog.sd.<SD-ID>.<PARAM-NAME>".
+	TagSyslogStructuredDataPrefix = "syslog.sd."
+)
+
+var (
+	// DefaultMaxSyslogMessageSize is the default maximum size of a syslog message in bytes.
+	DefaultMaxSyslogMessageSize = 64 * 1024
+)
+
+type SyslogSourceConfig[T any] struct {
+	// Network is the network to listen on, either "udp" or "tcp".
+	Network string
+
+	// Addr is the address to listen on, such as ":514".
+	Addr string
+
+	// TLSConfig enables TLS when Network is "tcp".
+	TLSConfig *tls.Config
+
+	// MaxMessageSize is the maximum size of a message in bytes. Longer messages are skipped.
+	// If zero, DefaultMaxSyslogMessageSize is used.
+	MaxMessageSize int
+
+	// Location is the time zone of RFC 3164 timestamps, which carry no time zone.
+	// If nil, time.Local is used.
+	Location *time.Location
+
+	// Decoder converts a parsed message into the event content.
+	// If not specified, the message is converted through its JSON representation.
+	Decoder func(msg *SyslogMessage) (T, error)
+}
+
+// SyslogSource receives RFC 3164 and RFC 5424 syslog messages over UDP, TCP or TLS.
+//
+// Over UDP each datagram is a message. Over TCP messages are framed either with
+// octet counting (RFC 6587 section 3.4.1) or by a trailing newline, detected per message.
+type SyslogSource[T any] struct {
+	config SyslogSourceConfig[T]
+
+	listener   net.Listener
+	packetConn net.PacketConn
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+}
+
+func NewSyslogSource[T any](config SyslogSourceConfig[T]) (*SyslogSource[T], error) {
+	switch config.Network {
+	case "udp", "udp4", "udp6":
+		if config.TLSConfig != nil {
+			return nil, errors.New("TLS is not supported over UDP")
+		}
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("unsupported network %q", config.Network)
+	}
+
+	if config.Addr == "" {
+		return nil, errors.New("no listen address is specified")
+	}
+
+	if config.MaxMessageSize <= 0 {
+		config.MaxMessageSize = DefaultMaxSyslogMessageSize
+	}
+	if config.Location == nil {
+		config.Location = time.Local
+	}
+	if config.Decoder == nil {
+		config.Decoder = func(msg *SyslogMessage) (T, error) {
+			var content T
+
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return content, err
+			}
+
+			err = json.Unmarshal(data, &content)
+			return content, err
+		}
+	}
+
+	return &SyslogSource[T]{
+		config: config,
+		conns:  map[net.Conn]struct{}{},
+	}, nil
+}
+
+func (s *SyslogSource[T]) Start(
+	ctx context.Context,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+
+	if s.isUDP() {
+		conn, err := net.ListenPacket(s.config.Network, s.config.Addr)
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to listen on %s: %w", s.config.Addr, err)
+		}
+		s.packetConn = conn
+
+		s.wg.Add(1)
+		go s.servePackets(ctx, out, errorHandler)
+
+		return nil
+	}
+
+	listener, err := net.Listen(s.config.Network, s.config.Addr)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to listen on %s: %w", s.config.Addr, err)
+	}
+	if s.config.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.config.TLSConfig)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.serveStream(ctx, out, errorHandler)
+
+	return nil
+}
+
+func (s *SyslogSource[T]) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+
+	if s.packetConn != nil {
+		_ = s.packetConn.Close()
+	}
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Addr returns the address the source is listening on, or nil if it is not started.
+// It is useful to find the port when Addr is configured with port 0.
+func (s *SyslogSource[T]) Addr() net.Addr {
+	switch {
+	case s.packetConn != nil:
+		return s.packetConn.LocalAddr()
+	case s.listener != nil:
+		return s.listener.Addr()
+	default:
+		return nil
+	}
+}
+
+func (s *SyslogSource[T]) isUDP() bool {
+	return s.config.Network == "udp" || s.config.Network == "udp4" || s.config.Network == "udp6"
+}
+
+func (s *SyslogSource[T]) servePackets(
+	ctx context.Context,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) {
+	defer s.wg.Done()
+
+	buf := make([]byte, s.config.MaxMessageSize)
+
+	for {
+		n, addr, err := s.packetConn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			errorHandler(fmt.Errorf("failed to read syslog datagram: %w", err))
+			continue
+		}
+
+		if err := s.emit(ctx, buf[:n], addr, out); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			errorHandler(err)
+		}
+	}
+}
+
+func (s *SyslogSource[T]) serveStream(
+	ctx context.Context,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			errorHandler(fmt.Errorf("failed to accept syslog connection: %w", err))
+			continue
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serveConn(ctx, conn, out, errorHandler)
+	}
+}
+
+func (s *SyslogSource[T]) serveConn(
+	ctx context.Context,
+	conn net.Conn,
+	out chan<- *event.RawEvent[T],
+	errorHandler ErrorHandler,
+) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReaderSize(conn, s.config.MaxMessageSize)
+
+	for {
+		frame, err := readSyslogFrame(reader, s.config.MaxMessageSize)
+		if len(frame) > 0 {
+			if err := s.emit(ctx, frame, conn.RemoteAddr(), out); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				errorHandler(err)
+			}
+		}
+
+		var frameErr *syslogFrameError
+		switch {
+		case err == nil:
+		case errors.As(err, &frameErr):
+			errorHandler(fmt.Errorf("skipped syslog message from %s: %w", conn.RemoteAddr(), err))
+		case errors.Is(err, io.EOF), ctx.Err() != nil, errors.Is(err, net.ErrClosed):
+			return
+		default:
+			errorHandler(fmt.Errorf("failed to read syslog message from %s: %w", conn.RemoteAddr(), err))
+			return
+		}
+	}
+}
+
+// syslogFrameError is an error for a message that is skipped without closing the connection.
+type syslogFrameError struct {
+	msg string
+}
+
+func (e *syslogFrameError) Error() string {
+	return e.msg
+}
+
+// readSyslogFrame reads a message framed with octet counting ("<length> <message>")
+// or terminated by a newline. It may return a final message together with io.EOF.
+func readSyslogFrame(r *bufio.Reader, maxSize int) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		return readOctetCountedFrame(r, maxSize)
+	}
+
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// Discard the rest of the line so that the next message can be read.
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = r.ReadSlice('\n')
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, &syslogFrameError{msg: fmt.Sprintf("message exceeds %d bytes", maxSize)}
+	}
+
+	return bytes.TrimRight(line, "\r\n"), err
+}
+
+func readOctetCountedFrame(r *bufio.Reader, maxSize int) ([]byte, error) {
+	prefix, err := r.ReadSlice(' ')
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("invalid message length: %w", err)
+	}
+
+	length, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid message length %q", prefix[:len(prefix)-1])
+	}
+
+	if length > maxSize {
+		if _, err := r.Discard(length); err != nil {
+			return nil, err
+		}
+
+		return nil, &syslogFrameError{msg: fmt.Sprintf("message of %d bytes exceeds %d bytes", length, maxSize)}
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	return frame, nil
+}
+
+func (s *SyslogSource[T]) emit(
+	ctx context.Context,
+	data []byte,
+	addr net.Addr,
+	out chan<- *event.RawEvent[T],
+) error {
+	msg, err := ParseSyslogMessage(data, time.Now(), s.config.Location)
+	if err != nil {
+		return fmt.Errorf("failed to parse syslog message from %s: %w", addr, err)
+	}
+
+	content, err := s.config.Decoder(msg)
+	if err != nil {
+		return fmt.Errorf("failed to decode syslog message from %s: %w", addr, err)
+	}
+
+	rawEvent := event.NewRawEvent(content, &event.Metadata{
+		Tags: syslogTags(msg, addr),
+	})
+
+	select {
+	case out <- rawEvent:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func syslogTags(msg *SyslogMessage, addr net.Addr) event.Tags {
+	tags := event.Tags{
+		TagSyslogFacility: msg.FacilityName(),
+		TagSyslogSeverity: msg.SeverityName(),
+	}
+
+	if addr != nil {
+		tags[TagSyslogRemoteAddr] = addr.String()
+	}
+
+	for key, value := range map[string]string{
+		TagSyslogHostname: msg.Hostname,
+		TagSyslogAppName:  msg.AppName,
+		TagSyslogProcID:   msg.ProcID,
+		TagSyslogMsgID:    msg.MsgID,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+
+	for id, params := range msg.StructuredData {
+		for name, value := range params {
+			tags[TagSyslogStructuredDataPrefix+id+"."+name] = value
+		}
+	}
+
+	return tags
+}
@@ -0,0 +1,312 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const syslogNilValue = "-"
+
+var (
+	syslogFacilities = []string{
+		"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+		"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+		"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+	}
+	syslogSeverities = []string{
+		"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+	}
+)
+
+// SyslogMessage is a syslog message parsed from RFC 3164 or RFC 5424 format.
+type SyslogMessage struct {
+	Facility int `json:"facility"`
+	Severity int `json:"severity"`
+	// Version is the version of the RFC 5424 format, or 0 for RFC 3164 messages.
+	Version   int       `json:"version"`
+	Timestamp time.Time `json:"timestamp,omitzero"`
+	Hostname  string    `json:"hostname,omitempty"`
+	AppName   string    `json:"app_name,omitempty"`
+	ProcID    string    `json:"proc_id,omitempty"`
+	MsgID     string    `json:"msg_id,omitempty"`
+	// StructuredData maps SD-IDs to their parameters. It is only set for RFC 5424 messages.
+	StructuredData map[string]map[string]string `json:"structured_data,omitempty"`
+	Message        string                       `json:"message"`
+}
+
+// FacilityName returns the keyword of the facility, such as "auth", or its number if unknown.
+func (m *SyslogMessage) FacilityName() string {
+	if m.Facility >= 0 && m.Facility < len(syslogFacilities) {
+		return syslogFacilities[m.Facility]
+	}
+
+	return strconv.Itoa(m.Facility)
+}
+
+// SeverityName returns the keyword of the severity, such as "err", or its number if unknown.
+func (m *SyslogMessage) SeverityName() string {
+	if m.Severity >= 0 && m.Severity < len(syslogSeverities) {
+		return syslogSeverities[m.Severity]
+	}
+
+	return strconv.Itoa(m.Severity)
+}
+
+// ParseSyslogMessage parses a syslog message in RFC 5424 or RFC 3164 format.
+// RFC 3164 timestamps have no year and time zone, so they are interpreted in loc,
+// in the year that puts them closest to now.
+func ParseSyslogMessage(data []byte, now time.Time, loc *time.Location) (*SyslogMessage, error) {
+	line := strings.TrimRight(string(data), "\r\n\x00")
+
+	if !strings.HasPrefix(line, "<") {
+		return nil, errors.New("missing priority")
+	}
+
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return nil, errors.New("invalid priority")
+	}
+
+	priority, err := strconv.Atoi(line[1:end])
+	if err != nil || priority < 0 || priority > 191 {
+		return nil, fmt.Errorf("invalid priority %q", line[1:end])
+	}
+
+	msg := &SyslogMessage{
+		Facility: priority / 8,
+		Severity: priority % 8,
+	}
+	rest := line[end+1:]
+
+	if version, after, ok := cutSyslogVersion(rest); ok {
+		msg.Version = version
+		if err := parseRFC5424(msg, after); err != nil {
+			return nil, err
+		}
+
+		return msg, nil
+	}
+
+	parseRFC3164(msg, rest, now, loc)
+
+	return msg, nil
+}
+
+// cutSyslogVersion returns the RFC 5424 version at the start of s, if any.
+func cutSyslogVersion(s string) (int, string, bool) {
+	i := 0
+	for i < len(s) && i < 3 && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	if i == 0 || i >= len(s) || s[i] != ' ' || s[0] == '0' {
+		return 0, s, false
+	}
+
+	version, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, s, false
+	}
+
+	return version, s[i+1:], true
+}
+
+func parseRFC5424(msg *SyslogMessage, s string) error {
+	fields := make([]string, 0, 5)
+	for range 5 {
+		field, rest, ok := strings.Cut(s, " ")
+		if !ok {
+			return errors.New("incomplete RFC 5424 header")
+		}
+
+		fields = append(fields, field)
+		s = rest
+	}
+
+	if fields[0] != syslogNilValue {
+		timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", fields[0])
+		}
+		msg.Timestamp = timestamp
+	}
+
+	msg.Hostname = syslogField(fields[1])
+	msg.AppName = syslogField(fields[2])
+	msg.ProcID = syslogField(fields[3])
+	msg.MsgID = syslogField(fields[4])
+
+	rest, err := parseStructuredData(msg, s)
+	if err != nil {
+		return err
+	}
+
+	rest = strings.TrimPrefix(rest, " ")
+	rest = strings.TrimPrefix(rest, "\ufeff")
+	msg.Message = rest
+
+	return nil
+}
+
+// parseStructuredData parses the STRUCTURED-DATA part of an RFC 5424 message and returns the rest.
+func parseStructuredData(msg *SyslogMessage, s string) (string, error) {
+	if strings.HasPrefix(s, syslogNilValue) {
+		return s[1:], nil
+	}
+
+	if !strings.HasPrefix(s, "[") {
+		return "", errors.New("invalid structured data")
+	}
+
+	msg.StructuredData = map[string]map[string]string{}
+
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return "", errors.New("invalid structured data element")
+		}
+
+		id := s[:end]
+		params := map[string]string{}
+		msg.StructuredData[id] = params
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+
+			name, rest, ok := strings.Cut(s, "=\"")
+			if !ok || name == "" {
+				return "", fmt.Errorf("invalid structured data parameter in %q", id)
+			}
+
+			value, rest, err := parseSDParamValue(rest)
+			if err != nil {
+				return "", fmt.Errorf("invalid structured data parameter %q in %q: %w", name, id, err)
+			}
+
+			params[name] = value
+			s = rest
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return "", fmt.Errorf("unterminated structured data element %q", id)
+		}
+		s = s[1:]
+	}
+
+	return s, nil
+}
+
+// parseSDParamValue parses a quoted parameter value after its opening quote and returns the rest.
+func parseSDParamValue(s string) (string, string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), s[i+1:], nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return "", "", errors.New("unterminated value")
+}
+
+// parseRFC3164 parses the rest of a BSD syslog message after the priority.
+// The format is loosely defined, so anything that cannot be parsed is kept in the message.
+func parseRFC3164(msg *SyslogMessage, s string, now time.Time, loc *time.Location) {
+	const stampLen = len(time.Stamp)
+
+	if len(s) >= stampLen {
+		if timestamp, err := time.ParseInLocation(time.Stamp, s[:stampLen], loc); err == nil {
+			msg.Timestamp = withClosestYear(timestamp, now.In(loc))
+			s = strings.TrimPrefix(s[stampLen:], " ")
+
+			if host, rest, ok := strings.Cut(s, " "); ok && !isSyslogTag(host) {
+				msg.Hostname = host
+				s = rest
+			}
+		}
+	}
+
+	if tag, rest, ok := cutSyslogTag(s); ok {
+		msg.AppName = tag.name
+		msg.ProcID = tag.pid
+		s = rest
+	}
+
+	msg.Message = s
+}
+
+type syslogTag struct {
+	name string
+	pid  string
+}
+
+// cutSyslogTag cuts a TAG such as "sshd[123]: " or "kernel: " from the start of s.
+func cutSyslogTag(s string) (syslogTag, string, bool) {
+	end := strings.IndexAny(s, "[: ")
+	if end <= 0 || end > 48 {
+		return syslogTag{}, s, false
+	}
+
+	tag := syslogTag{name: s[:end]}
+	rest := s[end:]
+
+	if strings.HasPrefix(rest, "[") {
+		pid, after, ok := strings.Cut(rest[1:], "]")
+		if !ok {
+			return syslogTag{}, s, false
+		}
+		tag.pid = pid
+		rest = after
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return syslogTag{}, s, false
+	}
+
+	return tag, strings.TrimPrefix(rest[1:], " "), true
+}
+
+func isSyslogTag(s string) bool {
+	return strings.HasSuffix(s, ":") || strings.HasSuffix(s, "]:")
+}
+
+// withClosestYear sets the year of a timestamp without a year so that it is closest to now.
+func withClosestYear(t time.Time, now time.Time) time.Time {
+	candidate := t.AddDate(now.Year(), 0, 0)
+
+	switch {
+	case candidate.Sub(now) > 30*24*time.Hour:
+		return candidate.AddDate(-1, 0, 0)
+	case now.Sub(candidate) > 335*24*time.Hour:
+		return candidate.AddDate(1, 0, 0)
+	default:
+		return candidate
+	}
+}
+
+func syslogField(s string) string {
+	if s == syslogNilValue {
+		return ""
+	}
+
+	if !utf8.ValidString(s) {
+		return strings.ToValidUTF8(s, "\ufffd")
+	}
+
+	return s
+}
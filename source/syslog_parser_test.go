@@ -0,0 +1,116 @@
+package source_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mrtc0/conduit/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyslogMessage(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2025, time.January, 5, 0, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		data []byte
+		want *source.SyslogMessage
+	}{
+		"RFC 5424": {
+			data: []byte(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+				`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] ` +
+				"\ufeffAn application event log entry..."),
+			want: &source.SyslogMessage{
+				Facility:  20,
+				Severity:  5,
+				Version:   1,
+				Timestamp: time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:  "mymachine.example.com",
+				AppName:   "evntslog",
+				MsgID:     "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473":     {"iut": "3", "eventSource": "Application", "eventID": "1011"},
+					"examplePriority@32473": {"class": "high"},
+				},
+				Message: "An application event log entry...",
+			},
+		},
+		"RFC 5424 with nil values and escaped structured data": {
+			data: []byte(`<34>1 - - - 1234 - [meta text="a \"quoted\" \]value\\"]` + "\n"),
+			want: &source.SyslogMessage{
+				Facility: 4,
+				Severity: 2,
+				Version:  1,
+				ProcID:   "1234",
+				StructuredData: map[string]map[string]string{
+					"meta": {"text": `a "quoted" ]value\`},
+				},
+			},
+		},
+		"RFC 3164": {
+			data: []byte("<34>Oct 11 22:14:15 mymachine su[42]: 'su root' failed for lonvick on /dev/pts/8"),
+			want: &source.SyslogMessage{
+				Facility:  4,
+				Severity:  2,
+				Timestamp: time.Date(2024, time.October, 11, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine",
+				AppName:   "su",
+				ProcID:    "42",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		"RFC 3164 without hostname": {
+			data: []byte("<13>Jan  4 10:00:00 kernel: eth0 link up"),
+			want: &source.SyslogMessage{
+				Facility:  1,
+				Severity:  5,
+				Timestamp: time.Date(2025, time.January, 4, 10, 0, 0, 0, time.UTC),
+				AppName:   "kernel",
+				Message:   "eth0 link up",
+			},
+		},
+		"RFC 3164 without header": {
+			data: []byte("<13>something happened"),
+			want: &source.SyslogMessage{
+				Facility: 1,
+				Severity: 5,
+				Message:  "something happened",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			msg, err := source.ParseSyslogMessage(tc.data, now, time.UTC)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, msg)
+		})
+	}
+}
+
+func TestParseSyslogMessage_Invalid(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]string{
+		"missing priority":          "Oct 11 22:14:15 mymachine su: failed",
+		"priority out of range":     "<192>1 - - - - - -",
+		"incomplete header":         "<34>1 2003-10-11T22:14:15.003Z mymachine",
+		"invalid timestamp":         "<34>1 yesterday mymachine su - - -",
+		"invalid structured data":   "<34>1 - - - - - meta",
+		"unterminated parameter":    `<34>1 - - - - - [meta text="value]`,
+		"unterminated structure id": `<34>1 - - - - - [meta`,
+	}
+
+	for name, data := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := source.ParseSyslogMessage([]byte(data), time.Now(), time.UTC)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package source_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startSyslogSource(
+	t *testing.T,
+	network string,
+	out chan *event.RawEvent[map[string]any],
+	errorHandler source.ErrorHandler,
+) *source.SyslogSource[map[string]any] {
+	t.Helper()
+
+	s, err := source.NewSyslogSource(source.SyslogSourceConfig[map[string]any]{
+		Network:        network,
+		Addr:           "127.0.0.1:0",
+		MaxMessageSize: 256,
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Start(context.Background(), out, errorHandler))
+
+	t.Cleanup(func() {
+		assert.NoError(t, s.Stop(context.Background()))
+	})
+
+	return s
+}
+
+func TestSyslogSource_UDP(t *testing.T) {
+	t.Parallel()
+
+	out := make(chan *event.RawEvent[map[string]any], 10)
+	s := startSyslogSource(t, "udp", out, func(err error) {
+		t.Errorf("unexpected source error: %v", err)
+	})
+
+	conn, err := net.Dial("udp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(`<165>1 2003-10-11T22:14:15.003Z host app 42 ID47 [origin ip="192.0.2.1"] hello`))
+	require.NoError(t, err)
+
+	rawEvent := receive(t, out)
+	assert.Equal(t, "hello", rawEvent.Content["message"])
+	assert.InDelta(t, 20, rawEvent.Content["facility"], 0)
+	assert.Equal(t, map[string]any{"origin": map[string]any{"ip": "192.0.2.1"}}, rawEvent.Content["structured_data"])
+
+	tags := rawEvent.Metadata.Tags
+	assert.Equal(t, "local4", tags[source.TagSyslogFacility])
+	assert.Equal(t, "notice", tags[source.TagSyslogSeverity])
+	assert.Equal(t, "host", tags[source.TagSyslogHostname])
+	assert.Equal(t, "app", tags[source.TagSyslogAppName])
+	assert.Equal(t, "42", tags[source.TagSyslogProcID])
+	assert.Equal(t, "ID47", tags[source.TagSyslogMsgID])
+	assert.Equal(t, "192.0.2.1", tags["syslog.sd.origin.ip"])
+	assert.Equal(t, conn.LocalAddr().String(), tags[source.TagSyslogRemoteAddr])
+}
+
+func TestSyslogSource_TCP(t *testing.T) {
+	t.Parallel()
+
+	out := make(chan *event.RawEvent[map[string]any], 10)
+	errs := make(chan error, 10)
+	s := startSyslogSource(t, "tcp", out, func(err error) {
+		errs <- err
+	})
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	tooLong := make([]byte, 300)
+	for i := range tooLong {
+		tooLong[i] = 'a'
+	}
+
+	// Octet-counted and newline framed messages can be mixed on a connection.
+	stream := "21 <13>1 - - - - - - one" +
+		"<13>Oct 11 22:14:15 host app: two\n" +
+		"<13>" + string(tooLong) + "\n" +
+		"\n" +
+		"23 <13>1 - - - - - - three" +
+		"<13>four"
+	_, err = conn.Write([]byte(stream))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+
+	for _, want := range []string{"one", "two", "three", "four"} {
+		assert.Equal(t, want, receive(t, out).Content["message"])
+	}
+
+	assert.ErrorContains(t, <-errs, "exceeds 256 bytes")
+}
+
+func TestNewSyslogSource_InvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]source.SyslogSourceConfig[map[string]any]{
+		"unsupported network": {Network: "unix", Addr: "/tmp/syslog.sock"},
+		"missing address":     {Network: "udp"},
+	}
+
+	for name, config := range testCases {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := source.NewSyslogSource(config)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -3,10 +3,15 @@ package strategy
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/tracing"
 )
 
 type payloadBuffer[T any] struct {
@@ -14,6 +19,8 @@ type payloadBuffer[T any] struct {
 	// sizeLimit is the maximum byte size of the payload buffer.
 	sizeLimit   int
 	currentSize int
+	// size mirrors currentSize so that it can be read from other goroutines.
+	size atomic.Int64
 }
 
 func newPayloadBuffer[T any](sizeLimit int) *payloadBuffer[T] {
@@ -33,6 +40,7 @@ func (pb *payloadBuffer[T]) add(payload *event.Payload[T]) bool {
 
 	pb.payloads = append(pb.payloads, payload)
 	pb.currentSize += len(payload.JSONEncodedContent)
+	pb.size.Store(int64(pb.currentSize))
 
 	return true
 }
@@ -51,13 +59,24 @@ func (pb *payloadBuffer[T]) payload() *event.Payload[T] {
 	return event.NewPayload[T](&event.Metadata{}, payload)
 }
 
-func (pb payloadBuffer[T]) reachLimit(nextMessageContentSize int) bool {
+// metadata returns the metadata of the buffered payloads.
+func (pb *payloadBuffer[T]) metadata() []*event.Metadata {
+	metadata := make([]*event.Metadata, 0, len(pb.payloads))
+	for _, p := range pb.payloads {
+		metadata = append(metadata, p.Metadata)
+	}
+
+	return metadata
+}
+
+func (pb *payloadBuffer[T]) reachLimit(nextMessageContentSize int) bool {
 	return pb.currentSize+nextMessageContentSize > pb.sizeLimit
 }
 
 func (pb *payloadBuffer[T]) clear() {
 	pb.payloads = []*event.Payload[T]{}
 	pb.currentSize = 0
+	pb.size.Store(0)
 }
 
 type batchStrategy[T any] struct {
@@ -70,7 +89,10 @@ type batchStrategy[T any] struct {
 	buffer       *payloadBuffer[T]
 	waitDuration time.Duration
 
-	clock Clock
+	clock   Clock
+	metrics *metrics.DestinationMetrics
+	tracer  *tracing.Tracer
+	onDrop  event.DropHandler[T]
 
 	quit chan struct{}
 }
@@ -83,6 +105,28 @@ func WithClock[T any](clock Clock) BatchStrategyOptionsFunc[T] {
 	}
 }
 
+// WithMetrics records the encoded, batched and flushed events and the buffer size in m.
+func WithMetrics[T any](m *metrics.DestinationMetrics) BatchStrategyOptionsFunc[T] {
+	return func(b *batchStrategy[T]) {
+		b.metrics = m
+	}
+}
+
+// WithTracer creates a span for each event added to a batch and for each flushed batch,
+// which is linked to the spans of its events.
+func WithTracer[T any](t *tracing.Tracer) BatchStrategyOptionsFunc[T] {
+	return func(b *batchStrategy[T]) {
+		b.tracer = t
+	}
+}
+
+// WithDropHandler calls h for each event that fails to be encoded or exceeds the buffer limit.
+func WithDropHandler[T any](h event.DropHandler[T]) BatchStrategyOptionsFunc[T] {
+	return func(b *batchStrategy[T]) {
+		b.onDrop = h
+	}
+}
+
 func NewBatchStrategy[T any](
 	inputChan chan *event.Event[T],
 	outputChan chan<- *event.Payload[T],
@@ -105,6 +149,10 @@ func NewBatchStrategy[T any](
 		opt(s)
 	}
 
+	s.metrics.SetBatchBufferBytesFunc(func() int {
+		return int(s.buffer.size.Load())
+	})
+
 	return s
 }
 
@@ -122,6 +170,8 @@ func (b *batchStrategy[T]) Start() {
 			select {
 			case evt, ok := <-b.inputChan:
 				if !ok {
+					// Send the events buffered since the last flush before stopping.
+					b.flush()
 					return
 				}
 				b.processMessage(evt)
@@ -157,11 +207,18 @@ func (b *batchStrategy[T]) Flush(ctx context.Context) {
 }
 
 func (b *batchStrategy[T]) processMessage(evt *event.Event[T]) {
+	span := b.tracer.Start(&evt.Metadata, "conduit.batch.add")
+	defer span.End()
+
 	encodedContent, err := evt.MarshalJSON()
 	if err != nil {
+		tracing.RecordError(span, err)
+		b.metrics.EncodeFailed()
 		log.Error(fmt.Sprintf("failed to marshal event content: %v", err))
+		b.onDrop.Handle(newEncodeDropped(evt, err))
 		return
 	}
+	b.metrics.EventEncoded()
 
 	payload := event.NewPayload[T](&evt.Metadata, encodedContent)
 
@@ -169,9 +226,17 @@ func (b *batchStrategy[T]) processMessage(evt *event.Event[T]) {
 		b.flush()
 
 		if added := b.buffer.add(payload); !added {
+			b.metrics.EventDropped(metrics.DropReasonTooLarge)
 			log.Warn("Payload size exceeds buffer limit, dropping message")
+			b.onDrop.Handle(&event.DroppedEvent[T]{
+				Event:  evt,
+				Stage:  event.DropStageBatch,
+				Reason: metrics.DropReasonTooLarge,
+			})
+			return
 		}
 	}
+	b.metrics.EventBatched()
 }
 
 func (b *batchStrategy[T]) flush() {
@@ -180,6 +245,12 @@ func (b *batchStrategy[T]) flush() {
 		return
 	}
 
+	span := b.tracer.StartLinked(payload.Metadata, "conduit.batch.flush", b.buffer.metadata(),
+		trace.WithAttributes(tracing.AttributeBatchSize.Int(len(b.buffer.payloads))),
+	)
+	defer span.End()
+
 	b.buffer.clear()
+	b.metrics.BatchFlushed(len(payload.JSONEncodedContent))
 	b.outputChan <- payload
 }
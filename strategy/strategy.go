@@ -6,6 +6,8 @@ import (
 
 	"github.com/mrtc0/conduit/event"
 	"github.com/mrtc0/conduit/log"
+	"github.com/mrtc0/conduit/metrics"
+	"github.com/mrtc0/conduit/tracing"
 )
 
 type StrategyType string
@@ -32,27 +34,73 @@ type SendingStrategy[T any] interface {
 type StreamStrategy[T any] struct {
 	inputChan  InputChannel[T]
 	outputChan chan<- *event.Payload[T]
-	done       chan struct{}
+	// flushRequests asks the running strategy to send the buffered messages and close the given channel.
+	flushRequests chan chan struct{}
+	done          chan struct{}
+
+	metrics *metrics.DestinationMetrics
+	tracer  *tracing.Tracer
+	onDrop  event.DropHandler[T]
+}
+
+type StreamStrategyOptionsFunc[T any] func(*StreamStrategy[T])
+
+// WithStreamMetrics records the encoded events in m.
+func WithStreamMetrics[T any](m *metrics.DestinationMetrics) StreamStrategyOptionsFunc[T] {
+	return func(s *StreamStrategy[T]) {
+		s.metrics = m
+	}
+}
+
+// WithStreamTracer creates a span for each encoded event.
+func WithStreamTracer[T any](t *tracing.Tracer) StreamStrategyOptionsFunc[T] {
+	return func(s *StreamStrategy[T]) {
+		s.tracer = t
+	}
+}
+
+// WithStreamDropHandler calls h for each event that fails to be encoded.
+func WithStreamDropHandler[T any](h event.DropHandler[T]) StreamStrategyOptionsFunc[T] {
+	return func(s *StreamStrategy[T]) {
+		s.onDrop = h
+	}
 }
 
 func NewStreamStrategy[T any](
 	inputChan InputChannel[T],
 	outputChan chan<- *event.Payload[T],
+	opts ...StreamStrategyOptionsFunc[T],
 ) SendingStrategy[T] {
-	return &StreamStrategy[T]{
-		inputChan:  inputChan,
-		outputChan: outputChan,
-		done:       make(chan struct{}),
+	s := &StreamStrategy[T]{
+		inputChan:     inputChan,
+		outputChan:    outputChan,
+		flushRequests: make(chan chan struct{}),
+		done:          make(chan struct{}),
 	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 func (s *StreamStrategy[T]) Start() {
 	go func() {
-		for evt := range s.inputChan {
-			s.processMessage(evt)
-		}
+		defer close(s.done)
 
-		s.done <- struct{}{}
+		for {
+			select {
+			case evt, ok := <-s.inputChan:
+				if !ok {
+					return
+				}
+				s.processMessage(evt)
+			case flushed := <-s.flushRequests:
+				s.drain()
+				close(flushed)
+			}
+		}
 	}()
 }
 
@@ -60,32 +108,55 @@ func (s *StreamStrategy[T]) WaitStop() {
 	<-s.done
 }
 
+// Flush waits until the messages buffered in the input channel are sent.
 func (s *StreamStrategy[T]) Flush(ctx context.Context) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if len(s.inputChan) == 0 {
-				return
-			}
-			evt, ok := <-s.inputChan
-			if !ok {
-				return
-			}
+	flushed := make(chan struct{})
 
-			s.processMessage(evt)
+	select {
+	case s.flushRequests <- flushed:
+	case <-s.done:
+		return
+	case <-ctx.Done():
+		return
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+	}
+}
+
+// drain sends the messages buffered in the input channel without waiting for new ones.
+func (s *StreamStrategy[T]) drain() {
+	for len(s.inputChan) > 0 {
+		evt, ok := <-s.inputChan
+		if !ok {
 			return
 		}
+		s.processMessage(evt)
+	}
+}
+
+func newEncodeDropped[T any](evt *event.Event[T], err error) *event.DroppedEvent[T] {
+	return &event.DroppedEvent[T]{
+		Event:  evt,
+		Stage:  event.DropStageEncode,
+		Reason: fmt.Sprintf("failed to marshal event content: %v", err),
+		Err:    err,
 	}
 }
 
 func (s *StreamStrategy[T]) processMessage(evt *event.Event[T]) {
+	span := s.tracer.Start(&evt.Metadata, "conduit.encode")
 	encodedContent, err := evt.MarshalJSON()
+	tracing.End(span, err)
 	if err != nil {
+		s.metrics.EncodeFailed()
 		log.Error(fmt.Sprintf("failed to marshal event content: %v", err))
+		s.onDrop.Handle(newEncodeDropped(evt, err))
 		return
 	}
+	s.metrics.EventEncoded()
 
 	s.outputChan <- event.NewPayload[T](&evt.Metadata, encodedContent)
 }
@@ -43,3 +43,32 @@ func TestStreamStrategy(t *testing.T) {
 
 	<-done
 }
+
+func TestStreamStrategy_DropHandler(t *testing.T) {
+	t.Parallel()
+
+	inputChan := make(chan *event.Event[map[string]any])
+	outputChan := make(chan *event.Payload[map[string]any])
+	dropped := make(chan *event.DroppedEvent[map[string]any], 1)
+
+	s := strategy.NewStreamStrategy(inputChan, outputChan,
+		strategy.WithStreamDropHandler(func(d *event.DroppedEvent[map[string]any]) {
+			dropped <- d
+		}),
+	)
+	s.Start()
+
+	evt := event.NewEvent(&event.RawEvent[map[string]any]{
+		Content: map[string]any{"unsupported": make(chan int)},
+	})
+	inputChan <- evt
+	close(inputChan)
+	s.WaitStop()
+
+	d := <-dropped
+	assert.Same(t, evt, d.Event)
+	assert.Equal(t, event.DropStageEncode, d.Stage)
+	assert.Error(t, d.Err)
+	assert.Contains(t, d.Reason, "failed to marshal event content")
+	assert.Empty(t, outputChan)
+}
@@ -68,7 +68,7 @@ func (c *MockClock) Add(d time.Duration) {
 	newTime := c.now.Add(d)
 
 	timer := c.timer
-	if timer.until.After(newTime) {
+	if timer.fn == nil || timer.until.After(newTime) {
 		c.now = newTime
 		return
 	}
@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mrtc0/conduit/event"
+)
+
+const (
+	// ScopeName is the instrumentation scope of the spans created by Conduit.
+	ScopeName = "github.com/mrtc0/conduit"
+
+	// TraceParentHeader is the W3C Trace Context header holding the trace and the parent span.
+	TraceParentHeader = "traceparent"
+	// TraceStateHeader is the W3C Trace Context header holding vendor specific trace information.
+	TraceStateHeader = "tracestate"
+
+	// AttributeDestination is the span attribute holding the name of the destination.
+	AttributeDestination = attribute.Key("conduit.destination")
+	// AttributeRuleName is the span attribute holding the name of the processing rule.
+	AttributeRuleName = attribute.Key("conduit.rule.name")
+	// AttributeRuleDropped is the span attribute telling whether a filter rule dropped the event.
+	AttributeRuleDropped = attribute.Key("conduit.rule.dropped")
+	// AttributeRuleReason is the span attribute holding the reason of a filter rule.
+	AttributeRuleReason = attribute.Key("conduit.rule.reason")
+	// AttributeRuleSplit is the span attribute holding the number of events a split rule produced.
+	AttributeRuleSplit = attribute.Key("conduit.rule.split")
+	// AttributeAttempt is the span attribute holding the attempt number of a sink write.
+	AttributeAttempt = attribute.Key("conduit.sink.attempt")
+	// AttributeBatchSize is the span attribute holding the number of events in a batch.
+	AttributeBatchSize = attribute.Key("conduit.batch.events")
+)
+
+var propagator = propagation.TraceContext{}
+
+// Tracer creates the spans of the stages of a Conduit.
+// The trace context of an event is carried in its event.Metadata, so that
+// the spans of every stage belong to the trace the event was received with.
+//
+// All methods can be called on a nil *Tracer, in which case they return non-recording spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New creates a Tracer using the TracerProvider. If tp is nil, nil is returned.
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		return nil
+	}
+
+	return &Tracer{tracer: tp.Tracer(ScopeName)}
+}
+
+// StartIngest starts the span of an event entering the pipeline, as a child of the trace context in md.
+// The trace context in md is replaced with the new span,
+// so that the spans of the following stages are its children.
+func (t *Tracer) StartIngest(md *event.Metadata) trace.Span {
+	if t == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+
+	ctx, span := t.tracer.Start(Extract(context.Background(), md), "conduit.ingest",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+	)
+	Inject(ctx, md)
+
+	return span
+}
+
+// Start starts a span as a child of the trace context in md.
+func (t *Tracer) Start(md *event.Metadata, name string, opts ...trace.SpanStartOption) trace.Span {
+	if t == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+
+	_, span := t.tracer.Start(Extract(context.Background(), md), name, opts...)
+
+	return span
+}
+
+// StartLinked starts a root span linked to the trace contexts of the given events,
+// such as the span of a batch made of the events.
+// The trace context of the new span is stored in md.
+func (t *Tracer) StartLinked(
+	md *event.Metadata,
+	name string,
+	linked []*event.Metadata,
+	opts ...trace.SpanStartOption,
+) trace.Span {
+	if t == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+
+	links := make([]trace.Link, 0, len(linked))
+	for _, l := range linked {
+		if sc := SpanContext(l); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	opts = append(opts, trace.WithNewRoot(), trace.WithLinks(links...))
+	ctx, span := t.tracer.Start(context.Background(), name, opts...)
+	Inject(ctx, md)
+
+	return span
+}
+
+// End records err, if any, on the span and ends it.
+func End(span trace.Span, err error) {
+	RecordError(span, err)
+	span.End()
+}
+
+// RecordError records err, if any, on the span and sets its status to error.
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Inject stores the trace context of ctx in md.
+// It can be used to attach the current trace to an event passed to Conduit.Write.
+func Inject(ctx context.Context, md *event.Metadata) {
+	propagator.Inject(ctx, metadataCarrier{md: md})
+}
+
+// Extract returns a copy of ctx with the trace context stored in md.
+func Extract(ctx context.Context, md *event.Metadata) context.Context {
+	if md == nil {
+		return ctx
+	}
+
+	return propagator.Extract(ctx, metadataCarrier{md: md})
+}
+
+// SpanContext returns the span context stored in md.
+func SpanContext(md *event.Metadata) trace.SpanContext {
+	return trace.SpanContextFromContext(Extract(context.Background(), md))
+}
+
+// metadataCarrier adapts event.Metadata to a propagation.TextMapCarrier.
+type metadataCarrier struct {
+	md *event.Metadata
+}
+
+func (c metadataCarrier) Get(key string) string {
+	switch key {
+	case TraceParentHeader:
+		return c.md.TraceParent
+	case TraceStateHeader:
+		return c.md.TraceState
+	default:
+		return ""
+	}
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	switch key {
+	case TraceParentHeader:
+		c.md.TraceParent = value
+	case TraceStateHeader:
+		c.md.TraceState = value
+	}
+}
+
+func (c metadataCarrier) Keys() []string {
+	return []string{TraceParentHeader, TraceStateHeader}
+}
@@ -0,0 +1,86 @@
+package tracing_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/mrtc0/conduit/event"
+	"github.com/mrtc0/conduit/tracing"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func newTestTracer() (*tracing.Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	return tracing.New(tp), exporter
+}
+
+func TestTracer_StartIngest(t *testing.T) {
+	t.Parallel()
+
+	tracer, exporter := newTestTracer()
+
+	md := &event.Metadata{TraceParent: testTraceParent, TraceState: "vendor=value"}
+	ingest := tracer.StartIngest(md)
+	child := tracer.Start(md, "child")
+	tracing.End(child, errors.New("failed"))
+	tracing.End(ingest, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, "conduit.ingest", spans[1].Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[1].Parent.SpanID().String())
+	assert.Equal(t, "vendor=value", spans[1].SpanContext.TraceState().String())
+
+	// The metadata carries the ingest span, so the following spans are its children.
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, spans[1].SpanContext.SpanID(), tracing.SpanContext(md).SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "failed", spans[0].Status.Description)
+}
+
+func TestTracer_StartLinked(t *testing.T) {
+	t.Parallel()
+
+	tracer, exporter := newTestTracer()
+
+	first := &event.Metadata{TraceParent: testTraceParent}
+	second := &event.Metadata{}
+	md := &event.Metadata{}
+
+	tracer.StartLinked(md, "batch", []*event.Metadata{first, second}).End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+
+	assert.False(t, spans[0].Parent.IsValid())
+	require.Len(t, spans[0].Links, 1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].Links[0].SpanContext.TraceID().String())
+	assert.Equal(t, spans[0].SpanContext.SpanID(), tracing.SpanContext(md).SpanID())
+}
+
+func TestTracer_Nil(t *testing.T) {
+	t.Parallel()
+
+	var tracer *tracing.Tracer
+	assert.Nil(t, tracing.New(nil))
+
+	md := &event.Metadata{TraceParent: testTraceParent}
+	assert.NotPanics(t, func() {
+		tracing.End(tracer.StartIngest(md), nil)
+		tracing.End(tracer.Start(md, "child"), errors.New("failed"))
+		tracing.End(tracer.StartLinked(&event.Metadata{}, "batch", []*event.Metadata{md}), nil)
+	})
+	assert.Equal(t, testTraceParent, md.TraceParent)
+}